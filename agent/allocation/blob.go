@@ -6,13 +6,17 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 const (
-	blobSpecPrefix = "### BLOB "
-	blobV2Prefix   = "### BLOB_V2 "
+	blobSpecPrefix     = "### BLOB "
+	blobV2Prefix       = "### BLOB_V2 "
+	blobBackupSuffix   = ".bak"
+	defaultBlobDirMode = 0755
 )
 
 type BlobSlice []*Blob
@@ -20,6 +24,7 @@ type BlobSlice []*Blob
 func (s *BlobSlice) GetEmpty(paths SystemPaths) (empty Asset) {
 	empty = &Blob{
 		Permissions: 0644,
+		SystemPaths: paths,
 	}
 	return
 }
@@ -36,8 +41,24 @@ func (s *BlobSlice) AppendItem(v Asset) {
 type Blob struct {
 	Name        string
 	Permissions int    `json:",omitempty"`
+	Owner       string `json:",omitempty"`
+	Group       string `json:",omitempty"`
+	DirMode     int    `json:",omitempty"`
+	Backup      bool   `json:",omitempty"`
 	Leave       bool   `json:",omitempty"`
+	SourceFile  string `json:",omitempty"` // Local archive path
+	SourceURL   string `json:",omitempty"`
+	SHA256      string `json:",omitempty"` // Checksum of fetched source or archive
+	Archive     string `json:",omitempty"`
 	Source      string `json:"-"`
+
+	SystemPaths SystemPaths `json:"-"`
+}
+
+// IsExternal returns true if blob content is not stored in Source
+func (b *Blob) IsExternal() (ok bool) {
+	ok = b.SourceURL != "" || b.Archive != ""
+	return
 }
 
 func (b *Blob) MarshalSpec(w io.Writer) (err error) {
@@ -50,6 +71,7 @@ func (b *Blob) MarshalSpec(w io.Writer) (err error) {
 
 // Unmarshal blob item from manifest. Line may be in two revisions:
 func (b *Blob) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err error) {
+	b.SystemPaths = paths
 	switch spec.Revision {
 	case "":
 		if _, err = fmt.Sscanf(line, "### BLOB %s", &b.Name); err != nil {
@@ -65,6 +87,10 @@ func (b *Blob) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err err
 			return
 		}
 	}
+	if b.IsExternal() {
+		// external blobs are compared by checksum
+		return
+	}
 	src, err := ioutil.ReadFile(b.Name)
 	if err != nil {
 		return
@@ -73,10 +99,134 @@ func (b *Blob) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err err
 	return
 }
 
+// Write writes blob to temporary file in the same directory and renames it
+// to blob name. With Backup replaced file is kept as "<name>.bak".
 func (b *Blob) Write() (err error) {
-	if err = os.MkdirAll(filepath.Dir(b.Name), os.FileMode(b.Permissions)); err != nil {
+	uid, gid, err := lookupOwner(b.Owner, b.Group)
+	if err != nil {
+		return
+	}
+	dirMode := os.FileMode(defaultBlobDirMode)
+	if b.DirMode != 0 {
+		dirMode = os.FileMode(b.DirMode)
+	}
+	dir := filepath.Dir(b.Name)
+	if err = os.MkdirAll(dir, dirMode); err != nil {
+		return
+	}
+	if b.Archive != "" {
+		err = b.writeArchive(dirMode, uid, gid)
 		return
 	}
-	err = ioutil.WriteFile(b.Name, []byte(b.Source), os.FileMode(b.Permissions))
+	var source io.Reader = strings.NewReader(b.Source)
+	if b.SourceURL != "" {
+		var path string
+		if path, err = b.fetch(); err != nil {
+			return
+		}
+		var f *os.File
+		if f, err = os.Open(path); err != nil {
+			return
+		}
+		defer f.Close()
+		source = f
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(b.Name)+".")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, source); err != nil {
+		return
+	}
+	if err = tmp.Chmod(os.FileMode(b.Permissions)); err != nil {
+		return
+	}
+	if uid != -1 || gid != -1 {
+		if err = tmp.Chown(uid, gid); err != nil {
+			return
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if b.Backup {
+		if err = backupFile(b.Name); err != nil {
+			return
+		}
+	}
+	if err = os.Rename(tmp.Name(), b.Name); err != nil {
+		return
+	}
+	err = syncDir(dir)
+	return
+}
+
+// Remove removes blob from filesystem
+func (b *Blob) Remove() (err error) {
+	if b.Archive != "" {
+		err = os.RemoveAll(b.Name)
+		return
+	}
+	err = os.Remove(b.Name)
+	return
+}
+
+// backupFile hard links existent file to "<name>.bak"
+func backupFile(name string) (err error) {
+	backup := name + blobBackupSuffix
+	if err = os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Link(name, backup); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func syncDir(name string) (err error) {
+	dir, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	err = dir.Sync()
+	return
+}
+
+// lookupOwner returns uid and gid by given user and group names or ids.
+// Returns -1 for empty values.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			var u *user.User
+			if u, err = user.Lookup(owner); err != nil {
+				return
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return
+			}
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			var g *user.Group
+			if g, err = user.LookupGroup(group); err != nil {
+				return
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return
+			}
+		}
+	}
 	return
 }
@@ -0,0 +1,280 @@
+package allocation
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const blobCacheDir = "blobs"
+
+var blobHTTPClient = &http.Client{
+	Timeout: time.Minute * 10,
+}
+
+// fetch returns path to cached source of blob with source URL. Source is
+// downloaded only if cached copy is missing or has wrong checksum.
+func (b *Blob) fetch() (path string, err error) {
+	if b.SystemPaths.State == "" {
+		err = fmt.Errorf(`blob "%s": state directory is not defined`, b.Name)
+		return
+	}
+	cacheDir := filepath.Join(b.SystemPaths.State, blobCacheDir)
+	path = filepath.Join(cacheDir, b.SHA256)
+	if sum, sumErr := fileSHA256(path); sumErr == nil && sum == b.SHA256 {
+		return
+	}
+	if err = os.MkdirAll(cacheDir, 0700); err != nil {
+		return
+	}
+	resp, err := blobHTTPClient.Get(b.SourceURL)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf(`blob "%s": fetch %s: %s`, b.Name, b.SourceURL, resp.Status)
+		return
+	}
+	tmp, err := ioutil.TempFile(cacheDir, "."+b.SHA256+".")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		return
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != b.SHA256 {
+		err = fmt.Errorf(`blob "%s": checksum mismatch for %s: expected %s, got %s`, b.Name, b.SourceURL, b.SHA256, sum)
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+// writeArchive extracts archive to temporary directory and replaces blob
+// directory with it
+func (b *Blob) writeArchive(dirMode os.FileMode, uid, gid int) (err error) {
+	source := b.SourceFile
+	if b.SourceURL != "" {
+		if source, err = b.fetch(); err != nil {
+			return
+		}
+	}
+	parent, base := filepath.Dir(b.Name), filepath.Base(b.Name)
+	tmp, err := ioutil.TempDir(parent, "."+base+".")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmp)
+		}
+	}()
+	if err = extractArchive(b.Archive, source, tmp); err != nil {
+		err = fmt.Errorf(`blob "%s": extract %s: %v`, b.Name, source, err)
+		return
+	}
+	if err = os.Chmod(tmp, dirMode); err != nil {
+		return
+	}
+	if uid != -1 || gid != -1 {
+		if err = filepath.Walk(tmp, func(path string, info os.FileInfo, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			return os.Lchown(path, uid, gid)
+		}); err != nil {
+			return
+		}
+	}
+
+	// directories can not be replaced with one rename
+	old := filepath.Join(parent, "."+base+".old")
+	if b.Backup {
+		old = b.Name + blobBackupSuffix
+	}
+	if err = os.RemoveAll(old); err != nil {
+		return
+	}
+	if err = os.Rename(b.Name, old); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Rename(tmp, b.Name); err != nil {
+		return
+	}
+	if !b.Backup {
+		err = os.RemoveAll(old)
+	}
+	return
+}
+
+// checkSHA256 returns error if expected checksum is defined and not matched
+func checkSHA256(name, source, expected, actual string) (err error) {
+	if expected != "" && !strings.EqualFold(expected, actual) {
+		err = fmt.Errorf(`blob "%s": checksum mismatch for %s: expected %s, got %s`, name, source, expected, actual)
+	}
+	return
+}
+
+func fileSHA256(path string) (res string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return
+	}
+	res = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+func extractArchive(format, source, dst string) (err error) {
+	if format == "zip" {
+		err = extractZip(source, dst)
+		return
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if format == "tar.gz" || format == "tgz" {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(f); err != nil {
+			return
+		}
+		defer gz.Close()
+		r = gz
+	}
+	err = extractTar(r, dst)
+	return
+}
+
+func extractTar(r io.Reader, dst string) (err error) {
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		var target string
+		if target, err = archiveTarget(dst, hdr.Name); err != nil {
+			return
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, hdr.FileInfo().Mode().Perm()|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeArchiveFile(target, hdr.FileInfo().Mode().Perm(), tr)
+		case tar.TypeSymlink:
+			err = writeArchiveSymlink(dst, target, hdr.Linkname)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func extractZip(source, dst string) (err error) {
+	zr, err := zip.OpenReader(source)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+	for _, file := range zr.File {
+		var target string
+		if target, err = archiveTarget(dst, file.Name); err != nil {
+			return
+		}
+		if file.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, file.Mode().Perm()|0700); err != nil {
+				return
+			}
+			continue
+		}
+		var rc io.ReadCloser
+		if rc, err = file.Open(); err != nil {
+			return
+		}
+		err = writeArchiveFile(target, file.Mode().Perm(), rc)
+		rc.Close()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// archiveTarget returns path of archive entry in dst. Entries outside of dst
+// are rejected.
+func archiveTarget(dst, name string) (res string, err error) {
+	res = filepath.Join(dst, name)
+	if !isWithin(dst, res) {
+		err = fmt.Errorf("illegal path %s", name)
+	}
+	return
+}
+
+func isWithin(dir, path string) (ok bool) {
+	ok = path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+	return
+}
+
+func writeArchiveFile(target string, mode os.FileMode, r io.Reader) (err error) {
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	return
+}
+
+func writeArchiveSymlink(dst, target, link string) (err error) {
+	resolved := link
+	if !filepath.IsAbs(link) {
+		resolved = filepath.Join(filepath.Dir(target), link)
+	}
+	if !isWithin(dst, filepath.Clean(resolved)) {
+		err = fmt.Errorf("illegal link %s", link)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return
+	}
+	err = os.Symlink(link, target)
+	return
+}
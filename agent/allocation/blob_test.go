@@ -3,9 +3,21 @@
 package allocation_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/akaspin/soil/agent/allocation"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
 	"testing"
 )
 
@@ -42,3 +54,188 @@ func TestBlob_MarshalLine(t *testing.T) {
 	assert.NoError(t, b.MarshalSpec(&buf))
 	assert.Equal(t, "### BLOB {\"Name\":\"testdata/blob.txt\",\"Leave\":true}\n", buf.String())
 }
+
+func TestBlob_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	name := filepath.Join(dir, "sub", "blob.txt")
+	b := &allocation.Blob{
+		Name:        name,
+		Permissions: 0600,
+		Owner:       current.Username,
+		Group:       current.Gid,
+		DirMode:     0700,
+		Backup:      true,
+		Source:      "1",
+	}
+	t.Run(`create`, func(t *testing.T) {
+		require.NoError(t, b.Write())
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode())
+		dirInfo, err := os.Stat(filepath.Dir(name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+		_, err = os.Stat(name + ".bak")
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run(`update with backup`, func(t *testing.T) {
+		b.Source = "2"
+		require.NoError(t, b.Write())
+		src, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, "2", string(src))
+		backup, err := ioutil.ReadFile(name + ".bak")
+		require.NoError(t, err)
+		assert.Equal(t, "1", string(backup))
+		files, err := ioutil.ReadDir(filepath.Dir(name))
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+	})
+	t.Run(`bad owner`, func(t *testing.T) {
+		b.Owner = "soil-non-existent-user"
+		b.Source = "3"
+		assert.Error(t, b.Write())
+		src, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, "2", string(src))
+	})
+}
+
+func TestBlob_Write_SourceURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("artifact"))
+	}))
+	defer ts.Close()
+	sum := sha256.Sum256([]byte("artifact"))
+
+	paths := allocation.SystemPaths{
+		State: filepath.Join(dir, "state"),
+	}
+	b := &allocation.Blob{
+		Name:        filepath.Join(dir, "blob"),
+		Permissions: 0644,
+		SourceURL:   ts.URL,
+		SHA256:      hex.EncodeToString(sum[:]),
+		SystemPaths: paths,
+	}
+	t.Run(`fetch`, func(t *testing.T) {
+		require.NoError(t, b.Write())
+		src, err := ioutil.ReadFile(b.Name)
+		require.NoError(t, err)
+		assert.Equal(t, "artifact", string(src))
+		assert.Equal(t, 1, requests)
+	})
+	t.Run(`cached`, func(t *testing.T) {
+		require.NoError(t, b.Write())
+		assert.Equal(t, 1, requests)
+	})
+	t.Run(`checksum mismatch`, func(t *testing.T) {
+		bad := *b
+		bad.Name = filepath.Join(dir, "bad")
+		bad.SHA256 = hex.EncodeToString(make([]byte, 32))
+		assert.Error(t, bad.Write())
+		_, err := os.Stat(bad.Name)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run(`no state`, func(t *testing.T) {
+		bad := *b
+		bad.SystemPaths = allocation.SystemPaths{}
+		assert.Error(t, bad.Write())
+	})
+}
+
+func TestBlob_Write_Archive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	}
+	tgzPath := filepath.Join(dir, "source.tar.gz")
+	var tgz bytes.Buffer
+	gz := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, ioutil.WriteFile(tgzPath, tgz.Bytes(), 0644))
+
+	zipPath := filepath.Join(dir, "source.zip")
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content + "-zip"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, ioutil.WriteFile(zipPath, zipBuf.Bytes(), 0644))
+
+	b := &allocation.Blob{
+		Name:       filepath.Join(dir, "target"),
+		Backup:     true,
+		SourceFile: tgzPath,
+		Archive:    "tar.gz",
+	}
+	t.Run(`tar.gz`, func(t *testing.T) {
+		require.NoError(t, b.Write())
+		for name, content := range files {
+			src, err := ioutil.ReadFile(filepath.Join(b.Name, name))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(src))
+		}
+	})
+	t.Run(`zip with backup`, func(t *testing.T) {
+		b.SourceFile = zipPath
+		b.Archive = "zip"
+		require.NoError(t, b.Write())
+		src, err := ioutil.ReadFile(filepath.Join(b.Name, "sub/b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "b-zip", string(src))
+		backup, err := ioutil.ReadFile(filepath.Join(b.Name+".bak", "sub/b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "b", string(backup))
+	})
+	t.Run(`illegal path`, func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0600, Size: 1, Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		evilPath := filepath.Join(dir, "evil.tar")
+		require.NoError(t, ioutil.WriteFile(evilPath, buf.Bytes(), 0644))
+
+		evil := &allocation.Blob{
+			Name:       filepath.Join(dir, "evil"),
+			SourceFile: evilPath,
+			Archive:    "tar",
+		}
+		assert.Error(t, evil.Write())
+		_, err := os.Stat(filepath.Join(dir, "evil"))
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run(`remove`, func(t *testing.T) {
+		require.NoError(t, b.Remove())
+		_, err := os.Stat(b.Name)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -1,11 +1,11 @@
 package allocation
 
-import "github.com/coreos/go-systemd/dbus"
+import "github.com/akaspin/soil/lib"
 
 const DefaultPodPrefix = "pod-*"
 
-func dbusDiscoveryFunc(prefix ...string) (res []string, err error) {
-	conn, err := dbus.New()
+func discoveryFunc(factory lib.SystemdConnFactory, prefix ...string) (res []string, err error) {
+	conn, err := factory()
 	if err != nil {
 		return
 	}
@@ -22,10 +22,18 @@ func dbusDiscoveryFunc(prefix ...string) (res []string, err error) {
 }
 
 func DefaultDbusDiscoveryFunc() (res []string, err error) {
-	res, err = dbusDiscoveryFunc(DefaultPodPrefix)
+	res, err = discoveryFunc(lib.NewDbusSystemdConn, DefaultPodPrefix)
 	return
 }
 
+// GetDiscoveryFunc returns function to discover pod units with given SystemD
+// connection factory
+func GetDiscoveryFunc(factory lib.SystemdConnFactory) func() ([]string, error) {
+	return func() ([]string, error) {
+		return discoveryFunc(factory, DefaultPodPrefix)
+	}
+}
+
 func GetZeroDiscoveryFunc(paths ...string) func() ([]string, error) {
 	return func() ([]string, error) {
 		return paths, nil
@@ -0,0 +1,92 @@
+package allocation
+
+import (
+	"encoding/json"
+	"github.com/akaspin/soil/manifest"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dropInSpecPrefix = "### DROPIN "
+
+type DropInSlice []*DropIn
+
+func (s *DropInSlice) GetEmpty(paths SystemPaths) (empty Asset) {
+	empty = &DropIn{
+		SystemPaths: paths,
+	}
+	return
+}
+
+func (s *DropInSlice) GetVersionPrefix(v string) (p string) {
+	p = dropInSpecPrefix
+	return
+}
+
+func (s *DropInSlice) AppendItem(v Asset) {
+	*s = append(*s, v.(*DropIn))
+}
+
+// DropIn is systemd drop-in file for unit which is not managed by pod
+type DropIn struct {
+	manifest.Transition `json:",squash"`
+	SystemPaths         SystemPaths `json:"-"`
+	Unit                string      // Parent unit name
+	Path                string
+	Source              string `json:"-"`
+}
+
+func NewDropIn(unitName, name string, paths SystemPaths, runtime bool) (d *DropIn) {
+	basePath := paths.Local
+	if runtime {
+		basePath = paths.Runtime
+	}
+	d = &DropIn{
+		SystemPaths: paths,
+		Unit:        unitName,
+		Path:        filepath.Join(basePath, unitName+".d", name),
+	}
+	return
+}
+
+func (d *DropIn) MarshalSpec(w io.Writer) (err error) {
+	if _, err = w.Write([]byte(dropInSpecPrefix)); err != nil {
+		return
+	}
+	err = json.NewEncoder(w).Encode(d)
+	return
+}
+
+func (d *DropIn) UnmarshalSpec(line string, spec Spec, paths SystemPaths) (err error) {
+	d.SystemPaths = paths
+	if err = json.NewDecoder(strings.NewReader(strings.TrimPrefix(line, dropInSpecPrefix))).Decode(d); err != nil {
+		return
+	}
+	src, err := ioutil.ReadFile(d.Path)
+	if err != nil {
+		return
+	}
+	d.Source = string(src)
+	return
+}
+
+// UnitFile returns parent unit file. Parent unit may be located anywhere
+// and returned file should be used only to execute systemd commands.
+func (d *DropIn) UnitFile() (f UnitFile) {
+	f = UnitFile{
+		SystemPaths: d.SystemPaths,
+		Path:        filepath.Join(filepath.Dir(filepath.Dir(d.Path)), d.Unit),
+	}
+	return
+}
+
+func (d *DropIn) Write() (err error) {
+	if err = os.MkdirAll(filepath.Dir(d.Path), 0755); err != nil {
+		return
+	}
+	err = ioutil.WriteFile(d.Path, []byte(d.Source), 0644)
+	return
+}
@@ -0,0 +1,41 @@
+// +build ide test_unit
+
+package allocation_test
+
+import (
+	"bytes"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDropIn_MarshalSpec(t *testing.T) {
+	d := allocation.NewDropIn("docker.service", "10-soil.conf", allocation.DefaultSystemPaths(), true)
+	d.Transition = manifest.Transition{
+		Update: "restart",
+	}
+	d.Source = "[Service]\n"
+	var buf bytes.Buffer
+	assert.NoError(t, d.MarshalSpec(&buf))
+	assert.Equal(t, "### DROPIN {\"Update\":\"restart\",\"Unit\":\"docker.service\",\"Path\":\"/run/systemd/system/docker.service.d/10-soil.conf\"}\n", buf.String())
+}
+
+func TestDropIn_UnmarshalSpec(t *testing.T) {
+	line := `### DROPIN {"Update":"restart","Unit":"docker.service","Path":"testdata/dropin.conf"}`
+	var d allocation.DropIn
+	assert.NoError(t, (&d).UnmarshalSpec(line, allocation.Spec{
+		Revision: allocation.SpecRevision,
+	}, allocation.DefaultSystemPaths()))
+	assert.Equal(t, allocation.DropIn{
+		Transition: manifest.Transition{
+			Update: "restart",
+		},
+		SystemPaths: allocation.DefaultSystemPaths(),
+		Unit:        "docker.service",
+		Path:        "testdata/dropin.conf",
+		Source:      "[Service]\nEnvironment=A=1\n",
+	}, d)
+	parent := d.UnitFile()
+	assert.Equal(t, "docker.service", parent.UnitName())
+}
@@ -15,6 +15,9 @@ type Header struct {
 	PodMark   uint64
 	AgentMark uint64
 	Namespace string
+	Rollback  bool     `json:",omitempty" hash:"ignore"`
+	DependsOn []string `json:",omitempty"`               // Names of pods which should be deployed before
+	Slots     int      `json:",omitempty" hash:"ignore"` // Slots held by node for counted pod
 }
 
 func (h *Header) Mark() (res uint64) {
@@ -1,13 +1,70 @@
 package allocation
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
 type SystemPaths struct {
 	Local   string
 	Runtime string
+	State   string // Agent state directory for runtime meta and fetched BLOBs
 }
 
 func DefaultSystemPaths() SystemPaths {
 	return SystemPaths{
 		Local:   dirSystemDLocal,
 		Runtime: dirSystemDRuntime,
+		State:   dirState,
+	}
+}
+
+// UserSystemPaths returns paths of SystemD user instance
+func UserSystemPaths() (paths SystemPaths, err error) {
+	configDir, err := userDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return
+	}
+	stateDir, err := userStateDir()
+	if err != nil {
+		return
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		err = fmt.Errorf("XDG_RUNTIME_DIR is not set")
+		return
+	}
+	paths = SystemPaths{
+		Local:   filepath.Join(configDir, "systemd", "user"),
+		Runtime: filepath.Join(runtimeDir, "systemd", "user"),
+		State:   filepath.Join(stateDir, "soil"),
+	}
+	return
+}
+
+// userDir returns value of given XDG environment variable or path relative
+// to $HOME if variable is not set
+func userDir(env string, fallback ...string) (res string, err error) {
+	if res = os.Getenv(env); res != "" {
+		return
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		err = fmt.Errorf("neither %s nor HOME is set", env)
+		return
+	}
+	res = filepath.Join(append([]string{home}, fallback...)...)
+	return
+}
+
+// userStateDir returns $XDG_STATE_HOME or ~/.local/share. State is kept out
+// of cache directory because it holds runtime meta which should survive cache
+// cleanup.
+func userStateDir() (res string, err error) {
+	if res = os.Getenv("XDG_STATE_HOME"); res != "" {
+		return
 	}
+	res, err = userDir("XDG_DATA_HOME", ".local", "share")
+	return
 }
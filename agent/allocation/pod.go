@@ -2,9 +2,13 @@ package allocation
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/akaspin/soil/manifest"
 	"github.com/mitchellh/hashstructure"
+	"io/ioutil"
+	"strconv"
 	"strings"
 )
 
@@ -13,13 +17,14 @@ const (
 [Unit]
 Description=${pod.name}
 Before=${pod.units}
-[Service]
+${pod.dependencies}[Service]
 ${system.pod_exec}
 [Install]
 WantedBy=${pod.target}
 `
 	dirSystemDLocal   = "/etc/systemd/system"
 	dirSystemDRuntime = "/run/systemd/system"
+	dirState          = "/var/lib/soil"
 )
 
 // Allocations state
@@ -52,17 +57,32 @@ type Pod struct {
 	UnitFile
 	Units     UnitSlice
 	Blobs     BlobSlice
+	DropIns   DropInSlice
 	Resources ResourceSlice
 	Providers ProviderSlice
+
+	// Namespaces of pods deployed on agent by name. Used by FromManifest to
+	// resolve units of dependencies.
+	Deployed map[string]string
 }
 
 func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
+	dependencies := podDependencies(m, p.Deployed)
 	agentMark, _ := hashstructure.Hash(env, nil)
+	if dependencies != "" {
+		// resolved dependencies are part of pod unit
+		agentMark, _ = hashstructure.Hash([]interface{}{env, dependencies}, nil)
+	}
 	p.Header = Header{
 		Name:      m.Name,
 		PodMark:   m.Mark(),
 		AgentMark: agentMark,
 		Namespace: m.Namespace,
+		Rollback:  m.Rollback,
+		DependsOn: m.DependsOn,
+	}
+	if m.IsCounted() {
+		p.Header.Slots, _ = strconv.Atoi(env[fmt.Sprintf("counter.%s.slots", m.Name)])
 	}
 	e := manifest.FlatMap{
 		"pod.name":      m.Name,
@@ -85,13 +105,49 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 		ab := &Blob{
 			Name:        manifest.Interpolate(b.Name, baseEnv),
 			Permissions: b.Permissions,
+			Owner:       b.Owner,
+			Group:       b.Group,
+			DirMode:     b.DirMode,
+			Backup:      b.Backup,
 			Leave:       b.Leave,
-			Source:      e.Interpolate(b.Source),
+			SourceURL:   e.Interpolate(b.SourceURL),
+			SHA256:      b.SHA256,
+			Archive:     b.Archive,
+			SystemPaths: p.SystemPaths,
+		}
+		switch {
+		case b.SourceFile != "" && b.Archive != "":
+			ab.SourceFile = e.Interpolate(b.SourceFile)
+			if ab.SHA256, err = fileSHA256(ab.SourceFile); err != nil {
+				return
+			}
+			if err = checkSHA256(ab.Name, ab.SourceFile, b.SHA256, ab.SHA256); err != nil {
+				return
+			}
+		case b.SourceFile != "":
+			sourceFile := e.Interpolate(b.SourceFile)
+			var src []byte
+			if src, err = ioutil.ReadFile(sourceFile); err != nil {
+				return
+			}
+			if b.SHA256 != "" {
+				sum := sha256.Sum256(src)
+				if err = checkSHA256(ab.Name, sourceFile, b.SHA256, hex.EncodeToString(sum[:])); err != nil {
+					return
+				}
+			}
+			ab.Source = string(src)
+		default:
+			ab.Source = e.Interpolate(b.Source)
 		}
 		p.Blobs = append(p.Blobs, ab)
-		fileHash, _ := hashstructure.Hash(ab.Source, nil)
+		fileHash := ab.SHA256
+		if fileHash == "" {
+			sourceHash, _ := hashstructure.Hash(ab.Source, nil)
+			fileHash = fmt.Sprintf("%d", sourceHash)
+		}
 		fileHashes1[fmt.Sprintf(
-			"blob.%s", strings.Replace(strings.Trim(ab.Name, "/"), "/", "-", -1))] = fmt.Sprintf("%d", fileHash)
+			"blob.%s", strings.Replace(strings.Trim(ab.Name, "/"), "/", "-", -1))] = fileHash
 	}
 	e = e.Merge(fileHashes1)
 
@@ -104,10 +160,30 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 			UnitFile:   NewUnitFile(unitName, p.SystemPaths, m.Runtime),
 		}
 		pu.Source = e.Interpolate(u.Source)
+		if u.Health != nil {
+			pu.Health = &manifest.Health{
+				Timeout: u.Health.Timeout,
+				Exec:    e.Interpolate(u.Health.Exec),
+				TCP:     e.Interpolate(u.Health.TCP),
+				HTTP:    e.Interpolate(u.Health.HTTP),
+			}
+			if u.Health.Exec != "" && strings.TrimSpace(pu.Health.Exec) == "" {
+				err = fmt.Errorf(`unit "%s": health exec "%s" is empty after interpolation`, unitName, u.Health.Exec)
+				return
+			}
+		}
 		p.Units = append(p.Units, pu)
 		unitNames = append(unitNames, unitName)
 	}
 
+	// Drop-ins
+	for _, d := range m.DropIns {
+		pd := NewDropIn(manifest.Interpolate(d.Unit, baseEnv), manifest.Interpolate(d.Name, baseEnv), p.SystemPaths, m.Runtime)
+		pd.Transition = d.Transition
+		pd.Source = e.Interpolate(d.Source)
+		p.DropIns = append(p.DropIns, pd)
+	}
+
 	p.Resources.FromManifest(*m, env)
 	p.Providers.FromManifest(*m, env)
 
@@ -132,6 +208,11 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 			return
 		}
 	}
+	for _, a := range p.DropIns {
+		if err = a.MarshalSpec(&buf); err != nil {
+			return
+		}
+	}
 	for _, a := range p.Providers {
 		if err = a.MarshalSpec(&buf); err != nil {
 			return
@@ -147,7 +228,8 @@ func (p *Pod) FromManifest(m *manifest.Pod, env map[string]string) (err error) {
 		baseEnv,
 		baseSourceEnv,
 		map[string]string{
-			"pod.units": strings.Join(unitNames, " "),
+			"pod.units":        strings.Join(unitNames, " "),
+			"pod.dependencies": dependencies,
 		},
 		env)); err != nil {
 		return
@@ -174,6 +256,9 @@ func (p *Pod) FromFilesystem(path string) (err error) {
 	if err = spec.UnmarshalAssetSlice(p.SystemPaths, &p.Blobs, p.UnitFile.Source); err != nil {
 		return
 	}
+	if err = spec.UnmarshalAssetSlice(p.SystemPaths, &p.DropIns, p.UnitFile.Source); err != nil {
+		return
+	}
 	if err = spec.UnmarshalAssetSlice(p.SystemPaths, &p.Resources, p.UnitFile.Source); err != nil {
 		return
 	}
@@ -193,3 +278,35 @@ func (p *Pod) GetPodUnit() (res *Unit) {
 	}
 	return
 }
+
+// podDependencies returns "After=", "Requires=" and "Wants=" lines with
+// units of pods which given pod depends on. Deployed dependencies are
+// required. Units of dependencies which are not deployed are guessed from
+// pod namespace and only wanted because they may not exist.
+func podDependencies(m *manifest.Pod, deployed map[string]string) (res string) {
+	if len(m.DependsOn) == 0 {
+		return
+	}
+	var units, required, wanted []string
+	for _, dependency := range m.DependsOn {
+		namespace, ok := deployed[dependency]
+		if !ok {
+			namespace = m.Namespace
+		}
+		unit := fmt.Sprintf("pod-%s-%s.service", namespace, dependency)
+		units = append(units, unit)
+		if ok {
+			required = append(required, unit)
+			continue
+		}
+		wanted = append(wanted, unit)
+	}
+	res = fmt.Sprintf("After=%s\n", strings.Join(units, " "))
+	if len(required) > 0 {
+		res += fmt.Sprintf("Requires=%s\n", strings.Join(required, " "))
+	}
+	if len(wanted) > 0 {
+		res += fmt.Sprintf("Wants=%s\n", strings.Join(wanted, " "))
+	}
+	return
+}
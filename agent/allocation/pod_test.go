@@ -3,9 +3,13 @@
 package allocation_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/manifest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -114,3 +118,168 @@ WantedBy=multi-user.target
 	},
 		alloc)
 }
+
+func TestPod_FromManifest_DependsOn(t *testing.T) {
+	pod := &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: allocation.DefaultSystemPaths(),
+		},
+	}
+	assert.NoError(t, pod.FromManifest(&manifest.Pod{
+		Namespace: manifest.PrivateNamespace,
+		Name:      "app",
+		Target:    "multi-user.target",
+		DependsOn: []string{"db", "cache"},
+	}, map[string]string{
+		"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+	}))
+	assert.Equal(t, []string{"db", "cache"}, pod.DependsOn)
+	assert.Contains(t, pod.Source, "\n[Unit]\nDescription=app\nBefore=\n"+
+		"After=pod-private-db.service pod-private-cache.service\n"+
+		"Wants=pod-private-db.service pod-private-cache.service\n"+
+		"[Service]\n")
+
+	t.Run(`deployed`, func(t *testing.T) {
+		deployed := &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: allocation.DefaultSystemPaths(),
+			},
+			Deployed: map[string]string{
+				"db": manifest.PublicNamespace,
+			},
+		}
+		assert.NoError(t, deployed.FromManifest(&manifest.Pod{
+			Namespace: manifest.PrivateNamespace,
+			Name:      "app",
+			Target:    "multi-user.target",
+			DependsOn: []string{"db", "cache"},
+		}, map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		}))
+		assert.Contains(t, deployed.Source, "\n[Unit]\nDescription=app\nBefore=\n"+
+			"After=pod-public-db.service pod-private-cache.service\n"+
+			"Requires=pod-public-db.service\n"+
+			"Wants=pod-private-cache.service\n"+
+			"[Service]\n")
+		assert.NotEqual(t, pod.AgentMark, deployed.AgentMark)
+	})
+
+	var recovered allocation.Pod
+	recovered.SystemPaths = allocation.DefaultSystemPaths()
+	assert.NoError(t, recovered.Header.UnmarshalSpec(pod.Source, allocation.Spec{Revision: allocation.SpecRevision}, recovered.SystemPaths))
+	assert.Equal(t, []string{"db", "cache"}, recovered.DependsOn)
+}
+
+func TestPod_FromManifest_BlobSources(t *testing.T) {
+	pod := &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: allocation.DefaultSystemPaths(),
+		},
+	}
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	assert.NoError(t, pod.FromManifest(&manifest.Pod{
+		Namespace: manifest.PrivateNamespace,
+		Name:      "app",
+		Target:    "multi-user.target",
+		Units: manifest.Units{
+			{
+				Name:   "app.service",
+				Source: "# ${blob.etc-file} ${blob.etc-url} ${blob.opt-archive}",
+			},
+		},
+		Blobs: manifest.Blobs{
+			{
+				Name:       "/etc/file",
+				SourceFile: "testdata/blob.txt",
+			},
+			{
+				Name:      "/etc/url",
+				SourceURL: "http://${meta.host}/hello",
+				SHA256:    sum,
+			},
+			{
+				Name:       "/opt/archive",
+				SourceFile: "testdata/blob.tar",
+				Archive:    "tar",
+			},
+		},
+	}, map[string]string{
+		"meta.host":       "example.com",
+		"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+	}))
+	assert.Len(t, pod.Blobs, 3)
+	assert.Equal(t, "a\nb\n123\n", pod.Blobs[0].Source)
+	assert.Equal(t, "http://example.com/hello", pod.Blobs[1].SourceURL)
+	assert.Equal(t, "", pod.Blobs[1].Source)
+	assert.Equal(t, "testdata/blob.tar", pod.Blobs[2].SourceFile)
+	assert.Len(t, pod.Blobs[2].SHA256, 64)
+	assert.Equal(t, "# 5070855236751697734 "+sum+" "+pod.Blobs[2].SHA256, pod.Units[0].Source)
+
+	t.Run(`source file checksum`, func(t *testing.T) {
+		for _, archive := range []string{"", "tar"} {
+			blob := manifest.Blob{
+				Name:       "/etc/file",
+				SourceFile: "testdata/blob.txt",
+				SHA256:     sum,
+			}
+			if archive != "" {
+				blob.SourceFile = "testdata/blob.tar"
+				blob.Archive = archive
+			}
+			err := (&allocation.Pod{}).FromManifest(&manifest.Pod{
+				Name:  "app",
+				Blobs: manifest.Blobs{blob},
+			}, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "checksum mismatch")
+		}
+		valid := sha256.Sum256([]byte("a\nb\n123\n"))
+		assert.NoError(t, (&allocation.Pod{}).FromManifest(&manifest.Pod{
+			Name: "app",
+			Blobs: manifest.Blobs{
+				{
+					Name:       "/etc/file",
+					SourceFile: "testdata/blob.txt",
+					SHA256:     hex.EncodeToString(valid[:]),
+				},
+			},
+		}, nil))
+	})
+	t.Run(`source file checksum from manifest`, func(t *testing.T) {
+		valid := sha256.Sum256([]byte("a\nb\n123\n"))
+		for checksum, ok := range map[string]bool{
+			hex.EncodeToString(valid[:]): true,
+			sum:                          false,
+		} {
+			var pods manifest.PodSlice
+			require.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(`
+pod "app" {
+  blob "/etc/file" {
+    source_file = "testdata/blob.txt"
+    sha256 = "`+checksum+`"
+  }
+}
+`)))
+			var alloc allocation.Pod
+			err := alloc.FromManifest(pods[0], nil)
+			if ok {
+				require.NoError(t, err)
+				assert.Equal(t, "a\nb\n123\n", alloc.Blobs[0].Source)
+				continue
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "checksum mismatch")
+		}
+	})
+	t.Run(`missing source file`, func(t *testing.T) {
+		assert.Error(t, (&allocation.Pod{}).FromManifest(&manifest.Pod{
+			Name: "app",
+			Blobs: manifest.Blobs{
+				{
+					Name:       "/etc/file",
+					SourceFile: "testdata/non-existent",
+				},
+			},
+		}, nil))
+	})
+}
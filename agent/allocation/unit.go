@@ -38,6 +38,7 @@ func (s *UnitSlice) AppendItem(v Asset) {
 type Unit struct {
 	UnitFile
 	manifest.Transition `json:",squash"`
+	Health              *manifest.Health `json:",omitempty"`
 }
 
 func (u *Unit) MarshalSpec(w io.Writer) (err error) {
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"github.com/akaspin/soil/agent/api/api-server"
 	"github.com/akaspin/soil/proto"
 	"net/http"
+	"net/url"
 	"os"
 	"syscall"
 )
@@ -43,3 +46,53 @@ func NewAgentDrainDelete(fn func(on bool)) (e *api_server.Endpoint) {
 	}))
 	return
 }
+
+func NewAgentMetaPut(fn func(values map[string]string) error) (e *api_server.Endpoint) {
+	return api_server.PUT(proto.V1AgentMeta, &agentMetaPutProcessor{
+		fn: fn,
+	})
+}
+
+type agentMetaPutProcessor struct {
+	fn func(values map[string]string) error
+}
+
+func (p *agentMetaPutProcessor) Empty() interface{} {
+	return &map[string]string{}
+}
+
+func (p *agentMetaPutProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	values, ok := v.(*map[string]string)
+	if !ok || values == nil || len(*values) == 0 {
+		err = api_server.NewError(http.StatusBadRequest, fmt.Sprintf("bad meta: %v", v))
+		return
+	}
+	if err = p.fn(*values); err != nil {
+		err = api_server.NewError(http.StatusBadRequest, err.Error())
+	}
+	return
+}
+
+func NewAgentMetaDelete(fn func(keys ...string) error) (e *api_server.Endpoint) {
+	return api_server.DELETE(proto.V1AgentMeta, &agentMetaDeleteProcessor{
+		fn: fn,
+	})
+}
+
+type agentMetaDeleteProcessor struct {
+	fn func(keys ...string) error
+}
+
+func (p *agentMetaDeleteProcessor) Empty() interface{} {
+	return &[]string{}
+}
+
+func (p *agentMetaDeleteProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	keys, ok := v.(*[]string)
+	if !ok || keys == nil || len(*keys) == 0 {
+		err = api_server.NewError(http.StatusBadRequest, fmt.Sprintf("bad meta keys: %v", v))
+		return
+	}
+	err = p.fn(*keys...)
+	return
+}
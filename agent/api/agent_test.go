@@ -0,0 +1,67 @@
+// +build ide test_unit
+
+package api_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/api"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAgentMeta(t *testing.T) {
+	var set map[string]string
+	var deleted []string
+	router := api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{},
+		api.NewAgentMetaPut(func(values map[string]string) (err error) {
+			if _, ok := values[""]; ok {
+				err = errors.New("empty meta key")
+				return
+			}
+			set = values
+			return
+		}),
+		api.NewAgentMetaDelete(func(keys ...string) (err error) {
+			deleted = keys
+			return
+		}),
+	)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, body string) (code int) {
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/agent/meta", srv.URL), strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		code = resp.StatusCode
+		return
+	}
+
+	t.Run(`put empty`, func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, `{}`))
+	})
+	t.Run(`put bad key`, func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, `{"": "1"}`))
+	})
+	t.Run(`put`, func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, `{"rack": "rack-1"}`))
+		assert.Equal(t, map[string]string{"rack": "rack-1"}, set)
+	})
+	t.Run(`delete empty`, func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, `[]`))
+	})
+	t.Run(`delete`, func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, `["rack", "zone"]`))
+		assert.Equal(t, []string{"rack", "zone"}, deleted)
+	})
+}
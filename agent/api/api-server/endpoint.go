@@ -5,9 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/akaspin/logx"
+	"io"
 	"net/http"
 )
 
+// RawResponse can be returned by Processor to write response as is instead
+// of JSON. Each write is flushed to client immediately.
+type RawResponse interface {
+	io.WriterTo
+
+	// ContentType returns value for "Content-Type" header
+	ContentType() string
+}
+
 type Endpoint struct {
 	path      string
 	method    string
@@ -26,6 +36,12 @@ func PUT(path string, processor Processor) (r *Endpoint) {
 	return
 }
 
+// Returns POST route
+func POST(path string, processor Processor) (r *Endpoint) {
+	r = NewEndpoint(http.MethodPost, path, processor)
+	return
+}
+
 // Returns DELETE route
 func DELETE(path string, processor Processor) (r *Endpoint) {
 	r = NewEndpoint(http.MethodDelete, path, processor)
@@ -71,6 +87,19 @@ func (e *Endpoint) getHandleFunc(log *logx.Log) (h func(w http.ResponseWriter, r
 			sendCode(log, w, req, err)
 			return
 		}
+		if rawResponse, ok := data.(RawResponse); ok {
+			w.Header().Set("Content-Type", rawResponse.ContentType())
+			w.WriteHeader(http.StatusOK)
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			if _, err = rawResponse.WriteTo(&flushWriter{w}); err != nil {
+				log.Errorf(`write %s %s: %v`, req.Method, req.URL.String(), err)
+				return
+			}
+			log.Debugf(`ok %s %s`, req.Method, req.URL.String())
+			return
+		}
 		var raw []byte
 		if raw, err = json.Marshal(&data); err != nil {
 			sendCode(log, w, req, NewError(http.StatusInternalServerError, "can't marshal response"))
@@ -89,3 +118,18 @@ func (e *Endpoint) getHandleFunc(log *logx.Log) (h func(w http.ResponseWriter, r
 	}
 	return
 }
+
+// flushWriter flushes each write to client
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (w *flushWriter) Write(p []byte) (n int, err error) {
+	if n, err = w.w.Write(p); err != nil {
+		return
+	}
+	if flusher, ok := w.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return
+}
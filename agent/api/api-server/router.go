@@ -4,20 +4,26 @@ import (
 	"fmt"
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/proto"
 	"net/http"
 	"net/http/httputil"
 	"sync"
+	"time"
 )
 
 const (
 	defaultHttpScheme  = "http"
 	queryParamNode     = "node"
 	queryParamRedirect = "redirect"
+
+	// flush interval for proxied streaming responses
+	proxyFlushInterval = time.Millisecond * 100
 )
 
 type Router struct {
 	log       *logx.Log
+	reporter  metrics.Reporter
 	endpoints []*Endpoint
 	mux       *http.ServeMux
 
@@ -25,9 +31,10 @@ type Router struct {
 	nodes   map[string]string
 }
 
-func NewRouter(log *logx.Log, endpoints ...*Endpoint) (r *Router) {
+func NewRouter(log *logx.Log, reporter metrics.Reporter, endpoints ...*Endpoint) (r *Router) {
 	r = &Router{
 		log:       log.GetLog("api", "router"),
+		reporter:  reporter,
 		endpoints: endpoints,
 		mux:       http.NewServeMux(),
 		nodesMu:   &sync.RWMutex{},
@@ -57,6 +64,11 @@ func (r *Router) GetEndpoint(method, path string) (e *Endpoint, err error) {
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.log.Debugf("accepted %s %s", req.Method, req.URL)
+	start := time.Now()
+	defer func() {
+		r.reporter.Count("api_requests_total", 1, "method:"+req.Method)
+		r.reporter.Timing("api_request_duration_seconds", time.Since(start), "method:"+req.Method)
+	}()
 
 	nodeId := req.FormValue(queryParamNode)
 	switch nodeId {
@@ -94,6 +106,7 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		// proxy if can't redirect
 		r.log.Debugf("proxying %s %s to %s (%s)", req.Method, req.URL, nodeId, nodeAddr)
 		proxy := httputil.NewSingleHostReverseProxy(targetUrl)
+		proxy.FlushInterval = proxyFlushInterval
 		proxy.ServeHTTP(w, req)
 	}
 }
@@ -121,6 +134,7 @@ func (r *Router) ConsumeMessage(message bus.Message) (err error) {
 func (r *Router) newHandler(endpoints []*Endpoint) (fn func(w http.ResponseWriter, req *http.Request)) {
 	get := r.notAllowedHandlerFunc
 	put := r.notAllowedHandlerFunc
+	post := r.notAllowedHandlerFunc
 	del := r.notAllowedHandlerFunc
 	for _, endpoint := range endpoints {
 		switch endpoint.method {
@@ -128,6 +142,8 @@ func (r *Router) newHandler(endpoints []*Endpoint) (fn func(w http.ResponseWrite
 			get = endpoint.getHandleFunc(r.log)
 		case http.MethodPut:
 			put = endpoint.getHandleFunc(r.log)
+		case http.MethodPost:
+			post = endpoint.getHandleFunc(r.log)
 		case http.MethodDelete:
 			del = endpoint.getHandleFunc(r.log)
 		}
@@ -138,6 +154,8 @@ func (r *Router) newHandler(endpoints []*Endpoint) (fn func(w http.ResponseWrite
 			get(w, req)
 		case http.MethodPut:
 			put(w, req)
+		case http.MethodPost:
+			post(w, req)
 		case http.MethodDelete:
 			del(w, req)
 		default:
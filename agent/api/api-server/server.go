@@ -5,8 +5,13 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/akaspin/supervisor"
 	"net/http"
+	"time"
 )
 
+// shutdownTimeout limits graceful shutdown. Connections which are not idle
+// after timeout are closed.
+const shutdownTimeout = time.Second * 5
+
 type Server struct {
 	*supervisor.Control
 	log    *logx.Log
@@ -17,17 +22,24 @@ func NewServer(ctx context.Context, log *logx.Log, addr string, router *Router)
 	s = &Server{
 		Control: supervisor.NewControl(ctx),
 		log:     log.GetLog("api", "server"),
-		server: &http.Server{
-			Addr:    addr,
-			Handler: router,
-		},
+	}
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: s.withServerContext(router),
 	}
 	return
 }
 
+// Close cancels all in-flight requests including streams and shuts down
+// HTTP server
 func (s *Server) Close() (err error) {
-	s.server.Shutdown(s.Ctx())
 	err = s.Control.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := s.server.Shutdown(ctx); shutdownErr != nil {
+		s.log.Warningf("shutdown: %v", shutdownErr)
+		s.server.Close()
+	}
 	s.log.Info("closed")
 	return
 }
@@ -44,3 +56,19 @@ func (s *Server) Open() (err error) {
 	s.log.Infof("listening on %s", s.server.Addr)
 	return
 }
+
+// withServerContext cancels request context when server is closed
+func (s *Server) withServerContext(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-s.Control.Ctx().Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		handler.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/akaspin/soil/agent/api/api-server"
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/agent/bus/pipe"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/fixture"
 	"github.com/akaspin/soil/proto"
 	"github.com/stretchr/testify/assert"
@@ -41,7 +42,7 @@ func (r *jsonEndpoint) Process(ctx context.Context, u *url.URL, v interface{}) (
 func TestNewServer(t *testing.T) {
 	log := logx.GetLog("test")
 	addr := fmt.Sprintf(":%d", fixture.RandomPort(t))
-	server := api_server.NewServer(context.Background(), log, addr, api_server.NewRouter(log,
+	server := api_server.NewServer(context.Background(), log, addr, api_server.NewRouter(log, &metrics.BlackHole{},
 		api_server.NewEndpoint(http.MethodGet, "/v1/route/", &jsonEndpoint{}),
 	))
 	assert.NoError(t, server.Open())
@@ -59,10 +60,10 @@ func TestNewServer(t *testing.T) {
 func TestRouter_ConsumeMessage(t *testing.T) {
 	log := logx.GetLog("test")
 
-	router1 := api_server.NewRouter(log,
+	router1 := api_server.NewRouter(log, &metrics.BlackHole{},
 		api_server.GET("/v1/route", &jsonEndpoint{"node-1"}),
 	)
-	router2 := api_server.NewRouter(log,
+	router2 := api_server.NewRouter(log, &metrics.BlackHole{},
 		api_server.GET("/v1/route", &jsonEndpoint{"node-2"}),
 	)
 	nodesProducer := pipe.NewTee(router1, router2)
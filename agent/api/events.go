@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/proto"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	eventsFormatSSE    = "sse"
+	eventsFormatNDJSON = "ndjson"
+
+	eventsBufferSize = 64
+)
+
+var eventsTopics = []string{"provision", "resource", "registry", "nodes"}
+
+func NewEventsGet(log *logx.Log) (e *api_server.Endpoint) {
+	return api_server.GET(proto.V1Events, &EventsProcessor{
+		log:         log.GetLog("api", "get", proto.V1Events),
+		last:        map[string]proto.Event{},
+		subscribers: map[*eventsStream]struct{}{},
+	})
+}
+
+// EventsProcessor streams consumed messages to subscribers. On subscribe
+// stream starts with last known event for each requested topic.
+type EventsProcessor struct {
+	log         *logx.Log
+	mu          sync.Mutex
+	last        map[string]proto.Event
+	subscribers map[*eventsStream]struct{}
+}
+
+// Consumer returns consumer which publishes all consumed messages under
+// given topic
+func (p *EventsProcessor) Consumer(topic string) bus.Consumer {
+	return &eventsConsumer{
+		processor: p,
+		topic:     topic,
+	}
+}
+
+func (p *EventsProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *EventsProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	topics := map[string]struct{}{}
+	if raw := u.Query().Get("topics"); raw != "" {
+		for _, topic := range strings.Split(raw, ",") {
+			topics[strings.TrimSpace(topic)] = struct{}{}
+		}
+	} else {
+		for _, topic := range eventsTopics {
+			topics[topic] = struct{}{}
+		}
+	}
+	for topic := range topics {
+		if !isEventsTopic(topic) {
+			err = api_server.NewError(http.StatusBadRequest, fmt.Sprintf("unknown topic %s", topic))
+			return
+		}
+	}
+	format := u.Query().Get("format")
+	switch format {
+	case "":
+		format = eventsFormatNDJSON
+	case eventsFormatSSE, eventsFormatNDJSON:
+	default:
+		err = api_server.NewError(http.StatusBadRequest, fmt.Sprintf("unknown format %s", format))
+		return
+	}
+	stream := &eventsStream{
+		ctx:    ctx,
+		format: format,
+		topics: topics,
+		events: make(chan proto.Event, eventsBufferSize),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, topic := range eventsTopics {
+		if event, ok := p.last[topic]; ok {
+			stream.send(p.log, event)
+		}
+	}
+	p.subscribers[stream] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subscribers, stream)
+		p.log.Debugf(`unsubscribed: %v`, ctx.Err())
+	}()
+	res = stream
+	return
+}
+
+func (p *EventsProcessor) publish(event proto.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last[event.Topic] = event
+	for stream := range p.subscribers {
+		stream.send(p.log, event)
+	}
+}
+
+type eventsConsumer struct {
+	processor *EventsProcessor
+	topic     string
+}
+
+func (c *eventsConsumer) ConsumeMessage(message bus.Message) (err error) {
+	event := proto.Event{
+		Topic:   c.topic,
+		Payload: json.RawMessage("null"),
+	}
+	if !message.Payload().IsEmpty() {
+		if err = message.Payload().Unmarshal(&event.Payload); err != nil {
+			c.processor.log.Error(err)
+			return
+		}
+	}
+	c.processor.publish(event)
+	return
+}
+
+// eventsStream writes events to client until request is done
+type eventsStream struct {
+	ctx    context.Context
+	format string
+	topics map[string]struct{}
+	events chan proto.Event
+}
+
+func (s *eventsStream) ContentType() string {
+	if s.format == eventsFormatSSE {
+		return "text/event-stream"
+	}
+	return "application/x-ndjson"
+}
+
+func (s *eventsStream) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case event := <-s.events:
+			var raw []byte
+			if raw, err = json.Marshal(event); err != nil {
+				return
+			}
+			var written int
+			if s.format == eventsFormatSSE {
+				written, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Topic, raw)
+			} else {
+				written, err = fmt.Fprintf(w, "%s\n", raw)
+			}
+			n += int64(written)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send queues event without blocking. Events are dropped for slow clients.
+func (s *eventsStream) send(log *logx.Log, event proto.Event) {
+	if _, ok := s.topics[event.Topic]; !ok {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		log.Warningf(`event dropped for slow client: %s`, event.Topic)
+	}
+}
+
+func isEventsTopic(topic string) (ok bool) {
+	for _, known := range eventsTopics {
+		if topic == known {
+			ok = true
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+// +build ide test_unit
+
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/api"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/fixture"
+	"github.com/akaspin/soil/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventsProcessor(t *testing.T) {
+	endpoint := api.NewEventsGet(logx.GetLog("test"))
+	events := endpoint.Processor().(*api.EventsProcessor)
+	router := api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{}, endpoint)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	events.Consumer("registry").ConsumeMessage(bus.NewMessage("registry", []string{"pod-1"}))
+
+	t.Run(`bad topic`, func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/v1/events?topics=unknown", srv.URL))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run(`ndjson`, func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/v1/events?topics=registry,provision", srv.URL))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(resp.Body)
+
+		// last known
+		require.True(t, scanner.Scan())
+		var event proto.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.Equal(t, "registry", event.Topic)
+		assert.JSONEq(t, `["pod-1"]`, string(event.Payload))
+
+		// not subscribed
+		events.Consumer("nodes").ConsumeMessage(bus.NewMessage("nodes", []string{"node-1"}))
+		events.Consumer("provision").ConsumeMessage(bus.NewMessage("provision", map[string]string{"pod-1.state": "done"}))
+		require.True(t, scanner.Scan())
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.Equal(t, "provision", event.Topic)
+		assert.JSONEq(t, `{"pod-1.state":"done"}`, string(event.Payload))
+	})
+	t.Run(`sse`, func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/v1/events?topics=nodes&format=sse", srv.URL))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(resp.Body)
+		var lines []string
+		for i := 0; i < 3 && scanner.Scan(); i++ {
+			lines = append(lines, scanner.Text())
+		}
+		assert.Equal(t, []string{
+			"event: nodes",
+			`data: {"Topic":"nodes","Payload":["node-1"]}`,
+			"",
+		}, lines)
+	})
+}
+
+func TestEventsProcessor_ServerClose(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", fixture.RandomPort(t))
+	server := api_server.NewServer(context.Background(), logx.GetLog("test"), addr,
+		api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{}, api.NewEventsGet(logx.GetLog("test"))))
+	require.NoError(t, server.Open())
+	fixture.WaitNoErrorT10(t, func() (err error) {
+		_, err = http.Get(fmt.Sprintf("http://%s/v1/status/ping", addr))
+		return
+	})
+
+	// stream is opened before first event
+	resp, err := http.Get(fmt.Sprintf("http://%s/v1/events", addr))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	closed := make(chan struct{})
+	go func() {
+		server.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Error("server is not closed")
+	}
+}
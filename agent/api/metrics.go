@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/proto"
+	"net/url"
+)
+
+func NewMetricsGet(reporter *metrics.Prometheus) (e *api_server.Endpoint) {
+	return api_server.GET(proto.V1Metrics, &metricsProcessor{
+		reporter: reporter,
+	})
+}
+
+type metricsProcessor struct {
+	reporter *metrics.Prometheus
+}
+
+func (p *metricsProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *metricsProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res = p.reporter
+	return
+}
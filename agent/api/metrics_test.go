@@ -0,0 +1,34 @@
+// +build ide test_unit
+
+package api_test
+
+import (
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/api"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewMetricsGet(t *testing.T) {
+	reporter := metrics.NewPrometheus("soil")
+	router := api_server.NewRouter(logx.GetLog("test"), reporter, api.NewMetricsGet(reporter))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	reporter.Count("test_total", 1)
+	resp, err := http.Get(fmt.Sprintf("%s/v1/metrics", srv.URL))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, metrics.PrometheusContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# TYPE soil_test_total counter\nsoil_test_total 1\n", string(body))
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+	"net/url"
+)
+
+// NewPlanPost returns endpoint which evaluates given pods against agent state
+// without allocation. Pods without namespace are planned in "public"
+// namespace.
+func NewPlanPost(fn func(pods manifest.PodSlice) (res []proto.PodPlan, err error)) (e *api_server.Endpoint) {
+	return api_server.POST(proto.V1Plan, &planPostProcessor{
+		fn: fn,
+	})
+}
+
+type planPostProcessor struct {
+	fn func(pods manifest.PodSlice) (res []proto.PodPlan, err error)
+}
+
+func (p *planPostProcessor) Empty() interface{} {
+	return &manifest.PodSlice{}
+}
+
+func (p *planPostProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	pods, ok := v.(*manifest.PodSlice)
+	if !ok || pods == nil || len(*pods) == 0 {
+		err = api_server.NewError(http.StatusBadRequest, fmt.Sprintf("bad pods: %v", v))
+		return
+	}
+	for _, pod := range *pods {
+		if pod.Namespace == "" {
+			pod.Namespace = manifest.PublicNamespace
+		}
+	}
+	res, err = p.fn(*pods)
+	return
+}
@@ -7,13 +7,14 @@ import (
 	"github.com/akaspin/soil/agent/api/api-server"
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
 	"net/http"
 	"net/url"
 	"sync"
 )
 
 const (
-	V1Registry = "/v1/registry"
+	V1Registry = proto.V1Registry
 )
 
 func NewRegistryPodsGet() (e *api_server.Endpoint) {
@@ -11,6 +11,7 @@ import (
 	"github.com/akaspin/soil/agent/api"
 	"github.com/akaspin/soil/agent/api/api-server"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/fixture"
 	"github.com/akaspin/soil/manifest"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +29,7 @@ func TestRegistryPodsPutProcessor_Process(t *testing.T) {
 
 	cons := bus.NewTestingConsumer(ctx)
 	endpoint := api.NewRegistryPodsPut(logx.GetLog("test"), cons)
-	router := api_server.NewRouter(logx.GetLog("test"), endpoint)
+	router := api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{}, endpoint)
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
@@ -78,7 +79,7 @@ func TestRegistryPodsDeleteProcessor_Process(t *testing.T) {
 
 	cons := bus.NewTestingConsumer(ctx)
 	endpoint := api.NewRegistryPodsDelete(logx.GetLog("test"), cons)
-	router := api_server.NewRouter(logx.GetLog("test"), endpoint)
+	router := api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{}, endpoint)
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
@@ -108,7 +109,7 @@ func TestRegistryPodsDeleteProcessor_Process(t *testing.T) {
 
 func TestRegistryPodsGetProcessor_Process(t *testing.T) {
 	endpoint := api.NewRegistryPodsGet()
-	router := api_server.NewRouter(logx.GetLog("test"), endpoint)
+	router := api_server.NewRouter(logx.GetLog("test"), &metrics.BlackHole{}, endpoint)
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/proto"
+	"net/url"
+)
+
+// NewStatusEnvGet returns endpoint which returns environment of each
+// arbiter on "/v1/status/env"
+func NewStatusEnvGet(fn func() (res map[string]map[string]string, err error)) (e *api_server.Endpoint) {
+	return api_server.GET(proto.V1StatusEnv, &statusEnvProcessor{
+		fn: fn,
+	})
+}
+
+type statusEnvProcessor struct {
+	fn func() (res map[string]map[string]string, err error)
+}
+
+func (p *statusEnvProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *statusEnvProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res, err = p.fn()
+	return
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/proto"
+	"net/url"
+)
+
+// NewStatusNodeGet returns endpoint which returns agent and meta info of
+// specific agent on "/v1/status/node"
+func NewStatusNodeGet(fn func() (res proto.NodeStatus, err error)) (e *api_server.Endpoint) {
+	return api_server.GET(proto.V1StatusNode, &statusNodeProcessor{
+		fn: fn,
+	})
+}
+
+type statusNodeProcessor struct {
+	fn func() (res proto.NodeStatus, err error)
+}
+
+func (p *statusNodeProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *statusNodeProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	res, err = p.fn()
+	return
+}
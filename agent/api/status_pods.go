@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewStatusPodsExplainGet returns endpoint which explains pod constraints
+// evaluation on "/v1/status/pods/<name>/explain"
+func NewStatusPodsExplainGet(fn func(name string) (res []proto.ConstraintExplain, err error)) (e *api_server.Endpoint) {
+	return api_server.GET(proto.V1StatusPods, &statusPodsExplainProcessor{
+		fn: fn,
+	})
+}
+
+type statusPodsExplainProcessor struct {
+	fn func(name string) (res []proto.ConstraintExplain, err error)
+}
+
+func (p *statusPodsExplainProcessor) Empty() interface{} {
+	return nil
+}
+
+func (p *statusPodsExplainProcessor) Process(ctx context.Context, u *url.URL, v interface{}) (res interface{}, err error) {
+	split := strings.Split(strings.TrimPrefix(u.Path, proto.V1StatusPods), "/")
+	if len(split) != 2 || split[0] == "" || split[1] != "explain" {
+		err = api_server.NewError(http.StatusNotFound, fmt.Sprintf("not found %s", u.Path))
+		return
+	}
+	res, err = p.fn(split[0])
+	return
+}
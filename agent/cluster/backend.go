@@ -13,14 +13,19 @@ import (
 const (
 	backendLocal  = "local"
 	backendConsul = "consul"
+	backendFile   = "file"
+	backendEtcd   = "etcd"
+	backendGossip = "gossip"
 )
 
 type BackendConfig struct {
-	Kind    string
-	ID      string
-	Address string
-	Chroot  string
-	TTL     time.Duration
+	Kind      string
+	ID        string
+	Address   string
+	Chroot    string
+	TTL       time.Duration
+	Advertise string   // Agent advertise address
+	Join      []string // Addresses to join from "join" URL parameters
 }
 
 type WatchRequest struct {
@@ -50,11 +55,12 @@ type BackendFactory func(ctx context.Context, log *logx.Log, config Config) (c B
 
 func DefaultBackendFactory(ctx context.Context, log *logx.Log, config Config) (c Backend, err error) {
 	kvConfig := BackendConfig{
-		Kind:    "local",
-		Chroot:  "soil",
-		ID:      config.NodeID,
-		Address: "localhost",
-		TTL:     config.TTL,
+		Kind:      "local",
+		Chroot:    "soil",
+		ID:        config.NodeID,
+		Address:   "localhost",
+		TTL:       config.TTL,
+		Advertise: config.Advertise,
 	}
 	u, err := url.Parse(config.BackendURL)
 	if err != nil {
@@ -64,6 +70,7 @@ func DefaultBackendFactory(ctx context.Context, log *logx.Log, config Config) (c
 		kvConfig.Kind = u.Scheme
 		kvConfig.Address = u.Host
 		kvConfig.Chroot = NormalizeKey(u.Path)
+		kvConfig.Join = u.Query()["join"]
 	}
 	kvLog := log.GetLog("cluster", "backend", config.BackendURL, config.NodeID)
 	if kvConfig.ID == "" {
@@ -73,6 +80,12 @@ func DefaultBackendFactory(ctx context.Context, log *logx.Log, config Config) (c
 	switch kvConfig.Kind {
 	case backendConsul:
 		c = NewConsulBackend(ctx, kvLog, kvConfig)
+	case backendEtcd:
+		c = NewEtcdBackend(ctx, kvLog, kvConfig)
+	case backendGossip:
+		c = NewGossipBackend(ctx, kvLog, kvConfig)
+	case backendFile:
+		c = NewFileBackend(ctx, kvLog, kvConfig)
 	default:
 		c = NewZeroBackend(ctx, kvLog)
 	}
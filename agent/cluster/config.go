@@ -18,6 +18,7 @@ type Config struct {
 	Advertise     string        `mapstructure:"advertise"`
 	TTL           time.Duration `mapstructure:"ttl"`
 	RetryInterval time.Duration `mapstructure:"retry"`
+	MetaFromKV    bool          `mapstructure:"meta_from_kv"` // Apply "meta/<node_id>" record from KV to agent meta
 }
 
 func DefaultConfig() (c Config) {
@@ -22,6 +22,7 @@ func TestConfig_Unmarshal(t *testing.T) {
 			Advertise:     "127.0.0.1:7654",
 			TTL:           time.Minute * 11,
 			RetryInterval: time.Second * 30,
+			MetaFromKV:    true,
 		}, config)
 	})
 }
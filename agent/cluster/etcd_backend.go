@@ -0,0 +1,447 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Etcd Backend works with etcd v3 over JSON gRPC gateway. Records with TTL
+// are attached to lease which is kept alive by backend.
+type EtcdBackend struct {
+	*baseBackend
+
+	client    *http.Client
+	apiPrefix string
+	leaseID   string
+
+	opsChan          chan []StoreOp
+	watchRequestChan chan []WatchRequest
+}
+
+func NewEtcdBackend(ctx context.Context, log *logx.Log, config BackendConfig) (b *EtcdBackend) {
+	b = &EtcdBackend{
+		baseBackend:      newBaseBackend(ctx, log, config),
+		client:           &http.Client{},
+		opsChan:          make(chan []StoreOp, 1),
+		watchRequestChan: make(chan []WatchRequest, 1),
+	}
+	go b.connect()
+	go b.loop()
+	return
+}
+
+func (b *EtcdBackend) Submit(ops []StoreOp) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, ops, b.ctx.Err())
+	case b.opsChan <- ops:
+		b.log.Tracef(`submit: %v`, ops)
+	}
+}
+
+func (b *EtcdBackend) Subscribe(req []WatchRequest) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, req, b.ctx.Err())
+	case b.watchRequestChan <- req:
+		b.log.Tracef(`subscribe: %v`, req)
+	}
+}
+
+func (b *EtcdBackend) loop() {
+	b.log.Debug(`open`)
+	select {
+	case <-b.ctx.Done():
+		b.log.Error(`backend prematurely closed`)
+		return
+	case <-b.readyCtx.Done():
+		b.log.Trace(`clean state reached`)
+	}
+
+LOOP:
+	for {
+		select {
+		case <-b.leaveChan:
+			break LOOP
+		case <-b.ctx.Done():
+			break LOOP
+		case ops := <-b.opsChan:
+			b.processStoreOps(ops)
+		case requests := <-b.watchRequestChan:
+			for _, req := range requests {
+				go b.watch(req)
+			}
+		}
+	}
+	b.log.Debug(`close`)
+}
+
+func (b *EtcdBackend) watch(req WatchRequest) {
+	directory := NormalizeKey(b.config.Chroot, req.Key)
+	log := b.log.GetLog(b.log.Prefix(), append(b.log.Tags(), "watch", req.Key)...)
+	log.Debug(`open`)
+	defer log.Debug(`close`)
+
+	watchCtx, watchCancel := context.WithCancel(b.ctx)
+	defer watchCancel()
+	go func() {
+		select {
+		case <-req.Ctx.Done():
+			watchCancel()
+		case <-watchCtx.Done():
+		}
+	}()
+
+	key, rangeEnd := etcdPrefixRange(directory)
+	var rangeResp etcdRangeResponse
+	if err := b.call(watchCtx, "/kv/range", map[string]string{
+		"key":       key,
+		"range_end": rangeEnd,
+	}, &rangeResp); err != nil {
+		if watchCtx.Err() == nil {
+			b.fail(err)
+		}
+		return
+	}
+	if !b.sendWatchResult(watchCtx, req.Key, directory, rangeResp.Kvs) {
+		return
+	}
+
+	// watch changes from next revision and resend whole directory on each
+	// change
+	body, err := json.Marshal(map[string]interface{}{
+		"create_request": map[string]string{
+			"key":            key,
+			"range_end":      rangeEnd,
+			"start_revision": strconv.FormatInt(rangeResp.Header.GetRevision()+1, 10),
+		},
+	})
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, b.url("/watch"), bytes.NewReader(body))
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	resp, err := b.client.Do(httpReq.WithContext(watchCtx))
+	if err != nil {
+		if watchCtx.Err() == nil {
+			b.fail(err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk struct {
+			Result struct {
+				Events []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *etcdError `json:"error"`
+		}
+		if err = decoder.Decode(&chunk); err != nil {
+			if watchCtx.Err() == nil {
+				b.fail(fmt.Errorf(`watch %s: %v`, req.Key, err))
+			}
+			return
+		}
+		if chunk.Error != nil {
+			b.fail(fmt.Errorf(`watch %s: %s`, req.Key, chunk.Error.Message))
+			return
+		}
+		if len(chunk.Result.Events) == 0 {
+			continue
+		}
+		if err = b.call(watchCtx, "/kv/range", map[string]string{
+			"key":       key,
+			"range_end": rangeEnd,
+		}, &rangeResp); err != nil {
+			if watchCtx.Err() == nil {
+				b.fail(err)
+			}
+			return
+		}
+		if !b.sendWatchResult(watchCtx, req.Key, directory, rangeResp.Kvs) {
+			return
+		}
+	}
+}
+
+func (b *EtcdBackend) sendWatchResult(ctx context.Context, key, directory string, kvs []etcdKeyValue) (ok bool) {
+	result := WatchResult{
+		Key:  key,
+		Data: map[string][]byte{},
+	}
+	for _, kv := range kvs {
+		k, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			b.log.Error(err)
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			b.log.Error(err)
+			continue
+		}
+		result.Data[TrimKeyPrefix(directory, string(k))] = v
+	}
+	select {
+	case <-ctx.Done():
+	case b.watchResultsChan <- result:
+		ok = true
+	}
+	return
+}
+
+func (b *EtcdBackend) processStoreOps(ops []StoreOp) {
+	var requests []map[string]interface{}
+	var commits []StoreCommit
+	for _, op := range ops {
+		var key string
+		if op.WithTTL {
+			key = NormalizeKey(b.config.Chroot, op.Message.Topic(), b.config.ID)
+		} else {
+			key = NormalizeKey(b.config.Chroot, op.Message.Topic())
+		}
+		commits = append(commits, StoreCommit{
+			ID:      op.Message.Topic(),
+			Hash:    op.Message.Payload().Hash(),
+			WithTTL: op.WithTTL,
+		})
+		if op.Message.Payload().IsEmpty() {
+			requests = append(requests, map[string]interface{}{
+				"request_delete_range": map[string]string{
+					"key": base64.StdEncoding.EncodeToString([]byte(key)),
+				},
+			})
+			continue
+		}
+		var value interface{}
+		if err := op.Message.Payload().Unmarshal(&value); err != nil {
+			b.log.Errorf(`can't unmarshal payload %s: %v`, op.Message.Payload(), err)
+			continue
+		}
+		valJson, err := json.Marshal(value)
+		if err != nil {
+			b.log.Errorf(`can't marshal payload %v: %v`, value, err)
+			continue
+		}
+		put := map[string]string{
+			"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+			"value": base64.StdEncoding.EncodeToString(valJson),
+		}
+		if op.WithTTL {
+			put["lease"] = b.leaseID
+		}
+		requests = append(requests, map[string]interface{}{
+			"request_put": put,
+		})
+	}
+	var txnResp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := b.call(b.ctx, "/kv/txn", map[string]interface{}{
+		"success": requests,
+	}, &txnResp); err != nil {
+		b.fail(err)
+		return
+	}
+	if !txnResp.Succeeded {
+		b.fail(fmt.Errorf(`transaction failed`))
+		return
+	}
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`skip to send commit for %v: %v`, commits, b.ctx.Err())
+	case b.commitsChan <- commits:
+		b.log.Debugf(`commits sent: %v`, commits)
+	}
+}
+
+func (b *EtcdBackend) connect() {
+	b.log.Tracef(`connecting: %s`, b.config.Address)
+	var versionResp struct {
+		Server string `json:"etcdserver"`
+	}
+	if err := b.get(b.ctx, "/version", &versionResp); err != nil {
+		b.fail(err)
+		return
+	}
+	b.apiPrefix = etcdAPIPrefix(versionResp.Server)
+	ttl := int64(b.config.TTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	var grantResp struct {
+		ID string `json:"ID"`
+	}
+	if err := b.call(b.ctx, "/lease/grant", map[string]string{
+		"TTL": strconv.FormatInt(ttl, 10),
+	}, &grantResp); err != nil {
+		b.fail(err)
+		return
+	}
+	b.leaseID = grantResp.ID
+
+	// start keepalive
+	go func() {
+		b.log.Trace(`keepalive: open`)
+		ticker := time.NewTicker(time.Duration(ttl) * time.Second / 3)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-b.leaveChan:
+				if err := b.call(context.Background(), "/kv/lease/revoke", map[string]string{
+					"ID": b.leaseID,
+				}, nil); err != nil {
+					b.log.Errorf(`revoke: %v`, err)
+				}
+				b.Close()
+				b.log.Infof(`leaved (lease: %s)`, b.leaseID)
+				break LOOP
+			case <-b.ctx.Done():
+				break LOOP
+			case <-ticker.C:
+				var keepaliveResp struct {
+					Result struct {
+						TTL string `json:"TTL"`
+					} `json:"result"`
+				}
+				if err := b.call(b.ctx, "/lease/keepalive", map[string]string{
+					"ID": b.leaseID,
+				}, &keepaliveResp); err != nil {
+					if b.ctx.Err() == nil {
+						b.fail(fmt.Errorf(`keepalive: %v`, err))
+					}
+					break LOOP
+				}
+				if keepaliveResp.Result.TTL == "" || keepaliveResp.Result.TTL == "0" {
+					b.fail(fmt.Errorf(`keepalive: lease %s expired`, b.leaseID))
+					break LOOP
+				}
+			}
+		}
+		b.log.Trace(`keepalive: closed`)
+	}()
+	b.log.Infof(`connected (etcd: %s, lease: %s)`, versionResp.Server, b.leaseID)
+	b.readyCancel()
+}
+
+func (b *EtcdBackend) url(path string) string {
+	return fmt.Sprintf("http://%s%s%s", b.config.Address, b.apiPrefix, path)
+}
+
+// get calls etcd HTTP endpoint outside of gateway
+func (b *EtcdBackend) get(ctx context.Context, path string, res interface{}) (err error) {
+	httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s", b.config.Address, path), nil)
+	if err != nil {
+		return
+	}
+	resp, err := b.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf(`%s: %s`, path, resp.Status)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(res)
+	return
+}
+
+// call calls etcd gateway endpoint and decodes first JSON object from
+// response into res
+func (b *EtcdBackend) call(ctx context.Context, path string, req interface{}, res interface{}) (err error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, b.url(path), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp, err := b.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var etcdErr etcdError
+		json.NewDecoder(resp.Body).Decode(&etcdErr)
+		err = fmt.Errorf(`%s: %s %s`, path, resp.Status, etcdErr.Message)
+		return
+	}
+	if res != nil {
+		err = json.NewDecoder(resp.Body).Decode(res)
+	}
+	return
+}
+
+type etcdError struct {
+	Message string `json:"message"`
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+func (h etcdHeader) GetRevision() (res int64) {
+	res, _ = strconv.ParseInt(h.Revision, 10, 64)
+	return
+}
+
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	Kvs    []etcdKeyValue `json:"kvs"`
+}
+
+// etcdAPIPrefix returns JSON gateway prefix for given etcd server version.
+// etcd 3.3 serves gateway on "/v3beta". "/v3" is available since 3.4.
+func etcdAPIPrefix(version string) (res string) {
+	res = "/v3"
+	chunks := strings.SplitN(version, ".", 3)
+	if len(chunks) < 2 {
+		return
+	}
+	major, err := strconv.Atoi(chunks[0])
+	if err != nil {
+		return
+	}
+	minor, err := strconv.Atoi(chunks[1])
+	if err != nil {
+		return
+	}
+	if major == 3 && minor < 4 {
+		res = "/v3beta"
+	}
+	return
+}
+
+// etcdPrefixRange returns base64 encoded key and range end to get all keys
+// in directory
+func etcdPrefixRange(directory string) (key, rangeEnd string) {
+	prefix := []byte(directory + "/")
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	end[len(end)-1]++
+	key = base64.StdEncoding.EncodeToString(prefix)
+	rangeEnd = base64.StdEncoding.EncodeToString(end)
+	return
+}
@@ -0,0 +1,274 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/akaspin/logx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fileBackendDataFile = "kv.json"
+
+// guards data files from concurrent writes by old and new backends
+var fileBackendMu sync.Mutex
+
+type fileRecord struct {
+	Value   json.RawMessage
+	Node    string    `json:",omitempty"` // owner of record with TTL
+	Expires time.Time `json:",omitempty"` // expiration time of record with TTL
+}
+
+// File Backend stores records in single JSON file in local directory. File
+// backend is intended for standalone agents. Records with TTL are renewed by
+// backend each TTL/2 and are removed on expiration or leave.
+type FileBackend struct {
+	*baseBackend
+
+	path    string
+	records map[string]fileRecord
+	watches []*localWatch
+
+	opsChan          chan []StoreOp
+	watchRequestChan chan []WatchRequest
+}
+
+func NewFileBackend(ctx context.Context, log *logx.Log, config BackendConfig) (b *FileBackend) {
+	b = &FileBackend{
+		baseBackend:      newBaseBackend(ctx, log, config),
+		path:             filepath.Join("/", config.Chroot, fileBackendDataFile),
+		records:          map[string]fileRecord{},
+		opsChan:          make(chan []StoreOp, 1),
+		watchRequestChan: make(chan []WatchRequest, 1),
+	}
+	go b.loop()
+	return
+}
+
+func (b *FileBackend) Submit(ops []StoreOp) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, ops, b.ctx.Err())
+	case b.opsChan <- ops:
+		b.log.Tracef(`submit: %v`, ops)
+	}
+}
+
+func (b *FileBackend) Subscribe(req []WatchRequest) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, req, b.ctx.Err())
+	case b.watchRequestChan <- req:
+		b.log.Tracef(`subscribe: %v`, req)
+	}
+}
+
+func (b *FileBackend) loop() {
+	b.log.Debug(`open`)
+	if err := b.open(); err != nil {
+		b.fail(err)
+		return
+	}
+	b.log.Infof(`ready: %s`, b.path)
+	b.readyCancel()
+
+	renewInterval := b.config.TTL / 2
+	if renewInterval <= 0 {
+		renewInterval = time.Second
+	}
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+LOOP:
+	for {
+		select {
+		case <-b.leaveChan:
+			if err := b.leave(); err != nil {
+				b.log.Error(err)
+			}
+			b.Close()
+			b.log.Infof(`leaved: %s`, b.config.ID)
+			break LOOP
+		case <-b.ctx.Done():
+			break LOOP
+		case <-ticker.C:
+			b.renew()
+			if err := b.store(); err != nil {
+				b.fail(err)
+				break LOOP
+			}
+			b.notify()
+		case ops := <-b.opsChan:
+			if err := b.processStoreOps(ops); err != nil {
+				b.fail(err)
+				break LOOP
+			}
+		case requests := <-b.watchRequestChan:
+			for _, req := range requests {
+				w := newLocalWatch(req)
+				b.watches = append(b.watches, w)
+				go w.run(b.ctx, b.log, b.watchResultsChan)
+			}
+			b.notify()
+		}
+	}
+	b.log.Debug(`close`)
+}
+
+func (b *FileBackend) processStoreOps(ops []StoreOp) (err error) {
+	var commits []StoreCommit
+	for _, op := range ops {
+		commits = append(commits, StoreCommit{
+			ID:      op.Message.Topic(),
+			Hash:    op.Message.Payload().Hash(),
+			WithTTL: op.WithTTL,
+		})
+		key := NormalizeKey(op.Message.Topic())
+		if op.WithTTL {
+			key = NormalizeKey(op.Message.Topic(), b.config.ID)
+		}
+		if op.Message.Payload().IsEmpty() {
+			delete(b.records, key)
+			continue
+		}
+		var value interface{}
+		if err := op.Message.Payload().Unmarshal(&value); err != nil {
+			b.log.Errorf(`can't unmarshal payload %s: %v`, op.Message.Payload(), err)
+			continue
+		}
+		valJson, err := json.Marshal(value)
+		if err != nil {
+			b.log.Errorf(`can't marshal payload %v: %v`, value, err)
+			continue
+		}
+		record := fileRecord{
+			Value: valJson,
+		}
+		if op.WithTTL {
+			record.Node = b.config.ID
+			record.Expires = time.Now().Add(b.config.TTL)
+		}
+		b.records[key] = record
+	}
+	if err = b.store(); err != nil {
+		return
+	}
+	b.notify()
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`skip to send commit for %v: %v`, commits, b.ctx.Err())
+	case b.commitsChan <- commits:
+		b.log.Debugf(`commits sent: %v`, commits)
+	}
+	return
+}
+
+// renew prolongs own records with TTL and removes expired ones
+func (b *FileBackend) renew() {
+	now := time.Now()
+	for key, record := range b.records {
+		if record.Node == "" {
+			continue
+		}
+		if record.Node == b.config.ID {
+			record.Expires = now.Add(b.config.TTL)
+			b.records[key] = record
+			continue
+		}
+		if record.Expires.Before(now) {
+			b.log.Debugf(`expired: %s (node: %s)`, key, record.Node)
+			delete(b.records, key)
+		}
+	}
+}
+
+// notify sends actual data to all watches
+func (b *FileBackend) notify() {
+	records := map[string][]byte{}
+	for key, record := range b.records {
+		records[key] = []byte(record.Value)
+	}
+	var watches []*localWatch
+	for _, w := range b.watches {
+		if w.update(records) {
+			watches = append(watches, w)
+		}
+	}
+	b.watches = watches
+}
+
+// open loads records from disk. Own records with TTL left by previous
+// process are dropped because KV resubmits actual volatile records.
+func (b *FileBackend) open() (err error) {
+	fileBackendMu.Lock()
+	defer fileBackendMu.Unlock()
+	if err = b.load(); err != nil {
+		return
+	}
+	for key, record := range b.records {
+		if record.Node == b.config.ID {
+			delete(b.records, key)
+		}
+	}
+	b.renew()
+	err = b.write()
+	return
+}
+
+// leave removes own records with TTL. Records are reloaded from disk
+// because backend with new node ID may be already started.
+func (b *FileBackend) leave() (err error) {
+	fileBackendMu.Lock()
+	defer fileBackendMu.Unlock()
+	b.records = map[string]fileRecord{}
+	if err = b.load(); err != nil {
+		return
+	}
+	for key, record := range b.records {
+		if record.Node == b.config.ID {
+			delete(b.records, key)
+		}
+	}
+	err = b.write()
+	return
+}
+
+func (b *FileBackend) load() (err error) {
+	data, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &b.records)
+	return
+}
+
+// store atomically writes records to disk
+func (b *FileBackend) store() (err error) {
+	fileBackendMu.Lock()
+	defer fileBackendMu.Unlock()
+	err = b.write()
+	return
+}
+
+func (b *FileBackend) write() (err error) {
+	if err = os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return
+	}
+	data, err := json.Marshal(b.records)
+	if err != nil {
+		return
+	}
+	tmp := b.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	err = os.Rename(tmp, b.path)
+	return
+}
@@ -0,0 +1,495 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	gossipPath    = "/v1/gossip"
+	gossipFanout  = 2
+	gossipTimeout = time.Second
+
+	// Tombstones are removed after gossipTombstoneTTLs * TTL since deletion.
+	// Nodes which were not heard longer may bring deleted records back.
+	gossipTombstoneTTLs = 3
+)
+
+// gossipState is exchanged between nodes on each gossip round
+type gossipState struct {
+	Chroot  string
+	Node    string
+	Members map[string]gossipMember
+	Entries map[string]gossipEntry
+}
+
+type gossipMember struct {
+	Address   string // gossip address
+	Heartbeat uint64 // incremented by member on each round
+}
+
+type gossipEntry struct {
+	Value     json.RawMessage `json:",omitempty"`
+	Version   uint64          // Lamport clock
+	Node      string          // node which made last change
+	TTL       bool            `json:",omitempty"` // volatile entry owned by node
+	Deleted   bool            `json:",omitempty"` // tombstone
+	DeletedAt int64           `json:",omitempty"` // tombstone creation time in unix nanoseconds
+}
+
+type gossipExchange struct {
+	state gossipState
+	reply chan gossipState
+}
+
+// Gossip Backend replicates records between agents without external KV.
+// Each node listens on gossip address and periodically exchanges whole
+// state with random peers. Permanent records are resolved by Lamport clock.
+// Volatile records are owned by node and are removed from cluster when node
+// heartbeat is not updated within TTL.
+//
+//	gossip://<bind-host>:<port>/<chroot>?join=<peer>:<port>&join=...
+//
+// Gossip address of node is host from agent advertise address with port from
+// backend URL.
+type GossipBackend struct {
+	*baseBackend
+
+	address   string
+	interval  time.Duration
+	clock     uint64
+	heartbeat uint64
+	members   map[string]gossipMember
+	seen      map[string]time.Time // last heartbeat update by member
+	dead      map[string]uint64    // last heartbeat of expired members
+	entries   map[string]gossipEntry
+	watches   []*localWatch
+
+	opsChan          chan []StoreOp
+	watchRequestChan chan []WatchRequest
+	exchangeChan     chan gossipExchange
+	mergeChan        chan gossipState
+}
+
+func NewGossipBackend(ctx context.Context, log *logx.Log, config BackendConfig) (b *GossipBackend) {
+	b = &GossipBackend{
+		baseBackend:      newBaseBackend(ctx, log, config),
+		interval:         config.TTL / 10,
+		members:          map[string]gossipMember{},
+		seen:             map[string]time.Time{},
+		dead:             map[string]uint64{},
+		entries:          map[string]gossipEntry{},
+		opsChan:          make(chan []StoreOp, 1),
+		watchRequestChan: make(chan []WatchRequest, 1),
+		exchangeChan:     make(chan gossipExchange),
+		mergeChan:        make(chan gossipState, 1),
+	}
+	if b.interval < time.Millisecond*100 {
+		b.interval = time.Millisecond * 100
+	}
+	if b.interval > time.Second {
+		b.interval = time.Second
+	}
+	go b.loop()
+	return
+}
+
+func (b *GossipBackend) Submit(ops []StoreOp) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, ops, b.ctx.Err())
+	case b.opsChan <- ops:
+		b.log.Tracef(`submit: %v`, ops)
+	}
+}
+
+func (b *GossipBackend) Subscribe(req []WatchRequest) {
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`ignore %v: %v`, req, b.ctx.Err())
+	case b.watchRequestChan <- req:
+		b.log.Tracef(`subscribe: %v`, req)
+	}
+}
+
+// ServeHTTP accepts state from peer and replies with own state
+func (b *GossipBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != gossipPath {
+		http.NotFound(w, r)
+		return
+	}
+	var state gossipState
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if state.Chroot != b.config.Chroot {
+		http.Error(w, fmt.Sprintf(`chroot mismatch: %s != %s`, state.Chroot, b.config.Chroot), http.StatusConflict)
+		return
+	}
+	exchange := gossipExchange{
+		state: state,
+		reply: make(chan gossipState, 1),
+	}
+	select {
+	case <-b.ctx.Done():
+		http.Error(w, b.ctx.Err().Error(), http.StatusServiceUnavailable)
+		return
+	case b.exchangeChan <- exchange:
+	}
+	json.NewEncoder(w).Encode(<-exchange.reply)
+}
+
+func (b *GossipBackend) loop() {
+	b.log.Debug(`open`)
+	listener, err := b.listen()
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	server := &http.Server{
+		Handler: b,
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	b.heartbeat = uint64(time.Now().UnixNano())
+	b.log.Infof(`listening: %s (advertise: %s)`, listener.Addr(), b.address)
+	b.readyCancel()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+LOOP:
+	for {
+		select {
+		case <-b.leaveChan:
+			for key, entry := range b.entries {
+				if entry.TTL && entry.Node == b.config.ID && !entry.Deleted {
+					b.clock++
+					b.entries[key] = gossipEntry{
+						Version:   b.clock,
+						Node:      b.config.ID,
+						TTL:       true,
+						Deleted:   true,
+						DeletedAt: time.Now().UnixNano(),
+					}
+				}
+			}
+			state := b.state()
+			for _, peer := range b.peers(0) {
+				if _, err := b.push(context.Background(), peer, state); err != nil {
+					b.log.Warningf(`leave %s: %v`, peer, err)
+				}
+			}
+			b.Close()
+			b.log.Infof(`leaved: %s`, b.config.ID)
+			break LOOP
+		case <-b.ctx.Done():
+			break LOOP
+		case <-ticker.C:
+			b.heartbeat++
+			if b.expire() {
+				b.notify()
+			}
+			state := b.state()
+			for _, peer := range b.peers(gossipFanout) {
+				go func(peer string) {
+					remote, err := b.push(b.ctx, peer, state)
+					if err != nil {
+						b.log.Tracef(`gossip %s: %v`, peer, err)
+						return
+					}
+					select {
+					case <-b.ctx.Done():
+					case b.mergeChan <- remote:
+					}
+				}(peer)
+			}
+		case remote := <-b.mergeChan:
+			if b.merge(remote) {
+				b.notify()
+			}
+		case exchange := <-b.exchangeChan:
+			if b.merge(exchange.state) {
+				b.notify()
+			}
+			exchange.reply <- b.state()
+		case ops := <-b.opsChan:
+			b.processStoreOps(ops)
+		case requests := <-b.watchRequestChan:
+			for _, req := range requests {
+				w := newLocalWatch(req)
+				b.watches = append(b.watches, w)
+				go w.run(b.ctx, b.log, b.watchResultsChan)
+			}
+			b.notify()
+		}
+	}
+	b.log.Debug(`close`)
+}
+
+// listen binds gossip address. Listen retries for a while because previous
+// backend with same address may not be closed yet.
+func (b *GossipBackend) listen() (listener net.Listener, err error) {
+	_, port, err := net.SplitHostPort(b.config.Address)
+	if err != nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(b.config.Advertise)
+	if err != nil {
+		return
+	}
+	b.address = net.JoinHostPort(host, port)
+	for i := 0; i < 50; i++ {
+		if listener, err = net.Listen("tcp", b.config.Address); err == nil {
+			return
+		}
+		select {
+		case <-b.ctx.Done():
+			err = b.ctx.Err()
+			return
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+	return
+}
+
+func (b *GossipBackend) processStoreOps(ops []StoreOp) {
+	var commits []StoreCommit
+	for _, op := range ops {
+		commits = append(commits, StoreCommit{
+			ID:      op.Message.Topic(),
+			Hash:    op.Message.Payload().Hash(),
+			WithTTL: op.WithTTL,
+		})
+		key := NormalizeKey(op.Message.Topic())
+		if op.WithTTL {
+			key = NormalizeKey(op.Message.Topic(), b.config.ID)
+		}
+		entry := gossipEntry{
+			Node: b.config.ID,
+			TTL:  op.WithTTL,
+		}
+		if op.Message.Payload().IsEmpty() {
+			entry.Deleted = true
+			entry.DeletedAt = time.Now().UnixNano()
+		} else {
+			var value interface{}
+			if err := op.Message.Payload().Unmarshal(&value); err != nil {
+				b.log.Errorf(`can't unmarshal payload %s: %v`, op.Message.Payload(), err)
+				continue
+			}
+			valJson, err := json.Marshal(value)
+			if err != nil {
+				b.log.Errorf(`can't marshal payload %v: %v`, value, err)
+				continue
+			}
+			entry.Value = valJson
+		}
+		b.clock++
+		entry.Version = b.clock
+		b.entries[key] = entry
+	}
+	b.notify()
+	select {
+	case <-b.ctx.Done():
+		b.log.Warningf(`skip to send commit for %v: %v`, commits, b.ctx.Err())
+	case b.commitsChan <- commits:
+		b.log.Debugf(`commits sent: %v`, commits)
+	}
+}
+
+// merge merges remote state and returns true if entries are changed
+func (b *GossipBackend) merge(remote gossipState) (changed bool) {
+	now := time.Now()
+	for id, member := range remote.Members {
+		if id == b.config.ID {
+			continue
+		}
+		if heartbeat, isDead := b.dead[id]; isDead {
+			if member.Heartbeat <= heartbeat {
+				continue
+			}
+			delete(b.dead, id)
+		}
+		if local, ok := b.members[id]; ok && local.Heartbeat >= member.Heartbeat {
+			continue
+		}
+		if _, ok := b.members[id]; !ok {
+			b.log.Infof(`member joined: %s (%s)`, id, member.Address)
+		}
+		b.members[id] = member
+		b.seen[id] = now
+	}
+	tombstoneDeadline := b.tombstoneDeadline(now)
+	for key, entry := range remote.Entries {
+		if entry.Version > b.clock {
+			b.clock = entry.Version
+		}
+		if entry.Deleted && entry.DeletedAt < tombstoneDeadline {
+			// tombstone is already removed or will be removed soon
+			continue
+		}
+		if entry.TTL {
+			if entry.Node == b.config.ID {
+				// node is authoritative for own volatile entries: stale
+				// entries from previous run are overridden
+				local, ok := b.entries[key]
+				if ok && local.Version >= entry.Version {
+					continue
+				}
+				if !ok {
+					local = gossipEntry{
+						Node:      b.config.ID,
+						TTL:       true,
+						Deleted:   true,
+						DeletedAt: now.UnixNano(),
+					}
+				}
+				b.clock++
+				local.Version = b.clock
+				b.entries[key] = local
+				continue
+			}
+			if _, alive := b.members[entry.Node]; !alive {
+				continue
+			}
+		}
+		local, ok := b.entries[key]
+		if ok && (local.Version > entry.Version || (local.Version == entry.Version && local.Node >= entry.Node)) {
+			continue
+		}
+		b.entries[key] = entry
+		changed = true
+	}
+	return
+}
+
+// expire removes members which heartbeat is not updated within TTL with all
+// their volatile entries. Expired tombstones are also removed.
+func (b *GossipBackend) expire() (changed bool) {
+	now := time.Now()
+	tombstoneDeadline := b.tombstoneDeadline(now)
+	for key, entry := range b.entries {
+		if entry.Deleted && entry.DeletedAt < tombstoneDeadline {
+			delete(b.entries, key)
+		}
+	}
+	deadline := now.Add(-b.config.TTL)
+	for id, member := range b.members {
+		if b.seen[id].After(deadline) {
+			continue
+		}
+		b.log.Infof(`member expired: %s (%s)`, id, member.Address)
+		b.dead[id] = member.Heartbeat
+		delete(b.members, id)
+		delete(b.seen, id)
+		for key, entry := range b.entries {
+			if entry.TTL && entry.Node == id {
+				delete(b.entries, key)
+				changed = true
+			}
+		}
+	}
+	return
+}
+
+// tombstoneDeadline returns time in unix nanoseconds before which
+// tombstones are expired
+func (b *GossipBackend) tombstoneDeadline(now time.Time) int64 {
+	return now.Add(-b.config.TTL * gossipTombstoneTTLs).UnixNano()
+}
+
+func (b *GossipBackend) state() (state gossipState) {
+	state = gossipState{
+		Chroot: b.config.Chroot,
+		Node:   b.config.ID,
+		Members: map[string]gossipMember{
+			b.config.ID: {
+				Address:   b.address,
+				Heartbeat: b.heartbeat,
+			},
+		},
+		Entries: map[string]gossipEntry{},
+	}
+	for id, member := range b.members {
+		state.Members[id] = member
+	}
+	for key, entry := range b.entries {
+		state.Entries[key] = entry
+	}
+	return
+}
+
+// peers returns up to n random peer addresses. If n is zero peers returns
+// all known addresses.
+func (b *GossipBackend) peers(n int) (res []string) {
+	addresses := map[string]struct{}{}
+	for _, addr := range b.config.Join {
+		addresses[addr] = struct{}{}
+	}
+	for _, member := range b.members {
+		addresses[member.Address] = struct{}{}
+	}
+	delete(addresses, b.address)
+	for addr := range addresses {
+		res = append(res, addr)
+	}
+	for i := len(res) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		res[i], res[j] = res[j], res[i]
+	}
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return
+}
+
+func (b *GossipBackend) push(ctx context.Context, peer string, state gossipState) (remote gossipState, err error) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s%s", peer, gossipPath), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, gossipTimeout)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf(`bad status: %s`, resp.Status)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&remote)
+	return
+}
+
+// notify sends actual data to all watches
+func (b *GossipBackend) notify() {
+	records := map[string][]byte{}
+	for key, entry := range b.entries {
+		if !entry.Deleted {
+			records[key] = []byte(entry.Value)
+		}
+	}
+	var watches []*localWatch
+	for _, w := range b.watches {
+		if w.update(records) {
+			watches = append(watches, w)
+		}
+	}
+	b.watches = watches
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/supervisor"
 )
 
@@ -40,8 +41,9 @@ func (p *operatorProducer) Subscribe(ctx context.Context, consumer bus.Consumer)
 
 type KV struct {
 	*supervisor.Control
-	log     *logx.Log
-	factory BackendFactory
+	log      *logx.Log
+	factory  BackendFactory
+	reporter metrics.Reporter
 
 	backend Backend
 	config  Config
@@ -63,11 +65,12 @@ type KV struct {
 	closedWatchGroupChan chan string
 }
 
-func NewKV(ctx context.Context, log *logx.Log, factory BackendFactory) (b *KV) {
+func NewKV(ctx context.Context, log *logx.Log, factory BackendFactory, reporter metrics.Reporter) (b *KV) {
 	b = &KV{
 		Control:  supervisor.NewControl(ctx),
 		log:      log.GetLog("cluster", "kv"),
 		factory:  factory,
+		reporter: reporter,
 		config:   Config{},
 		volatile: map[string]bus.Message{},
 		pending:  map[string]StoreOp{},
@@ -183,6 +186,9 @@ LOOP:
 				log.Tracef(`ignore reconfiguration`)
 				continue LOOP
 			}
+			if req.internal {
+				k.reporter.Count("cluster_backend_reconnects_total", 1)
+			}
 			if config.NodeID != req.config.NodeID {
 				log.Infof(`leaving cluster: node id changed %s->%s`, config.NodeID, req.config.NodeID)
 				k.backend.Leave()
@@ -223,6 +229,7 @@ LOOP:
 				}
 				k.pending[id] = op
 			}
+			k.reporter.Gauge("cluster_kv_pending_ops", float64(len(k.pending)))
 			go func() {
 				select {
 				case <-k.Control.Ctx().Done():
@@ -274,6 +281,7 @@ LOOP:
 					for _, commit := range commits {
 						delete(k.pending, commit.ID)
 					}
+					k.reporter.Gauge("cluster_kv_pending_ops", float64(len(k.pending)))
 					log.Tracef(`commits done: %v (pending %v)`, commits, k.pending)
 				}
 			default:
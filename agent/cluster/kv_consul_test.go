@@ -8,6 +8,7 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/fixture"
 	"github.com/hashicorp/consul/api"
 	"github.com/stretchr/testify/assert"
@@ -22,7 +23,7 @@ func TestKV_ConsulBackend(t *testing.T) {
 	waitConfig := fixture.DefaultWaitConfig()
 
 	ctx, _ := context.WithCancel(context.Background())
-	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory)
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
 
 	//watcherCtx, _ := context.WithCancel(context.Background())
 	//watcher := bus.NewTestingConsumer(ctx)
@@ -0,0 +1,85 @@
+// +build ide test_unit
+
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKV_EtcdBackend(t *testing.T) {
+	srv := fixture.NewEtcdServer(t, nil)
+	defer srv.Clean()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
+	assert.NoError(t, kv.Open())
+
+	config := cluster.Config{
+		NodeID:        "node-1",
+		Advertise:     "127.0.0.1:7654",
+		RetryInterval: time.Second,
+		TTL:           time.Second * 5,
+		BackendURL:    fmt.Sprintf("etcd://%s/soil", srv.Address()),
+	}
+
+	registry := bus.NewTestingConsumer(ctx)
+	nodes := bus.NewTestingConsumer(ctx)
+
+	t.Run(`store before etcd`, func(t *testing.T) {
+		kv.Configure(config)
+		kv.PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", map[string]string{"1": "1"}))
+		kv.VolatileStore("nodes").ConsumeMessage(bus.NewMessage("", map[string]string{"ID": "node-1"}))
+		kv.SubscribeKey("registry", ctx, registry)
+		kv.SubscribeKey("nodes", ctx, nodes)
+	})
+	t.Run(`start etcd`, func(t *testing.T) {
+		srv.Up()
+		srv.WaitAlive()
+	})
+	t.Run(`ensure records`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-1": map[string]string{"1": "1"},
+		})))
+		fixture.WaitNoErrorT10(t, nodes.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+			"node-1": map[string]string{"ID": "node-1"},
+		})))
+	})
+	t.Run(`update record`, func(t *testing.T) {
+		kv.PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-2", map[string]string{"2": "2"}))
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-1": map[string]string{"1": "1"},
+			"pod-2": map[string]string{"2": "2"},
+		})))
+	})
+	t.Run(`leave on new node id`, func(t *testing.T) {
+		config.NodeID = "node-2"
+		kv.Configure(config)
+		// lease should be revoked before TTL expires
+		fixture.WaitNoErrorT(t, fixture.WaitConfig{
+			Retry:   time.Millisecond * 100,
+			Retries: 20,
+		}, nodes.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+			"node-2": map[string]string{"ID": "node-1"},
+		})))
+	})
+	t.Run(`delete record`, func(t *testing.T) {
+		kv.PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", nil))
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-2": map[string]string{"2": "2"},
+		})))
+	})
+
+	kv.Close()
+	kv.Wait()
+}
@@ -0,0 +1,131 @@
+// +build ide test_unit
+
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKV_FileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-kv-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := cluster.DefaultConfig()
+	config.NodeID = "node-1"
+	config.TTL = time.Second
+	config.BackendURL = fmt.Sprintf("file://%s", dir)
+
+	t.Run(`store and watch`, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
+		require.NoError(t, kv.Open())
+		kv.Configure(config)
+
+		registry := bus.NewTestingConsumer(ctx)
+		nodes := bus.NewTestingConsumer(ctx)
+		kv.SubscribeKey("registry", ctx, registry)
+		kv.SubscribeKey("nodes", ctx, nodes)
+
+		kv.PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", map[string]string{"1": "1"}))
+		kv.VolatileStore("nodes").ConsumeMessage(bus.NewMessage("", map[string]string{"ID": "node-1"}))
+
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-1": map[string]string{"1": "1"},
+		})))
+		fixture.WaitNoErrorT10(t, nodes.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+			"node-1": map[string]string{"ID": "node-1"},
+		})))
+
+		kv.PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-2", map[string]string{"2": "2"}))
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-1": map[string]string{"1": "1"},
+			"pod-2": map[string]string{"2": "2"},
+		})))
+
+		kv.Close()
+		kv.Wait()
+	})
+	t.Run(`restore after restart with new node`, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
+		require.NoError(t, kv.Open())
+		config.NodeID = "node-2"
+		kv.Configure(config)
+
+		registry := bus.NewTestingConsumer(ctx)
+		nodes := bus.NewTestingConsumer(ctx)
+		kv.SubscribeKey("registry", ctx, registry)
+		kv.SubscribeKey("nodes", ctx, nodes)
+
+		fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-1": map[string]string{"1": "1"},
+			"pod-2": map[string]string{"2": "2"},
+		})))
+
+		// volatile record of node-1 should expire
+		fixture.WaitNoErrorT10(t, nodes.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{})))
+
+		kv.Close()
+		kv.Wait()
+	})
+}
+
+func TestKV_FileBackend_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-kv-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// records left by previous process of node-1
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "kv.json"), []byte(`{
+		"registry/pod-1": {"Value": {"1": "1"}},
+		"counter/gone/node-1": {"Value": {"Want": 1, "Slots": 1}, "Node": "node-1", "Expires": "`+expires+`"},
+		"counter/kept/node-1": {"Value": {"Want": 1, "Slots": 1}, "Node": "node-1", "Expires": "`+expires+`"},
+		"counter/kept/node-2": {"Value": {"Want": 1, "Slots": 0}, "Node": "node-2", "Expires": "`+expires+`"}
+	}`), 0644))
+
+	config := cluster.DefaultConfig()
+	config.NodeID = "node-1"
+	config.BackendURL = fmt.Sprintf("file://%s", dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
+	require.NoError(t, kv.Open())
+	kv.VolatileStore("counter").ConsumeMessage(bus.NewMessage("kept", map[string]int{"Want": 1, "Slots": 1}))
+	kv.Configure(config)
+
+	registry := bus.NewTestingConsumer(ctx)
+	counter := bus.NewTestingConsumer(ctx)
+	kv.SubscribeKey("registry", ctx, registry)
+	kv.SubscribeKey("counter", ctx, counter)
+
+	fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+		"pod-1": map[string]string{"1": "1"},
+	})))
+	fixture.WaitNoErrorT10(t, counter.ExpectLastMessageFn(bus.NewMessage("counter", map[string]interface{}{
+		"kept/node-1": map[string]int{"Want": 1, "Slots": 1},
+		"kept/node-2": map[string]int{"Want": 1, "Slots": 0},
+	})))
+
+	kv.Close()
+	kv.Wait()
+}
@@ -0,0 +1,175 @@
+// +build ide test_unit
+
+package cluster_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKV_GossipBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ports := fixture.RandomPorts(t, 3)
+	var kvs []*cluster.KV
+	var registries, nodes []*bus.TestingConsumer
+	for i, port := range ports {
+		kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.DefaultBackendFactory, &metrics.BlackHole{})
+		require.NoError(t, kv.Open())
+		kv.Configure(cluster.Config{
+			NodeID:        fmt.Sprintf("node-%d", i),
+			Advertise:     fmt.Sprintf("127.0.0.1:%d", 7654+i),
+			RetryInterval: time.Millisecond * 100,
+			TTL:           time.Second,
+			BackendURL:    fmt.Sprintf("gossip://127.0.0.1:%d/soil?join=127.0.0.1:%d", port, ports[0]),
+		})
+		registry := bus.NewTestingConsumer(ctx)
+		kv.SubscribeKey("registry", ctx, registry)
+		node := bus.NewTestingConsumer(ctx)
+		kv.SubscribeKey("nodes", ctx, node)
+		kv.VolatileStore("nodes").ConsumeMessage(bus.NewMessage("", map[string]string{"ID": fmt.Sprintf("node-%d", i)}))
+		kvs = append(kvs, kv)
+		registries = append(registries, registry)
+		nodes = append(nodes, node)
+	}
+
+	t.Run(`volatile`, func(t *testing.T) {
+		for _, node := range nodes {
+			fixture.WaitNoErrorT10(t, node.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+				"node-0": map[string]string{"ID": "node-0"},
+				"node-1": map[string]string{"ID": "node-1"},
+				"node-2": map[string]string{"ID": "node-2"},
+			})))
+		}
+	})
+	t.Run(`permanent`, func(t *testing.T) {
+		kvs[1].PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", map[string]string{"1": "1"}))
+		for _, registry := range registries {
+			fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+				"pod-1": map[string]string{"1": "1"},
+			})))
+		}
+		kvs[2].PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", map[string]string{"1": "2"}))
+		kvs[0].PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-2", map[string]string{"2": "2"}))
+		for _, registry := range registries {
+			fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+				"pod-1": map[string]string{"1": "2"},
+				"pod-2": map[string]string{"2": "2"},
+			})))
+		}
+		kvs[1].PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-1", nil))
+		for _, registry := range registries {
+			fixture.WaitNoErrorT10(t, registry.ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+				"pod-2": map[string]string{"2": "2"},
+			})))
+		}
+	})
+	t.Run(`tombstones`, func(t *testing.T) {
+		kvs[0].PermanentStore("registry").ConsumeMessage(bus.NewMessage("pod-3", nil))
+		tombstone := func() (ok bool, err error) {
+			entries, err := gossipExchange(ports[0], nil)
+			for key, entry := range entries {
+				if strings.Contains(key, "pod-3") && entry["Deleted"] == true {
+					ok = true
+				}
+			}
+			return
+		}
+		fixture.WaitNoErrorT10(t, func() (err error) {
+			ok, err := tombstone()
+			if err == nil && !ok {
+				err = fmt.Errorf("tombstone is not found")
+			}
+			return
+		})
+		fixture.WaitNoErrorT10(t, func() (err error) {
+			ok, err := tombstone()
+			if err == nil && ok {
+				err = fmt.Errorf("tombstone is not expired")
+			}
+			return
+		})
+
+		// expired remote tombstones are ignored
+		entries, err := gossipExchange(ports[0], map[string]interface{}{
+			"registry/pod-4": map[string]interface{}{
+				"Version":   1 << 40,
+				"Node":      "node-x",
+				"Deleted":   true,
+				"DeletedAt": 1,
+			},
+		})
+		require.NoError(t, err)
+		for key := range entries {
+			assert.NotContains(t, key, "pod-4")
+		}
+	})
+	t.Run(`expire volatile`, func(t *testing.T) {
+		kvs[2].Close()
+		kvs[2].Wait()
+		for _, node := range nodes[:2] {
+			fixture.WaitNoErrorT10(t, node.ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+				"node-0": map[string]string{"ID": "node-0"},
+				"node-1": map[string]string{"ID": "node-1"},
+			})))
+		}
+	})
+	t.Run(`leave`, func(t *testing.T) {
+		kvs[1].Configure(cluster.Config{
+			NodeID:        "node-3",
+			Advertise:     "127.0.0.1:7655",
+			RetryInterval: time.Millisecond * 100,
+			TTL:           time.Second,
+			BackendURL:    fmt.Sprintf("gossip://127.0.0.1:%d/soil?join=127.0.0.1:%d", ports[1], ports[0]),
+		})
+		fixture.WaitNoErrorT10(t, nodes[0].ExpectLastMessageFn(bus.NewMessage("nodes", map[string]interface{}{
+			"node-0": map[string]string{"ID": "node-0"},
+			"node-3": map[string]string{"ID": "node-1"},
+		})))
+		fixture.WaitNoErrorT10(t, registries[1].ExpectLastMessageFn(bus.NewMessage("registry", map[string]interface{}{
+			"pod-2": map[string]string{"2": "2"},
+		})))
+	})
+
+	for _, kv := range kvs[:2] {
+		kv.Close()
+		kv.Wait()
+	}
+}
+
+// gossipExchange sends entries to gossip endpoint and returns entries from
+// reply
+func gossipExchange(port int, entries map[string]interface{}) (res map[string]map[string]interface{}, err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"Chroot":  "soil",
+		"Entries": entries,
+	})
+	if err != nil {
+		return
+	}
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/v1/gossip", port), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var state struct {
+		Entries map[string]map[string]interface{}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	res = state.Entries
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/fixture"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -24,7 +25,7 @@ func TestKV_Configure(t *testing.T) {
 		CrashChan:   make(chan struct{}, 1),
 		MessageChan: make(chan map[string]map[string]interface{}),
 	}
-	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg))
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg), &metrics.BlackHole{})
 	assert.NoError(t, kv.Open())
 
 	kvConfig := cluster.DefaultConfig()
@@ -84,7 +85,7 @@ func TestKV_Submit(t *testing.T) {
 		CrashChan:   make(chan struct{}, 1),
 		MessageChan: make(chan map[string]map[string]interface{}),
 	}
-	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg))
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg), &metrics.BlackHole{})
 	assert.NoError(t, kv.Open())
 
 	waitConfig := fixture.DefaultWaitConfig()
@@ -259,7 +260,7 @@ func TestKV_Subscribe(t *testing.T) {
 		CrashChan:   make(chan struct{}, 1),
 		MessageChan: msgChan,
 	}
-	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg))
+	kv := cluster.NewKV(ctx, logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg), &metrics.BlackHole{})
 	assert.NoError(t, kv.Open())
 	backendCfg.ReadyChan <- struct{}{}
 
@@ -347,7 +348,7 @@ func TestStore_ConsumeMessage(t *testing.T) {
 		CrashChan:   make(chan struct{}, 1),
 		MessageChan: nil,
 	}
-	kv := cluster.NewKV(context.Background(), logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg))
+	kv := cluster.NewKV(context.Background(), logx.GetLog("test"), cluster.NewTestingBackendFactory(backendCfg), &metrics.BlackHole{})
 	assert.NoError(t, kv.Open())
 	backendCfg.ReadyChan <- struct{}{}
 
@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"reflect"
+	"strings"
+)
+
+// localWatch delivers snapshots of directory from backends which hold all
+// records in memory. Only latest snapshot is delivered.
+type localWatch struct {
+	req     string // requested key
+	key     string // normalized key
+	ctx     context.Context
+	last    map[string][]byte
+	updates chan map[string][]byte
+}
+
+func newLocalWatch(req WatchRequest) (w *localWatch) {
+	w = &localWatch{
+		req:     req.Key,
+		key:     NormalizeKey(req.Key),
+		ctx:     req.Ctx,
+		updates: make(chan map[string][]byte, 1),
+	}
+	return
+}
+
+// update sends records in watched directory if they are changed since last
+// update. Returns false if watch is closed.
+func (w *localWatch) update(records map[string][]byte) (ok bool) {
+	select {
+	case <-w.ctx.Done():
+		return
+	default:
+	}
+	ok = true
+	data := map[string][]byte{}
+	for key, value := range records {
+		if key == w.key || !strings.HasPrefix(key, w.key+"/") {
+			continue
+		}
+		data[TrimKeyPrefix(w.key, key)] = value
+	}
+	if w.last != nil && reflect.DeepEqual(w.last, data) {
+		return
+	}
+	w.last = data
+	// replace pending update
+	select {
+	case <-w.updates:
+	default:
+	}
+	w.updates <- data
+	return
+}
+
+// run forwards updates to results channel until backend or watch context
+// is closed
+func (w *localWatch) run(ctx context.Context, log *logx.Log, results chan WatchResult) {
+	log = log.GetLog(log.Prefix(), append(log.Tags(), "watch", w.key)...)
+	log.Debug(`open`)
+LOOP:
+	for {
+		select {
+		case <-ctx.Done():
+			break LOOP
+		case <-w.ctx.Done():
+			break LOOP
+		case data := <-w.updates:
+			select {
+			case <-ctx.Done():
+				break LOOP
+			case <-w.ctx.Done():
+				break LOOP
+			case results <- WatchResult{
+				Key:  w.req,
+				Data: data,
+			}:
+			}
+		}
+	}
+	log.Debug(`close`)
+}
@@ -10,4 +10,5 @@ cluster {
   node_id = "node-1-add"
   backend = "consul://127.0.0.1:8500"
   ttl = "11m"
+  meta_from_kv = true
 }
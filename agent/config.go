@@ -3,6 +3,7 @@ package agent
 import (
 	"bytes"
 	"fmt"
+	"github.com/akaspin/soil/agent/meta"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"io"
@@ -11,8 +12,9 @@ import (
 
 // Agent - specific config
 type Config struct {
-	Meta   map[string]string `hcl:"meta" json:"meta"`
-	System map[string]string `hcl:"system" json:"system"`
+	Meta        map[string]string   `hcl:"meta" json:"meta"`
+	MetaSources []meta.SourceConfig `hcl:"meta_source" json:"meta_source,omitempty"`
+	System      map[string]string   `hcl:"system" json:"system"`
 }
 
 func DefaultConfig() (c *Config) {
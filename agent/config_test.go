@@ -4,6 +4,7 @@ package agent_test
 
 import (
 	"github.com/akaspin/soil/agent"
+	"github.com/akaspin/soil/agent/meta"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -61,4 +62,14 @@ func TestConfig_Unmarshal(t *testing.T) {
 			},
 		}, config)
 	})
+	t.Run("meta_source", func(t *testing.T) {
+		config := agent.DefaultConfig()
+		assert.NoError(t, config.Read("testdata/config_meta_source.hcl"))
+		assert.Equal(t, map[string]string{"rack": "left"}, config.Meta)
+		assert.Equal(t, []meta.SourceConfig{
+			{Kind: meta.SourceEnv, Prefix: "SOIL_META_"},
+			{Kind: meta.SourceFile, Path: "/etc/soil/meta.json", Interval: "5s"},
+			{Kind: meta.SourceExec, Command: "/usr/local/bin/facts --json", Interval: "1m", Timeout: "10s"},
+		}, config.MetaSources)
+	})
 }
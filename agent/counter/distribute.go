@@ -0,0 +1,54 @@
+package counter
+
+import "sort"
+
+// Claim is stored in cluster as "counter/<pod>/<node>"
+type Claim struct {
+	Want  int // Slots wanted by node
+	Slots int // Slots held by node
+}
+
+// Distribute distributes count slots between claims by node ID. Slots which
+// are already held are honored first in order of node ID. Remaining slots are
+// spread round-robin between nodes which want more slots.
+func Distribute(count int, claims map[string]Claim) (res map[string]int) {
+	res = map[string]int{}
+	var nodes []string
+	for node := range claims {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	remaining := count
+	for _, node := range nodes {
+		claim := claims[node]
+		take := claim.Slots
+		if take > claim.Want {
+			take = claim.Want
+		}
+		if take > remaining {
+			take = remaining
+		}
+		if take > 0 {
+			res[node] = take
+			remaining -= take
+		}
+	}
+	for remaining > 0 {
+		var progress bool
+		for _, node := range nodes {
+			if remaining == 0 {
+				break
+			}
+			if res[node] < claims[node].Want {
+				res[node]++
+				remaining--
+				progress = true
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+// +build ide test_unit
+
+package counter_test
+
+import (
+	"github.com/akaspin/soil/agent/counter"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDistribute(t *testing.T) {
+	t.Run(`empty`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{}, counter.Distribute(2, nil))
+	})
+	t.Run(`by node id`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{
+			"1": 1,
+			"2": 1,
+		}, counter.Distribute(2, map[string]counter.Claim{
+			"3": {Want: 1},
+			"2": {Want: 1},
+			"1": {Want: 1},
+		}))
+	})
+	t.Run(`held first`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{
+			"1": 1,
+			"3": 1,
+		}, counter.Distribute(2, map[string]counter.Claim{
+			"3": {Want: 1, Slots: 1},
+			"2": {Want: 1},
+			"1": {Want: 1},
+		}))
+	})
+	t.Run(`over allocated`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{
+			"2": 1,
+		}, counter.Distribute(1, map[string]counter.Claim{
+			"3": {Want: 1, Slots: 1},
+			"2": {Want: 1, Slots: 1},
+		}))
+	})
+	t.Run(`max per node`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{
+			"1": 3,
+			"2": 2,
+		}, counter.Distribute(5, map[string]counter.Claim{
+			"1": {Want: 3},
+			"2": {Want: 3},
+		}))
+	})
+	t.Run(`not enough nodes`, func(t *testing.T) {
+		assert.Equal(t, map[string]int{
+			"1": 2,
+			"2": 1,
+		}, counter.Distribute(5, map[string]counter.Claim{
+			"1": {Want: 2},
+			"2": {Want: 1},
+		}))
+	})
+}
@@ -0,0 +1,271 @@
+package counter
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/bus/pipe"
+	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/supervisor"
+	"strconv"
+	"strings"
+)
+
+type EvaluatorConfig struct {
+	Store      bus.Consumer // Volatile cluster store for "counter.<pod>" claims
+	Downstream bus.Consumer // Consumer for "counter.<pod>.*"
+}
+
+// Counter evaluator claims slots for counted pods in cluster. Evaluator
+// publishes own claims to cluster store and consumes claims from all nodes
+// from cluster watch. Downstream is notified with
+//
+//	counter.<pod>.allocated = true|false
+//	counter.<pod>.slots = "<slots held by node>"
+type Evaluator struct {
+	*supervisor.Control
+	log        *logx.Log
+	config     EvaluatorConfig
+	downstream bus.Consumer
+
+	nodeID    string
+	synced    bool                        // claims are received from cluster
+	pods      map[string]*manifest.Pod    // pods passed local constraints
+	dirty     map[string]struct{}         // recovered pods
+	held      map[string]int              // slots held by node
+	published map[string]Claim            // claims published to cluster
+	claims    map[string]map[string]Claim // claims from cluster by pod and node
+
+	configChan     chan string
+	allocateChan   chan *manifest.Pod
+	deallocateChan chan string
+	claimsChan     chan map[string]map[string]Claim
+}
+
+func NewEvaluator(ctx context.Context, log *logx.Log, config EvaluatorConfig, state allocation.PodSlice) (e *Evaluator) {
+	e = &Evaluator{
+		Control:        supervisor.NewControl(ctx),
+		log:            log.GetLog("counter", "evaluator"),
+		config:         config,
+		downstream:     pipe.NewLift("counter", config.Downstream),
+		pods:           map[string]*manifest.Pod{},
+		dirty:          map[string]struct{}{},
+		held:           map[string]int{},
+		published:      map[string]Claim{},
+		claims:         map[string]map[string]Claim{},
+		configChan:     make(chan string),
+		allocateChan:   make(chan *manifest.Pod),
+		deallocateChan: make(chan string),
+		claimsChan:     make(chan map[string]map[string]Claim),
+	}
+	for _, pod := range state {
+		if pod.Namespace == manifest.PublicNamespace && pod.Slots > 0 {
+			e.dirty[pod.Name] = struct{}{}
+			e.held[pod.Name] = pod.Slots
+		}
+	}
+	return
+}
+
+func (e *Evaluator) Open() (err error) {
+	go e.loop()
+	resetData := map[string]map[string]string{}
+	for name := range e.dirty {
+		resetData[name] = map[string]string{
+			"allocated": "true",
+			"slots":     strconv.Itoa(e.held[name]),
+		}
+	}
+	if err = e.downstream.ConsumeMessage(bus.NewMessage("", resetData)); err != nil {
+		e.log.Error(err)
+	}
+	err = e.Control.Open()
+	return
+}
+
+// Configure sets node ID used to identify own claims in cluster
+func (e *Evaluator) Configure(config cluster.Config) {
+	select {
+	case <-e.Control.Ctx().Done():
+		e.log.Warningf(`skip configure: %v`, e.Control.Ctx().Err())
+	case e.configChan <- config.NodeID:
+		e.log.Tracef(`configure: %s`, config.NodeID)
+	}
+}
+
+// Returns base constraint for counted pods without pairs referencing
+// namespaces which are not available to counter arbiter. For other pods
+// GetConstraint adds constraint "__counter.allocate = false".
+func (e *Evaluator) GetConstraint(pod *manifest.Pod) manifest.Constraint {
+	if !pod.IsCounted() {
+		return pod.Constraint.Merge(manifest.Constraint{
+			"__counter.allocate": "= false",
+		})
+	}
+	return pod.Constraint.FilterOut("provision.", "resource.", "provider.", "counter.")
+}
+
+// Allocate claims slots for pod in cluster
+func (e *Evaluator) Allocate(pod *manifest.Pod, env map[string]string) {
+	go func() {
+		select {
+		case <-e.Control.Ctx().Done():
+			e.log.Warningf(`skip allocate "%s": %v`, pod.Name, e.Control.Ctx().Err())
+		case e.allocateChan <- pod:
+			e.log.Tracef(`allocate sent: "%s"`, pod.Name)
+		}
+	}()
+}
+
+// Deallocate releases all slots held by pod
+func (e *Evaluator) Deallocate(name string) {
+	go func() {
+		select {
+		case <-e.Control.Ctx().Done():
+			e.log.Warningf(`skip deallocate "%s": %v`, name, e.Control.Ctx().Err())
+		case e.deallocateChan <- name:
+			e.log.Tracef(`deallocate sent: "%s"`, name)
+		}
+	}()
+}
+
+// ConsumeMessage accepts claims from cluster watch in form
+// "<pod>/<node>":{"Want":1,"Slots":1}
+func (e *Evaluator) ConsumeMessage(message bus.Message) (err error) {
+	var data map[string]Claim
+	if err = message.Payload().Unmarshal(&data); err != nil {
+		e.log.Error(err)
+		return
+	}
+	claims := map[string]map[string]Claim{}
+	for key, claim := range data {
+		split := strings.SplitN(key, "/", 2)
+		if len(split) != 2 {
+			e.log.Warningf(`skip claim "%s": bad key`, key)
+			continue
+		}
+		if _, ok := claims[split[0]]; !ok {
+			claims[split[0]] = map[string]Claim{}
+		}
+		claims[split[0]][split[1]] = claim
+	}
+	select {
+	case <-e.Control.Ctx().Done():
+		e.log.Warningf(`skip claims: %v`, e.Control.Ctx().Err())
+	case e.claimsChan <- claims:
+		e.log.Tracef(`claims sent: %v`, claims)
+	}
+	return
+}
+
+func (e *Evaluator) loop() {
+	log := e.log.WithTags("evaluator", "loop")
+	log.Trace("open")
+LOOP:
+	for {
+		select {
+		case <-e.Control.Ctx().Done():
+			break LOOP
+		case nodeID := <-e.configChan:
+			if nodeID == e.nodeID {
+				continue LOOP
+			}
+			log.Debugf(`node id changed: %s->%s`, e.nodeID, nodeID)
+			e.nodeID = nodeID
+			e.evaluateAll()
+		case pod := <-e.allocateChan:
+			delete(e.dirty, pod.Name)
+			e.pods[pod.Name] = pod
+			e.evaluate(pod.Name)
+		case name := <-e.deallocateChan:
+			delete(e.dirty, name)
+			delete(e.pods, name)
+			e.evaluate(name)
+		case claims := <-e.claimsChan:
+			e.claims = claims
+			e.synced = true
+			e.evaluateAll()
+		}
+	}
+	log.Trace("close")
+}
+
+func (e *Evaluator) evaluateAll() {
+	names := map[string]struct{}{}
+	for name := range e.pods {
+		names[name] = struct{}{}
+	}
+	for name := range e.held {
+		names[name] = struct{}{}
+	}
+	for name := range names {
+		e.evaluate(name)
+	}
+}
+
+func (e *Evaluator) evaluate(name string) {
+	if _, isDirty := e.dirty[name]; isDirty {
+		e.log.Tracef(`skip evaluate "%s": dirty`, name)
+		return
+	}
+	pod, ok := e.pods[name]
+	if !ok {
+		delete(e.held, name)
+		e.publish(name, nil)
+		e.downstream.ConsumeMessage(bus.NewMessage(name, nil))
+		e.log.Debugf(`released "%s"`, name)
+		return
+	}
+	want := pod.MaxPerNode
+	if want < 1 {
+		want = 1
+	}
+	if want > pod.Count {
+		want = pod.Count
+	}
+	slots := e.held[name]
+	if slots > want {
+		slots = want
+	}
+	if e.synced && e.nodeID != "" {
+		claims := map[string]Claim{}
+		for node, claim := range e.claims[name] {
+			claims[node] = claim
+		}
+		claims[e.nodeID] = Claim{
+			Want:  want,
+			Slots: slots,
+		}
+		slots = Distribute(pod.Count, claims)[e.nodeID]
+	}
+	if slots != e.held[name] {
+		e.log.Infof(`"%s" slots changed: %d->%d (count:%d)`, name, e.held[name], slots, pod.Count)
+	}
+	e.held[name] = slots
+	e.publish(name, &Claim{
+		Want:  want,
+		Slots: slots,
+	})
+	e.downstream.ConsumeMessage(bus.NewMessage(name, map[string]string{
+		"allocated": strconv.FormatBool(slots > 0),
+		"slots":     strconv.Itoa(slots),
+	}))
+}
+
+func (e *Evaluator) publish(name string, claim *Claim) {
+	published, exists := e.published[name]
+	if claim == nil {
+		if exists {
+			delete(e.published, name)
+			e.config.Store.ConsumeMessage(bus.NewMessage(name, nil))
+		}
+		return
+	}
+	if exists && published == *claim {
+		return
+	}
+	e.published[name] = *claim
+	e.config.Store.ConsumeMessage(bus.NewMessage(name, *claim))
+}
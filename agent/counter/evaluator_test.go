@@ -0,0 +1,163 @@
+// +build ide test_unit
+
+package counter_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/counter"
+	"github.com/akaspin/soil/fixture"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := bus.NewTestingConsumer(ctx)
+	downstream := bus.NewTestingConsumer(ctx)
+	evaluator := counter.NewEvaluator(ctx, logx.GetLog("test"), counter.EvaluatorConfig{
+		Store:      store,
+		Downstream: downstream,
+	}, nil)
+	assert.NoError(t, evaluator.Open())
+
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	assert.NoError(t, buffers.ReadFiles("testdata/evaluator_test_0.hcl"))
+	assert.NoError(t, pods.Unmarshal(manifest.PublicNamespace, buffers.GetReaders()...))
+
+	t.Run(`0 open`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, downstream.ExpectMessagesFn(
+			bus.NewMessage("counter", map[string]string{}),
+		))
+	})
+	t.Run(`1 allocate before sync`, func(t *testing.T) {
+		evaluator.Configure(cluster.Config{NodeID: "node-1"})
+		for _, pod := range pods {
+			evaluator.Allocate(pod, nil)
+		}
+		fixture.WaitNoErrorT10(t, store.ExpectMessagesByIdFn(map[string][]bus.Message{
+			"counted": {
+				bus.NewMessage("counted", counter.Claim{Want: 1}),
+			},
+			"spread": {
+				bus.NewMessage("spread", counter.Claim{Want: 2}),
+			},
+		}))
+		fixture.WaitNoErrorT10(t, downstream.ExpectLastMessageFn(bus.NewMessage("counter", map[string]string{
+			"counted.allocated": "false",
+			"counted.slots":     "0",
+			"spread.allocated":  "false",
+			"spread.slots":      "0",
+		})))
+	})
+	t.Run(`2 sync`, func(t *testing.T) {
+		evaluator.ConsumeMessage(bus.NewMessage("counter", map[string]interface{}{
+			"counted/node-2": counter.Claim{Want: 1, Slots: 1},
+			"spread/node-2":  counter.Claim{Want: 2},
+		}))
+		fixture.WaitNoErrorT10(t, store.ExpectMessagesByIdFn(map[string][]bus.Message{
+			"counted": {
+				bus.NewMessage("counted", counter.Claim{Want: 1}),
+			},
+			"spread": {
+				bus.NewMessage("spread", counter.Claim{Want: 2}),
+				bus.NewMessage("spread", counter.Claim{Want: 2, Slots: 2}),
+			},
+		}))
+		fixture.WaitNoErrorT10(t, downstream.ExpectLastMessageFn(bus.NewMessage("counter", map[string]string{
+			"counted.allocated": "false",
+			"counted.slots":     "0",
+			"spread.allocated":  "true",
+			"spread.slots":      "2",
+		})))
+	})
+	t.Run(`3 node-2 leaves`, func(t *testing.T) {
+		evaluator.ConsumeMessage(bus.NewMessage("counter", map[string]interface{}{
+			"counted/node-1": counter.Claim{Want: 1},
+			"spread/node-1":  counter.Claim{Want: 2, Slots: 2},
+		}))
+		fixture.WaitNoErrorT10(t, store.ExpectMessagesByIdFn(map[string][]bus.Message{
+			"counted": {
+				bus.NewMessage("counted", counter.Claim{Want: 1}),
+				bus.NewMessage("counted", counter.Claim{Want: 1, Slots: 1}),
+			},
+			"spread": {
+				bus.NewMessage("spread", counter.Claim{Want: 2}),
+				bus.NewMessage("spread", counter.Claim{Want: 2, Slots: 2}),
+			},
+		}))
+		fixture.WaitNoErrorT10(t, downstream.ExpectLastMessageFn(bus.NewMessage("counter", map[string]string{
+			"counted.allocated": "true",
+			"counted.slots":     "1",
+			"spread.allocated":  "true",
+			"spread.slots":      "2",
+		})))
+	})
+	t.Run(`4 deallocate`, func(t *testing.T) {
+		evaluator.Deallocate("counted")
+		fixture.WaitNoErrorT10(t, store.ExpectMessagesByIdFn(map[string][]bus.Message{
+			"counted": {
+				bus.NewMessage("counted", counter.Claim{Want: 1}),
+				bus.NewMessage("counted", counter.Claim{Want: 1, Slots: 1}),
+				bus.NewMessage("counted", nil),
+			},
+			"spread": {
+				bus.NewMessage("spread", counter.Claim{Want: 2}),
+				bus.NewMessage("spread", counter.Claim{Want: 2, Slots: 2}),
+			},
+		}))
+		fixture.WaitNoErrorT10(t, downstream.ExpectLastMessageFn(bus.NewMessage("counter", map[string]string{
+			"spread.allocated": "true",
+			"spread.slots":     "2",
+		})))
+	})
+}
+
+func TestEvaluator_Recover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	state := allocation.PodSlice{
+		{Header: allocation.Header{Name: "counted", Namespace: manifest.PublicNamespace, Slots: 2}},
+		{Header: allocation.Header{Name: "plain", Namespace: manifest.PublicNamespace}},
+		{Header: allocation.Header{Name: "private", Namespace: manifest.PrivateNamespace}},
+	}
+	downstream := bus.NewTestingConsumer(ctx)
+	evaluator := counter.NewEvaluator(ctx, logx.GetLog("test"), counter.EvaluatorConfig{
+		Store:      bus.NewTestingConsumer(ctx),
+		Downstream: downstream,
+	}, state)
+	assert.NoError(t, evaluator.Open())
+
+	fixture.WaitNoErrorT10(t, downstream.ExpectMessagesFn(
+		bus.NewMessage("counter", map[string]string{
+			"counted.allocated": "true",
+			"counted.slots":     "2",
+		}),
+	))
+}
+
+func TestEvaluator_GetConstraint(t *testing.T) {
+	evaluator := counter.NewEvaluator(context.Background(), logx.GetLog("test"), counter.EvaluatorConfig{}, nil)
+	pod := &manifest.Pod{
+		Namespace: manifest.PublicNamespace,
+		Name:      "counted",
+		Count:     1,
+		Constraint: manifest.Constraint{
+			"${meta.consul}":                     "true",
+			"${provision.other.present}":         "true",
+			"${resource.counted.port.allocated}": "true",
+		},
+	}
+	assert.Equal(t, manifest.Constraint{
+		"${meta.consul}": "true",
+	}, evaluator.GetConstraint(pod))
+}
@@ -0,0 +1,8 @@
+pod "counted" {
+  count = 1
+}
+
+pod "spread" {
+  count = 3
+  max_per_node = 2
+}
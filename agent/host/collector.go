@@ -0,0 +1,93 @@
+package host
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/supervisor"
+	"reflect"
+	"time"
+)
+
+const refreshInterval = time.Minute
+
+type CollectorConfig struct {
+	Downstream bus.Consumer  // Consumer for "host" facts
+	Interval   time.Duration // Optional refresh interval
+	Root       string        // Optional root for /proc, /sys and /etc
+}
+
+// Collector periodically collects host facts and notifies downstream with
+// "host" message if facts are changed.
+type Collector struct {
+	*supervisor.Control
+	log    *logx.Log
+	config CollectorConfig
+
+	facts       map[string]string
+	refreshChan chan struct{}
+}
+
+func NewCollector(ctx context.Context, log *logx.Log, config CollectorConfig) (c *Collector) {
+	c = &Collector{
+		Control:     supervisor.NewControl(ctx),
+		log:         log.GetLog("host", "collector"),
+		config:      config,
+		refreshChan: make(chan struct{}, 1),
+	}
+	if c.config.Interval == 0 {
+		c.config.Interval = refreshInterval
+	}
+	if c.config.Root == "" {
+		c.config.Root = "/"
+	}
+	return
+}
+
+func (c *Collector) Open() (err error) {
+	c.collect()
+	go c.loop()
+	err = c.Control.Open()
+	return
+}
+
+// Refresh requests facts collection
+func (c *Collector) Refresh() {
+	select {
+	case c.refreshChan <- struct{}{}:
+	default:
+		// refresh is already pending
+	}
+}
+
+func (c *Collector) loop() {
+	log := c.log.WithTags("collector", "loop")
+	log.Trace("open")
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+LOOP:
+	for {
+		select {
+		case <-c.Control.Ctx().Done():
+			break LOOP
+		case <-c.refreshChan:
+			c.collect()
+		case <-ticker.C:
+			c.collect()
+		}
+	}
+	log.Trace("close")
+}
+
+func (c *Collector) collect() {
+	facts := Collect(c.config.Root)
+	if reflect.DeepEqual(facts, c.facts) {
+		return
+	}
+	c.facts = facts
+	c.log.Debugf("facts changed: %v", facts)
+	if err := c.config.Downstream.ConsumeMessage(bus.NewMessage("host", facts)); err != nil {
+		c.log.Error(err)
+	}
+}
@@ -0,0 +1,53 @@
+// +build ide test_unit
+
+package host_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/host"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	writeFact := func(path, value string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(root, path), []byte(value), 0644))
+	}
+	writeFact("proc/meminfo", "MemTotal:        8167932 kB\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cons := bus.NewTestingConsumer(ctx)
+	collector := host.NewCollector(ctx, logx.GetLog("test"), host.CollectorConfig{
+		Downstream: cons,
+		Interval:   time.Hour,
+		Root:       root,
+	})
+	assert.NoError(t, collector.Open())
+
+	t.Run(`0 open`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("host", host.Collect(root))))
+		assert.Equal(t, "7976", host.Collect(root)["memory_mb"])
+	})
+	t.Run(`1 refresh`, func(t *testing.T) {
+		writeFact("proc/meminfo", "MemTotal:        4194304 kB\n")
+		collector.Refresh()
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("host", host.Collect(root))))
+		assert.Equal(t, "4096", host.Collect(root)["memory_mb"])
+	})
+
+	collector.Close()
+	collector.Wait()
+}
@@ -0,0 +1,180 @@
+package host
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Collect returns host facts read from /proc, /sys, /etc/os-release and
+// network interfaces. Root is used as prefix for all paths. Missing sources
+// are skipped.
+//
+//	hostname = "<hostname>"
+//	arch = "<GOARCH>"
+//	kernel.version = "<osrelease>"
+//	cpu_count = "<number of processors>"
+//	memory_mb = "<total memory in MiB>"
+//	os.id, os.version_id, os.name = "<os-release ID, VERSION_ID, PRETTY_NAME>"
+//	dmi.sys_vendor, dmi.product_name = "<DMI values>"
+//	net.interfaces = "<comma-separated interfaces>"
+//	net.<iface>.mac, net.<iface>.ipv4, net.<iface>.ipv6 = "<addresses>"
+func Collect(root string) (res map[string]string) {
+	res = map[string]string{
+		"arch": runtime.GOARCH,
+	}
+	if value, err := readValue(root, "proc/sys/kernel/hostname"); err == nil {
+		res["hostname"] = value
+	} else if value, err = os.Hostname(); err == nil {
+		res["hostname"] = value
+	}
+	if value, err := readValue(root, "proc/sys/kernel/osrelease"); err == nil {
+		res["kernel.version"] = value
+	}
+	res["cpu_count"] = strconv.Itoa(cpuCount(root))
+	if memory, ok := memoryMB(root); ok {
+		res["memory_mb"] = strconv.FormatUint(memory, 10)
+	}
+	osRelease := readOSRelease(root)
+	for key, field := range map[string]string{
+		"os.id":         "ID",
+		"os.version_id": "VERSION_ID",
+		"os.name":       "PRETTY_NAME",
+	} {
+		if value, ok := osRelease[field]; ok {
+			res[key] = value
+		}
+	}
+	for _, key := range []string{"sys_vendor", "product_name"} {
+		if value, err := readValue(root, "sys/class/dmi/id/"+key); err == nil && value != "" {
+			res["dmi."+key] = value
+		}
+	}
+	collectNetwork(res)
+	return
+}
+
+func readValue(root, path string) (res string, err error) {
+	buf, err := ioutil.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return
+	}
+	res = strings.TrimSpace(string(buf))
+	return
+}
+
+// cpuCount returns number of processors in /proc/cpuinfo or number of CPUs
+// available to process
+func cpuCount(root string) (res int) {
+	f, err := os.Open(filepath.Join(root, "proc/cpuinfo"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if key := strings.SplitN(scanner.Text(), ":", 2)[0]; strings.TrimSpace(key) == "processor" {
+				res++
+			}
+		}
+	}
+	if res == 0 {
+		res = runtime.NumCPU()
+	}
+	return
+}
+
+// memoryMB returns MemTotal from /proc/meminfo in MiB
+func memoryMB(root string) (res uint64, ok bool) {
+	f, err := os.Open(filepath.Join(root, "proc/meminfo"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		var kb uint64
+		if kb, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return
+		}
+		res, ok = kb/1024, true
+		return
+	}
+	return
+}
+
+// readOSRelease returns fields from /etc/os-release with unquoted values
+func readOSRelease(root string) (res map[string]string) {
+	res = map[string]string{}
+	f, err := os.Open(filepath.Join(root, "etc/os-release"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.SplitN(line, "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+		value := split[1]
+		if unquoted, unquoteErr := strconv.Unquote(value); unquoteErr == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		res[split[0]] = value
+	}
+	return
+}
+
+func collectNetwork(res map[string]string) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, iface := range interfaces {
+		names = append(names, iface.Name)
+		prefix := "net." + iface.Name + "."
+		if mac := iface.HardwareAddr.String(); mac != "" {
+			res[prefix+"mac"] = mac
+		}
+		addrs, addrErr := iface.Addrs()
+		if addrErr != nil {
+			continue
+		}
+		var ipv4, ipv6 []string
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				ipv4 = append(ipv4, ipNet.IP.String())
+				continue
+			}
+			ipv6 = append(ipv6, ipNet.IP.String())
+		}
+		if len(ipv4) > 0 {
+			res[prefix+"ipv4"] = strings.Join(ipv4, ",")
+		}
+		if len(ipv6) > 0 {
+			res[prefix+"ipv6"] = strings.Join(ipv6, ",")
+		}
+	}
+	sort.Strings(names)
+	res["net.interfaces"] = strings.Join(names, ",")
+}
@@ -0,0 +1,38 @@
+// +build ide test_unit
+
+package host_test
+
+import (
+	"github.com/akaspin/soil/agent/host"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	t.Run(`root`, func(t *testing.T) {
+		res := host.Collect("testdata/root")
+		for k, v := range map[string]string{
+			"hostname":       "test-host",
+			"arch":           runtime.GOARCH,
+			"kernel.version": "4.15.0-20-generic",
+			"cpu_count":      "2",
+			"memory_mb":      "7976",
+			"os.id":          "ubuntu",
+			"os.version_id":  "18.04",
+			"os.name":        "Ubuntu 18.04 LTS",
+			"dmi.sys_vendor": "QEMU",
+		} {
+			assert.Equal(t, v, res[k], k)
+		}
+		assert.NotContains(t, res, "dmi.product_name")
+		assert.Contains(t, res, "net.interfaces")
+	})
+	t.Run(`missing`, func(t *testing.T) {
+		res := host.Collect("testdata/missing")
+		assert.NotEmpty(t, res["hostname"])
+		assert.NotEmpty(t, res["cpu_count"])
+		assert.NotContains(t, res, "memory_mb")
+		assert.NotContains(t, res, "os.id")
+	})
+}
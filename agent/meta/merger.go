@@ -0,0 +1,263 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/supervisor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Merger merges meta layers and notifies downstream with "meta" message.
+// Layers are applied in order:
+//
+//  1. Static meta from configuration
+//  2. Meta sources in definition order
+//  3. "meta/<node_id>" record from cluster KV if enabled
+//  4. Runtime meta set by API
+//
+// Changes in any layer are sent to downstream.
+type Merger struct {
+	*supervisor.Control
+	log         *logx.Log
+	downstream  bus.Consumer
+	runtimePath string
+
+	mu         sync.Mutex
+	configured bool
+	static     map[string]string
+	sources    []map[string]string // last known values by source
+	kvNode     string
+	kv         map[string]map[string]string // KV records by node
+	runtime    map[string]string
+	last       map[string]string
+	cancel     context.CancelFunc
+}
+
+// NewMerger creates merger. Runtime meta is persisted to runtimePath if it
+// is not empty.
+func NewMerger(ctx context.Context, log *logx.Log, downstream bus.Consumer, runtimePath string) (m *Merger) {
+	m = &Merger{
+		Control:     supervisor.NewControl(ctx),
+		log:         log.GetLog("meta", "merger"),
+		downstream:  downstream,
+		runtimePath: runtimePath,
+		kv:          map[string]map[string]string{},
+		runtime:     map[string]string{},
+	}
+	if runtimePath != "" {
+		buf, err := ioutil.ReadFile(runtimePath)
+		if err == nil {
+			err = json.Unmarshal(buf, &m.runtime)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			m.log.Errorf("restore runtime meta: %v", err)
+		}
+	}
+	return
+}
+
+// Configure replaces static meta and sources. All sources are collected
+// before downstream is notified. Values from cluster KV are applied only if
+// kvNode is not empty.
+func (m *Merger) Configure(static map[string]string, configs []SourceConfig, kvNode string) {
+	var sources []source
+	for _, config := range configs {
+		src, err := newSource(config)
+		if err != nil {
+			m.log.Error(err)
+			continue
+		}
+		sources = append(sources, src)
+	}
+	values := make([]map[string]string, len(sources))
+	for i, src := range sources {
+		var err error
+		if values[i], err = src.collect(); err != nil {
+			m.log.Errorf(`meta_source %s: %v`, src.name, err)
+		}
+	}
+
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	ctx, cancel := context.WithCancel(m.Control.Ctx())
+	m.cancel = cancel
+	m.configured = true
+	m.static = lib.CloneMap(static)
+	m.sources = values
+	m.kvNode = kvNode
+	m.notify(true)
+	m.mu.Unlock()
+
+	for i, src := range sources {
+		if src.interval > 0 {
+			go m.watch(ctx, i, src)
+		}
+	}
+}
+
+// watch polls source until context is done. Last known values are kept on
+// failures.
+func (m *Merger) watch(ctx context.Context, index int, src source) {
+	log := m.log.WithTags("source", src.name)
+	log.Trace("open")
+	ticker := time.NewTicker(src.interval)
+	defer ticker.Stop()
+
+LOOP:
+	for {
+		select {
+		case <-ctx.Done():
+			break LOOP
+		case <-ticker.C:
+			values, err := src.collect()
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			m.mu.Lock()
+			if ctx.Err() == nil {
+				m.sources[index] = values
+				m.notify(false)
+			}
+			m.mu.Unlock()
+		}
+	}
+	log.Trace("close")
+}
+
+// Meta returns last merged meta
+func (m *Merger) Meta() (res map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res = lib.CloneMap(m.last)
+	return
+}
+
+// ConsumeMessage accepts "meta" records from cluster KV
+func (m *Merger) ConsumeMessage(message bus.Message) (err error) {
+	var records map[string]interface{}
+	if err = message.Payload().Unmarshal(&records); err != nil {
+		m.log.Error(err)
+		return
+	}
+	kv := map[string]map[string]string{}
+	for node, record := range records {
+		values, ok := record.(map[string]interface{})
+		if !ok {
+			m.log.Warningf(`skip KV meta for "%s": should be an object`, node)
+			continue
+		}
+		kv[node] = map[string]string{}
+		flatten(kv[node], "", values)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kv = kv
+	m.notify(false)
+	return
+}
+
+// SetRuntime sets runtime meta keys and persists them
+func (m *Merger) SetRuntime(values map[string]string) (err error) {
+	for k := range values {
+		if k == "" {
+			err = fmt.Errorf("empty meta key")
+			return
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runtime := lib.CloneMap(m.runtime)
+	for k, v := range values {
+		runtime[k] = v
+	}
+	if err = m.persist(runtime); err != nil {
+		return
+	}
+	m.runtime = runtime
+	m.notify(false)
+	return
+}
+
+// DeleteRuntime removes runtime meta keys
+func (m *Merger) DeleteRuntime(keys ...string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runtime := lib.CloneMap(m.runtime)
+	for _, k := range keys {
+		delete(runtime, k)
+	}
+	if err = m.persist(runtime); err != nil {
+		return
+	}
+	m.runtime = runtime
+	m.notify(false)
+	return
+}
+
+// persist writes runtime meta to temporary file and renames it
+func (m *Merger) persist(runtime map[string]string) (err error) {
+	if m.runtimePath == "" {
+		return
+	}
+	buf, err := json.Marshal(runtime)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(m.runtimePath), 0755); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.runtimePath), "."+filepath.Base(m.runtimePath)+".")
+	if err != nil {
+		return
+	}
+	if _, err = tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	err = os.Rename(tmp.Name(), m.runtimePath)
+	return
+}
+
+// notify sends merged meta to downstream if it is changed or force is true.
+// Downstream is not notified before first Configure. Should be called with
+// lock.
+func (m *Merger) notify(force bool) {
+	if !m.configured {
+		return
+	}
+	merged := lib.CloneMap(m.static)
+	layers := append([]map[string]string{}, m.sources...)
+	if m.kvNode != "" {
+		layers = append(layers, m.kv[m.kvNode])
+	}
+	for _, values := range append(layers, m.runtime) {
+		for k, v := range values {
+			merged[k] = v
+		}
+	}
+	if !force && reflect.DeepEqual(merged, m.last) {
+		return
+	}
+	m.last = merged
+	m.log.Debugf("meta: %v", merged)
+	if err := m.downstream.ConsumeMessage(bus.NewMessage("meta", merged)); err != nil {
+		m.log.Error(err)
+	}
+}
@@ -0,0 +1,168 @@
+// +build ide test_unit
+
+package meta_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/meta"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMerger_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "meta.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"rack": "rack-1"}`), 0644))
+
+	cons := bus.NewTestingConsumer(ctx)
+	merger := meta.NewMerger(ctx, logx.GetLog("test"), cons, "")
+	merger.Open()
+	defer merger.Close()
+
+	merger.Configure(map[string]string{"static": "true"}, []meta.SourceConfig{
+		{Kind: meta.SourceFile, Path: path, Interval: "50ms"},
+	}, "")
+	t.Run(`0 configure`, func(t *testing.T) {
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-1"}),
+		))
+	})
+	t.Run(`1 change`, func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(`{"rack": "rack-2"}`), 0644))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-1"}),
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-2"}),
+		))
+	})
+	t.Run(`2 remove`, func(t *testing.T) {
+		assert.NoError(t, os.Remove(path))
+		time.Sleep(time.Millisecond * 200)
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-1"}),
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-2"}),
+		))
+	})
+	t.Run(`3 reconfigure`, func(t *testing.T) {
+		merger.Configure(map[string]string{"static": "true"}, nil, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-1"}),
+			bus.NewMessage("meta", map[string]string{"static": "true", "rack": "rack-2"}),
+			bus.NewMessage("meta", map[string]string{"static": "true"}),
+		))
+	})
+}
+
+func TestMerger_KV(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cons := bus.NewTestingConsumer(ctx)
+	merger := meta.NewMerger(ctx, logx.GetLog("test"), cons, "")
+	merger.Open()
+	defer merger.Close()
+
+	t.Run(`0 not configured`, func(t *testing.T) {
+		merger.ConsumeMessage(bus.NewMessage("meta", map[string]interface{}{
+			"node-1": map[string]interface{}{"rack": "rack-kv"},
+		}))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn())
+	})
+	t.Run(`1 disabled`, func(t *testing.T) {
+		merger.Configure(map[string]string{"rack": "static"}, nil, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+		))
+	})
+	t.Run(`2 enabled`, func(t *testing.T) {
+		merger.Configure(map[string]string{"rack": "static"}, nil, "node-1")
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv"}),
+		))
+	})
+	t.Run(`3 other node`, func(t *testing.T) {
+		merger.ConsumeMessage(bus.NewMessage("meta", map[string]interface{}{
+			"node-1": map[string]interface{}{"rack": "rack-kv"},
+			"node-2": map[string]interface{}{"rack": "rack-2"},
+			"node-3": "bad",
+		}))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv"}),
+		))
+	})
+	t.Run(`4 change`, func(t *testing.T) {
+		merger.ConsumeMessage(bus.NewMessage("meta", map[string]interface{}{
+			"node-1": map[string]interface{}{"rack": "rack-kv", "gpu": map[string]interface{}{"count": 2}},
+		}))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv", "gpu.count": "2"}),
+		))
+	})
+	t.Run(`5 remove`, func(t *testing.T) {
+		merger.ConsumeMessage(bus.NewMessage("meta", map[string]interface{}{}))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv"}),
+			bus.NewMessage("meta", map[string]string{"rack": "rack-kv", "gpu.count": "2"}),
+			bus.NewMessage("meta", map[string]string{"rack": "static"}),
+		))
+	})
+}
+
+func TestMerger_Runtime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "meta.json")
+
+	cons := bus.NewTestingConsumer(ctx)
+	merger := meta.NewMerger(ctx, logx.GetLog("test"), cons, path)
+	merger.Open()
+	defer merger.Close()
+
+	t.Run(`0 set`, func(t *testing.T) {
+		assert.NoError(t, merger.SetRuntime(map[string]string{"rack": "rack-api", "zone": "east"}))
+		merger.Configure(map[string]string{"rack": "static", "static": "true"}, nil, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "rack-api", "zone": "east", "static": "true"}),
+		))
+	})
+	t.Run(`1 empty key`, func(t *testing.T) {
+		assert.Error(t, merger.SetRuntime(map[string]string{"": "1"}))
+	})
+	t.Run(`2 delete`, func(t *testing.T) {
+		assert.NoError(t, merger.DeleteRuntime("rack"))
+		fixture.WaitNoErrorT10(t, cons.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"rack": "rack-api", "zone": "east", "static": "true"}),
+			bus.NewMessage("meta", map[string]string{"rack": "static", "zone": "east", "static": "true"}),
+		))
+	})
+	t.Run(`3 restore`, func(t *testing.T) {
+		cons2 := bus.NewTestingConsumer(ctx)
+		merger2 := meta.NewMerger(ctx, logx.GetLog("test"), cons2, path)
+		merger2.Open()
+		defer merger2.Close()
+		merger2.Configure(map[string]string{"static": "true"}, nil, "")
+		fixture.WaitNoErrorT10(t, cons2.ExpectMessagesFn(
+			bus.NewMessage("meta", map[string]string{"zone": "east", "static": "true"}),
+		))
+	})
+}
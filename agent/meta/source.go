@@ -0,0 +1,209 @@
+package meta
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SourceEnv  = "env"  // prefix-filtered process environment
+	SourceFile = "file" // JSON or key=value file
+	SourceExec = "exec" // command with JSON output
+
+	defaultFileInterval = time.Second * 10
+	defaultExecInterval = time.Minute
+	defaultExecTimeout  = time.Second * 30
+)
+
+// SourceConfig is "meta_source" stanza in agent configuration
+//
+//	meta_source "env" {
+//	  prefix = "SOIL_META_"
+//	}
+//	meta_source "file" {
+//	  path = "/etc/soil/meta.json"
+//	  format = "json"
+//	  interval = "10s"
+//	}
+//	meta_source "exec" {
+//	  command = "/usr/local/bin/facts --json"
+//	  interval = "1m"
+//	  timeout = "30s"
+//	}
+type SourceConfig struct {
+	Kind     string `hcl:",key" json:"kind"`
+	Prefix   string `hcl:"prefix" json:"prefix,omitempty"`     // env prefix
+	Path     string `hcl:"path" json:"path,omitempty"`         // file path
+	Format   string `hcl:"format" json:"format,omitempty"`     // file format: "json" or "kv"
+	Command  string `hcl:"command" json:"command,omitempty"`   // exec command
+	Interval string `hcl:"interval" json:"interval,omitempty"` // file or exec poll interval
+	Timeout  string `hcl:"timeout" json:"timeout,omitempty"`   // exec timeout
+}
+
+type source struct {
+	name     string
+	interval time.Duration // zero interval means what source is collected only on configure
+	collect  func() (map[string]string, error)
+}
+
+func newSource(config SourceConfig) (res source, err error) {
+	switch config.Kind {
+	case SourceEnv:
+		if config.Prefix == "" {
+			err = fmt.Errorf(`meta_source "env": prefix is required`)
+			return
+		}
+		res = source{
+			name: fmt.Sprintf(`env "%s"`, config.Prefix),
+			collect: func() (map[string]string, error) {
+				return collectEnv(config.Prefix, os.Environ()), nil
+			},
+		}
+	case SourceFile:
+		if config.Path == "" {
+			err = fmt.Errorf(`meta_source "file": path is required`)
+			return
+		}
+		format := config.Format
+		if format == "" {
+			format = "kv"
+			if filepath.Ext(config.Path) == ".json" {
+				format = "json"
+			}
+		}
+		if format != "json" && format != "kv" {
+			err = fmt.Errorf(`meta_source "file": unknown format "%s"`, format)
+			return
+		}
+		res = source{
+			name: fmt.Sprintf(`file "%s"`, config.Path),
+			collect: func() (values map[string]string, err error) {
+				buf, err := ioutil.ReadFile(config.Path)
+				if err != nil {
+					return
+				}
+				if format == "json" {
+					values, err = parseJSON(buf)
+					return
+				}
+				values = parseKV(buf)
+				return
+			},
+		}
+		if res.interval, err = parseDuration(config.Interval, defaultFileInterval); err != nil {
+			return
+		}
+	case SourceExec:
+		if config.Command == "" {
+			err = fmt.Errorf(`meta_source "exec": command is required`)
+			return
+		}
+		var timeout time.Duration
+		if timeout, err = parseDuration(config.Timeout, defaultExecTimeout); err != nil {
+			return
+		}
+		res = source{
+			name: fmt.Sprintf(`exec "%s"`, config.Command),
+			collect: func() (values map[string]string, err error) {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				buf, err := exec.CommandContext(ctx, "/bin/sh", "-c", config.Command).Output()
+				if err != nil {
+					return
+				}
+				values, err = parseJSON(buf)
+				return
+			},
+		}
+		if res.interval, err = parseDuration(config.Interval, defaultExecInterval); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf(`meta_source: unknown kind "%s"`, config.Kind)
+	}
+	return
+}
+
+func parseDuration(value string, defaultValue time.Duration) (res time.Duration, err error) {
+	if value == "" {
+		res = defaultValue
+		return
+	}
+	if res, err = time.ParseDuration(value); err == nil && res <= 0 {
+		err = fmt.Errorf("bad duration %s", value)
+	}
+	return
+}
+
+// collectEnv returns environment variables with given prefix. Prefix is
+// stripped and keys are lowercased.
+func collectEnv(prefix string, environ []string) (res map[string]string) {
+	res = map[string]string{}
+	for _, chunk := range environ {
+		split := strings.SplitN(chunk, "=", 2)
+		if len(split) != 2 || !strings.HasPrefix(split[0], prefix) || split[0] == prefix {
+			continue
+		}
+		res[strings.ToLower(strings.TrimPrefix(split[0], prefix))] = split[1]
+	}
+	return
+}
+
+// parseJSON parses JSON object. Nested objects are flattened with "."
+// and other non-string values are returned as JSON.
+func parseJSON(buf []byte) (res map[string]string, err error) {
+	var value map[string]interface{}
+	if err = json.Unmarshal(buf, &value); err != nil {
+		return
+	}
+	res = map[string]string{}
+	flatten(res, "", value)
+	return
+}
+
+func flatten(res map[string]string, prefix string, value map[string]interface{}) {
+	for k, v := range value {
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			flatten(res, prefix+k+".", typed)
+		case string:
+			res[prefix+k] = typed
+		default:
+			buf, _ := json.Marshal(typed)
+			res[prefix+k] = string(buf)
+		}
+	}
+}
+
+// parseKV parses "key=value" lines. Empty lines and lines started with "#"
+// are ignored.
+func parseKV(buf []byte) (res map[string]string) {
+	res = map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.SplitN(line, "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(split[1])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		res[strings.TrimSpace(split[0])] = value
+	}
+	return
+}
@@ -0,0 +1,91 @@
+// +build ide test_unit
+
+package meta_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/meta"
+	"github.com/akaspin/soil/fixture"
+	"os"
+	"testing"
+)
+
+func TestMerger_Configure_Sources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	os.Setenv("TEST_SOURCE_RACK", "rack-env")
+	os.Setenv("TEST_SOURCE_Zone", "west")
+	defer os.Unsetenv("TEST_SOURCE_RACK")
+	defer os.Unsetenv("TEST_SOURCE_Zone")
+
+	cons := bus.NewTestingConsumer(ctx)
+	merger := meta.NewMerger(ctx, logx.GetLog("test"), cons, "")
+	merger.Open()
+	defer merger.Close()
+
+	t.Run(`json`, func(t *testing.T) {
+		merger.Configure(map[string]string{"static": "true"}, []meta.SourceConfig{
+			{Kind: meta.SourceFile, Path: "testdata/meta.json"},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"static":    "true",
+			"rack":      "rack-1",
+			"weight":    "10",
+			"gpu.model": "k80",
+			"gpu.count": "2",
+			"groups":    `["first","second"]`,
+		})))
+	})
+	t.Run(`kv`, func(t *testing.T) {
+		merger.Configure(map[string]string{"static": "true"}, []meta.SourceConfig{
+			{Kind: meta.SourceFile, Path: "testdata/meta.conf"},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"static": "true",
+			"rack":   "rack-1",
+			"zone":   "east",
+		})))
+	})
+	t.Run(`env`, func(t *testing.T) {
+		merger.Configure(map[string]string{"rack": "static"}, []meta.SourceConfig{
+			{Kind: meta.SourceEnv, Prefix: "TEST_SOURCE_"},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"rack": "rack-env",
+			"zone": "west",
+		})))
+	})
+	t.Run(`exec`, func(t *testing.T) {
+		merger.Configure(nil, []meta.SourceConfig{
+			{Kind: meta.SourceExec, Command: `echo '{"rack": "rack-exec"}'`},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"rack": "rack-exec",
+		})))
+	})
+	t.Run(`order`, func(t *testing.T) {
+		merger.Configure(map[string]string{"rack": "static"}, []meta.SourceConfig{
+			{Kind: meta.SourceEnv, Prefix: "TEST_SOURCE_"},
+			{Kind: meta.SourceExec, Command: `echo '{"rack": "rack-exec"}'`},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"rack": "rack-exec",
+			"zone": "west",
+		})))
+	})
+	t.Run(`bad sources`, func(t *testing.T) {
+		merger.Configure(map[string]string{"static": "true"}, []meta.SourceConfig{
+			{Kind: "unknown"},
+			{Kind: meta.SourceEnv},
+			{Kind: meta.SourceFile, Path: "testdata/non-exists.json"},
+			{Kind: meta.SourceFile, Path: "testdata/meta.conf", Format: "yaml"},
+			{Kind: meta.SourceExec, Command: "exit 1"},
+		}, "")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("meta", map[string]string{
+			"static": "true",
+		})))
+	})
+}
@@ -1,6 +1,12 @@
 package metrics
 
+import "time"
+
 // BlackHole reporter
 type BlackHole struct{}
 
 func (*BlackHole) Count(name string, value int64, tags ...string) {}
+
+func (*BlackHole) Gauge(name string, value float64, tags ...string) {}
+
+func (*BlackHole) Timing(name string, value time.Duration, tags ...string) {}
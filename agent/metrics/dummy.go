@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 )
 
 // Dummy reporter for testing purposes
@@ -35,3 +36,24 @@ func (r *Dummy) Count(name string, value int64, tags ...string) {
 	}
 	r.Data[line] = old + value
 }
+
+func (r *Dummy) Gauge(name string, value float64, tags ...string) {
+	sort.Strings(tags)
+	line := fmt.Sprintf("gauge:%s:%v", name, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Data[line] = value
+}
+
+// Timing records number of observations
+func (r *Dummy) Timing(name string, value time.Duration, tags ...string) {
+	sort.Strings(tags)
+	line := fmt.Sprintf("timing:%s:%v", name, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var old int64
+	if val, ok := r.Data[line]; ok {
+		old = val.(int64)
+	}
+	r.Data[line] = old + 1
+}
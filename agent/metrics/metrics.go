@@ -1,5 +1,10 @@
 package metrics
 
+import "time"
+
+// Reporter records metrics. Tags are given in form "key:value".
 type Reporter interface {
 	Count(name string, value int64, tags ...string)
+	Gauge(name string, value float64, tags ...string)
+	Timing(name string, value time.Duration, tags ...string)
 }
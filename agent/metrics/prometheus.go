@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PrometheusContentType = "text/plain; version=0.0.4"
+
+type prometheusSummary struct {
+	sum   float64
+	count int64
+}
+
+// Prometheus reporter aggregates metrics in memory and writes them in
+// Prometheus text exposition format. Counts are exposed as counters, timings
+// as summaries in seconds. Tags "key:value" are converted to labels.
+type Prometheus struct {
+	namespace string
+
+	mu        sync.Mutex
+	types     map[string]string                       // metric types by name
+	counters  map[string]map[string]float64           // values by name and labels
+	gauges    map[string]map[string]float64           // values by name and labels
+	summaries map[string]map[string]prometheusSummary // values by name and labels
+}
+
+func NewPrometheus(namespace string) (r *Prometheus) {
+	r = &Prometheus{
+		namespace: namespace,
+		types:     map[string]string{},
+		counters:  map[string]map[string]float64{},
+		gauges:    map[string]map[string]float64{},
+		summaries: map[string]map[string]prometheusSummary{},
+	}
+	return
+}
+
+func (r *Prometheus) Count(name string, value int64, tags ...string) {
+	name, labels := r.series(name, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.setType(name, "counter") {
+		return
+	}
+	if _, ok := r.counters[name]; !ok {
+		r.counters[name] = map[string]float64{}
+	}
+	r.counters[name][labels] += float64(value)
+}
+
+func (r *Prometheus) Gauge(name string, value float64, tags ...string) {
+	name, labels := r.series(name, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.setType(name, "gauge") {
+		return
+	}
+	if _, ok := r.gauges[name]; !ok {
+		r.gauges[name] = map[string]float64{}
+	}
+	r.gauges[name][labels] = value
+}
+
+func (r *Prometheus) Timing(name string, value time.Duration, tags ...string) {
+	name, labels := r.series(name, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.setType(name, "summary") {
+		return
+	}
+	if _, ok := r.summaries[name]; !ok {
+		r.summaries[name] = map[string]prometheusSummary{}
+	}
+	summary := r.summaries[name][labels]
+	summary.sum += value.Seconds()
+	summary.count++
+	r.summaries[name][labels] = summary
+}
+
+// ContentType returns Prometheus text format content type
+func (r *Prometheus) ContentType() string {
+	return PrometheusContentType
+}
+
+// WriteTo writes all metrics in Prometheus text format
+func (r *Prometheus) WriteTo(w io.Writer) (n int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		kind := r.types[name]
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, kind)
+		switch kind {
+		case "counter":
+			writePrometheusValues(&buf, name, "", r.counters[name])
+		case "gauge":
+			writePrometheusValues(&buf, name, "", r.gauges[name])
+		case "summary":
+			sums := map[string]float64{}
+			counts := map[string]float64{}
+			for labels, summary := range r.summaries[name] {
+				sums[labels] = summary.sum
+				counts[labels] = float64(summary.count)
+			}
+			writePrometheusValues(&buf, name, "_sum", sums)
+			writePrometheusValues(&buf, name, "_count", counts)
+		}
+	}
+	n, err = buf.WriteTo(w)
+	return
+}
+
+// setType registers metric type. Returns false if metric is already
+// registered with different type.
+func (r *Prometheus) setType(name, kind string) (ok bool) {
+	if existing, exists := r.types[name]; exists && existing != kind {
+		return
+	}
+	r.types[name] = kind
+	ok = true
+	return
+}
+
+// series returns full metric name and formatted labels
+func (r *Prometheus) series(name string, tags []string) (fullName string, labels string) {
+	fullName = sanitizePrometheusName(name)
+	if r.namespace != "" {
+		fullName = sanitizePrometheusName(r.namespace) + "_" + fullName
+	}
+	if len(tags) == 0 {
+		return
+	}
+	var pairs []string
+	for _, tag := range tags {
+		split := strings.SplitN(tag, ":", 2)
+		key, value := split[0], ""
+		if len(split) == 2 {
+			value = split[1]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, sanitizePrometheusName(key), escapePrometheusValue(value)))
+	}
+	sort.Strings(pairs)
+	labels = "{" + strings.Join(pairs, ",") + "}"
+	return
+}
+
+func writePrometheusValues(w io.Writer, name, suffix string, values map[string]float64) {
+	var labels []string
+	for l := range values {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s%s%s %s\n", name, suffix, l, strconv.FormatFloat(values[l], 'g', -1, 64))
+	}
+}
+
+func sanitizePrometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func escapePrometheusValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,38 @@
+// +build ide test_unit
+
+package metrics_test
+
+import (
+	"bytes"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPrometheus_WriteTo(t *testing.T) {
+	reporter := metrics.NewPrometheus("soil")
+	reporter.Count("requests_total", 1, "method:GET")
+	reporter.Count("requests_total", 2, "method:GET")
+	reporter.Count("requests_total", 1, "method:PUT")
+	reporter.Gauge("pending", 3)
+	reporter.Gauge("pending", 2)
+	reporter.Timing("duration_seconds", time.Millisecond*500, "state:create", "kind:a\"b")
+	reporter.Timing("duration_seconds", time.Second, "state:create", "kind:a\"b")
+
+	// type conflict is ignored
+	reporter.Gauge("requests_total", 10)
+
+	var buf bytes.Buffer
+	_, err := reporter.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE soil_duration_seconds summary\n"+
+		"soil_duration_seconds_sum{kind=\"a\\\"b\",state=\"create\"} 1.5\n"+
+		"soil_duration_seconds_count{kind=\"a\\\"b\",state=\"create\"} 2\n"+
+		"# TYPE soil_pending gauge\n"+
+		"soil_pending 2\n"+
+		"# TYPE soil_requests_total counter\n"+
+		"soil_requests_total{method=\"GET\"} 3\n"+
+		"soil_requests_total{method=\"PUT\"} 1\n", buf.String())
+	assert.Equal(t, "text/plain; version=0.0.4", reporter.ContentType())
+}
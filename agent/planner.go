@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"fmt"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/provision"
+	"github.com/akaspin/soil/agent/scheduler"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type planStage struct {
+	name      string
+	arbiter   *scheduler.Arbiter
+	evaluator scheduler.Evaluator
+	manages   func(pod *manifest.Pod) bool // Optional. Stage is skipped for pods not managed by evaluator
+}
+
+// planner evaluates pods against current agent state without allocation and
+// explains constraints of registered pods. Provision stage should be last.
+type planner struct {
+	stages    []planStage
+	provision *provision.Evaluator
+}
+
+func (p *planner) Plan(pods manifest.PodSlice) (res []proto.PodPlan, err error) {
+	for _, pod := range pods {
+		res = append(res, p.planPod(pod))
+	}
+	return
+}
+
+func (p *planner) planPod(pod *manifest.Pod) (res proto.PodPlan) {
+	res.Name = pod.Name
+
+	// counter slots, providers and resources of planned pod are known only
+	// after allocation
+	own := []string{
+		fmt.Sprintf("counter.%s.", pod.Name),
+		fmt.Sprintf("provider.%s.", pod.Name),
+		fmt.Sprintf("resource.%s.", pod.Name),
+	}
+	var env map[string]string
+	for _, stage := range p.stages {
+		if stage.manages != nil && !stage.manages(pod) {
+			continue
+		}
+		constraint := stage.evaluator.GetConstraint(pod)
+		available := constraint.FilterOut(own...)
+		stageEnv, err := evaluateArbiter(stage.arbiter, available)
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: %v", stage.name, err))
+			continue
+		}
+		env = stageEnv
+		var pending []string
+		for left, right := range constraint {
+			if _, ok := available[left]; !ok {
+				pending = append(pending, fmt.Sprintf("%s: %q:%q", stage.name, left, right))
+			}
+		}
+		sort.Strings(pending)
+		res.Pending = append(res.Pending, pending...)
+	}
+	if len(res.Failures) > 0 {
+		return
+	}
+	res.Allocated = true
+	evaluation, err := p.provision.Plan(pod, env)
+	if err != nil {
+		res.Failures = append(res.Failures, fmt.Sprintf("provision: %v", err))
+		return
+	}
+	diffs := evaluation.Diffs()
+	for _, instruction := range evaluation.Plan() {
+		planned := proto.PlanInstruction{
+			Phase:  instruction.Phase(),
+			Action: instruction.Action(),
+			Path:   instruction.Path(),
+		}
+		if strings.HasPrefix(planned.Action, "write-") {
+			planned.Diff = diffs[planned.Path]
+		}
+		res.Instructions = append(res.Instructions, planned)
+	}
+	return
+}
+
+// Explain returns constraint evaluation details for registered pod from
+// each stage
+func (p *planner) Explain(name string) (res []proto.ConstraintExplain, err error) {
+	for _, stage := range p.stages {
+		constraint, state, ok := stage.arbiter.Explain(name)
+		if !ok {
+			continue
+		}
+		explain := proto.ConstraintExplain{
+			Arbiter: stage.name,
+			Passed:  true,
+			Env:     constraint.GetEnv(state),
+		}
+		for _, pair := range constraint.Explain(state) {
+			explain.Pairs = append(explain.Pairs, proto.ConstraintPair(pair))
+		}
+		if checkErr := constraint.Check(state); checkErr != nil {
+			explain.Passed = false
+			if constraintErr, isConstraintErr := checkErr.(*manifest.ConstraintError); isConstraintErr {
+				for _, failure := range constraintErr.Failures {
+					explain.Failures = append(explain.Failures, failure.String())
+				}
+			}
+		}
+		res = append(res, explain)
+	}
+	if len(res) == 0 {
+		err = api_server.NewError(http.StatusNotFound, fmt.Sprintf(`pod "%s" is not registered`, name))
+	}
+	return
+}
+
+// Env returns current environment of each stage arbiter
+func (p *planner) Env() (res map[string]map[string]string, err error) {
+	res = map[string]map[string]string{}
+	for _, stage := range p.stages {
+		res[stage.name] = stage.arbiter.State()
+	}
+	return
+}
+
+// evaluateArbiter checks constraint against arbiter state and returns
+// arbiter environment
+func evaluateArbiter(arbiter *scheduler.Arbiter, constraint manifest.Constraint) (env map[string]string, err error) {
+	done := make(chan struct{})
+	arbiter.Evaluate(constraint, func(reason error, message bus.Message) {
+		defer close(done)
+		if err = reason; err != nil {
+			return
+		}
+		err = message.Payload().Unmarshal(&env)
+	})
+	<-done
+	return
+}
@@ -55,7 +55,7 @@ func (e *Evaluator) GetConstraint(pod *manifest.Pod) manifest.Constraint {
 			"__provider.allocate": "= false",
 		})
 	}
-	return pod.Constraint.Clone()
+	return pod.Constraint.Merge(pod.GetCounterConstraint())
 }
 
 // Allocate providers in given pod
@@ -3,6 +3,7 @@ package provision
 import (
 	"fmt"
 	"github.com/akaspin/soil/agent/allocation"
+	"github.com/pmezard/go-difflib/difflib"
 	"sort"
 )
 
@@ -25,10 +26,17 @@ func NewEvaluation(left, right *allocation.Pod) (e *Evaluation) {
 	} else if left != nil {
 		e.name = left.Name
 	}
-	e.plan = e.planPhases()
-	sort.Slice(e.plan, func(i, j int) bool {
-		return e.plan[i].String() < e.plan[j].String()
+	plan := e.planPhases()
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].String() < plan[j].String()
 	})
+	// drop-ins of one parent unit may produce same commands
+	for i, instruction := range plan {
+		if i > 0 && instruction.String() == plan[i-1].String() {
+			continue
+		}
+		e.plan = append(e.plan, instruction)
+	}
 	return
 }
 
@@ -62,6 +70,58 @@ func (e *Evaluation) Explain() string {
 	return fmt.Sprintf("%s", e.plan)
 }
 
+// Diffs returns unified diffs of changed unit, blob and drop-in sources by path
+func (e *Evaluation) Diffs() (res map[string]string) {
+	res = map[string]string{}
+	left := podSources(e.Left)
+	right := podSources(e.Right)
+	for path, rightSource := range right {
+		leftSource, exists := left[path]
+		if exists && leftSource == rightSource {
+			continue
+		}
+		fromFile := path
+		if !exists {
+			fromFile = "/dev/null"
+		}
+		res[path], _ = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(leftSource),
+			B:        splitLines(rightSource),
+			FromFile: fromFile,
+			ToFile:   path,
+			Context:  3,
+		})
+	}
+	return
+}
+
+func splitLines(source string) (res []string) {
+	if source == "" {
+		return
+	}
+	res = difflib.SplitLines(source)
+	return
+}
+
+// podSources returns sources of all pod units, blobs and drop-ins by path
+func podSources(pod *allocation.Pod) (res map[string]string) {
+	res = map[string]string{}
+	if pod == nil {
+		return
+	}
+	res[pod.UnitFile.Path] = pod.UnitFile.Source
+	for _, u := range pod.Units {
+		res[u.UnitFile.Path] = u.UnitFile.Source
+	}
+	for _, b := range pod.Blobs {
+		res[b.Name] = b.Source
+	}
+	for _, d := range pod.DropIns {
+		res[d.Path] = d.Source
+	}
+	return
+}
+
 func (e *Evaluation) planPhases() (res []Instruction) {
 	if e.Right == nil {
 		res = append(res, planUnitDestroy(e.Left.GetPodUnit())...)
@@ -71,6 +131,9 @@ func (e *Evaluation) planPhases() (res []Instruction) {
 		for _, b := range e.Left.Blobs {
 			res = append(res, PlanBlob(b, nil)...)
 		}
+		for _, d := range e.Left.DropIns {
+			res = append(res, planDropIn(d, nil)...)
+		}
 		return
 	}
 
@@ -82,6 +145,9 @@ func (e *Evaluation) planPhases() (res []Instruction) {
 		for _, b := range e.Right.Blobs {
 			res = append(res, PlanBlob(nil, b)...)
 		}
+		for _, d := range e.Right.DropIns {
+			res = append(res, planDropIn(nil, d)...)
+		}
 		return
 	}
 
@@ -120,6 +186,22 @@ func (e *Evaluation) planPhases() (res []Instruction) {
 		}
 		res = append(res, PlanBlob(nil, b)...)
 	}
+
+	dropInsDone := map[string]bool{}
+	dropInCandidates := map[string]*allocation.DropIn{}
+	for _, d := range e.Right.DropIns {
+		dropInCandidates[d.Path] = d
+	}
+	for _, d := range e.Left.DropIns {
+		res = append(res, planDropIn(d, dropInCandidates[d.Path])...)
+		dropInsDone[d.Path] = true
+	}
+	for _, d := range e.Right.DropIns {
+		if _, ok := dropInsDone[d.Path]; ok {
+			continue
+		}
+		res = append(res, planDropIn(nil, d)...)
+	}
 	return
 }
 
@@ -193,8 +275,36 @@ func PlanBlob(left, right *allocation.Blob) (res []Instruction) {
 		return
 	}
 	// ok we have two blobs
-	if left.Source != right.Source || left.Permissions != right.Permissions {
+	if left.Source != right.Source || left.SHA256 != right.SHA256 || left.Archive != right.Archive ||
+		left.Permissions != right.Permissions || left.Owner != right.Owner || left.Group != right.Group {
 		res = append(res, NewWriteBlobInstruction(phaseDeployFS, right))
 	}
 	return
 }
+
+func planDropIn(left, right *allocation.DropIn) (res []Instruction) {
+	if left == nil && right == nil {
+		return
+	}
+	if left == nil {
+		res = append(res, NewWriteDropInInstruction(right))
+		if right.Transition.Create != "" {
+			res = append(res, NewCommandInstruction(phaseDeployCommand, right.UnitFile(), right.Transition.Create))
+		}
+		return
+	}
+	if right == nil {
+		res = append(res, NewDeleteDropInInstruction(left))
+		if left.Transition.Destroy != "" {
+			res = append(res, NewCommandInstruction(phaseDestroyDropInCommand, left.UnitFile(), left.Transition.Destroy))
+		}
+		return
+	}
+	if left.Source != right.Source {
+		res = append(res, NewWriteDropInInstruction(right))
+		if right.Transition.Update != "" {
+			res = append(res, NewCommandInstruction(phaseDeployCommand, right.UnitFile(), right.Transition.Update))
+		}
+	}
+	return
+}
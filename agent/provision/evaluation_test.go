@@ -45,3 +45,44 @@ func TestEvaluation_Plan(t *testing.T) {
 		assert.Equal(t, "[0:stop:/run/systemd/system/pod-private-pod-1.service 1:delete-unit:/run/systemd/system/pod-private-pod-1.service]", evaluation.Explain())
 	})
 }
+
+func TestEvaluation_Plan_DropIns(t *testing.T) {
+	left := makeAllocations(t, "testdata/evaluation_test_dropin_left.hcl")[0]
+	right := makeAllocations(t, "testdata/evaluation_test_dropin_right.hcl")[0]
+
+	t.Run("create", func(t *testing.T) {
+		evaluation := provision.NewEvaluation(nil, left)
+		assert.Equal(t, "[2:write-dropin:/etc/systemd/system/docker.service.d/10-soil.conf 2:write-dropin:/etc/systemd/system/docker.service.d/20-soil.conf 2:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:start:/etc/systemd/system/pod-private-pod-1.service 4:try-restart:/etc/systemd/system/docker.service]", evaluation.Explain())
+	})
+	t.Run("update", func(t *testing.T) {
+		evaluation := provision.NewEvaluation(left, right)
+		assert.Equal(t, "[2:write-dropin:/etc/systemd/system/docker.service.d/10-soil.conf 2:write-dropin:/etc/systemd/system/docker.service.d/20-soil.conf 2:write-dropin:/etc/systemd/system/nginx.service.d/10-soil.conf 2:write-unit:/etc/systemd/system/pod-private-pod-1.service 3:enable-unit:/etc/systemd/system/pod-private-pod-1.service 4:restart:/etc/systemd/system/pod-private-pod-1.service 4:try-restart:/etc/systemd/system/docker.service 4:try-restart:/etc/systemd/system/nginx.service]", evaluation.Explain())
+		diffs := evaluation.Diffs()
+		assert.Equal(t, "--- /etc/systemd/system/docker.service.d/10-soil.conf\n+++ /etc/systemd/system/docker.service.d/10-soil.conf\n@@ -1,2 +1,2 @@\n [Service]\n-Environment=A=1\n+Environment=A=2\n", diffs["/etc/systemd/system/docker.service.d/10-soil.conf"])
+	})
+	t.Run("destroy", func(t *testing.T) {
+		evaluation := provision.NewEvaluation(right, nil)
+		assert.Equal(t, "[0:stop:/etc/systemd/system/pod-private-pod-1.service 1:delete-dropin:/etc/systemd/system/docker.service.d/10-soil.conf 1:delete-dropin:/etc/systemd/system/docker.service.d/20-soil.conf 1:delete-dropin:/etc/systemd/system/nginx.service.d/10-soil.conf 1:delete-unit:/etc/systemd/system/pod-private-pod-1.service 6:try-restart:/etc/systemd/system/docker.service 6:try-restart:/etc/systemd/system/nginx.service]", evaluation.Explain())
+	})
+}
+
+func TestEvaluation_Diffs(t *testing.T) {
+	left := makeAllocations(t, "testdata/evaluation_test_left.hcl")[0]
+	right := makeAllocations(t, "testdata/evaluation_test_2_right.hcl")[0]
+
+	t.Run("noop", func(t *testing.T) {
+		assert.Empty(t, provision.NewEvaluation(left, left).Diffs())
+	})
+	t.Run("update unit-1 and blob", func(t *testing.T) {
+		diffs := provision.NewEvaluation(left, right).Diffs()
+		assert.Len(t, diffs, 3)
+		assert.Equal(t, "--- /etc/systemd/system/unit-1.service\n+++ /etc/systemd/system/unit-1.service\n@@ -1 +1 @@\n-fake\n+fake1\n", diffs["/etc/systemd/system/unit-1.service"])
+		assert.Equal(t, "--- /etc/test1\n+++ /etc/test1\n@@ -1 +1 @@\n-test\n+test1\n", diffs["/etc/test1"])
+		assert.Contains(t, diffs, "/etc/systemd/system/pod-private-pod-1.service")
+	})
+	t.Run("create", func(t *testing.T) {
+		diffs := provision.NewEvaluation(nil, right).Diffs()
+		assert.Len(t, diffs, 4)
+		assert.Equal(t, "--- /dev/null\n+++ /etc/test1\n@@ -0,0 +1 @@\n+test1\n", diffs["/etc/test1"])
+	})
+}
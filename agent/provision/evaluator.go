@@ -6,16 +6,22 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/lib"
 	"github.com/akaspin/soil/manifest"
 	"github.com/akaspin/supervisor"
-	"github.com/coreos/go-systemd/dbus"
+	"strings"
 	"sync"
+	"time"
 )
 
 type EvaluatorConfig struct {
 	SystemPaths    allocation.SystemPaths
-	Recovery       allocation.PodSlice // recovery state
-	StatusConsumer bus.Consumer        // consumer for "evaluation.<pod>.*"
+	Recovery       allocation.PodSlice    // recovery state
+	StatusConsumer bus.Consumer           // consumer for "evaluation.<pod>.*"
+	UnitsConsumer  bus.Consumer           // optional consumer for "<pod>":["<unit>",...]
+	SystemdConn    lib.SystemdConnFactory // optional SystemD connection factory
+	Reporter       metrics.Reporter       // optional metrics reporter
 }
 
 type Evaluator struct {
@@ -24,13 +30,30 @@ type Evaluator struct {
 	config EvaluatorConfig
 
 	state *EvaluatorState
+
+	mu       sync.Mutex
+	requests map[string]allocationRequest // last allocation requests by pod
+}
+
+// allocationRequest is kept to reallocate dependent pods when dependency
+// namespace is changed
+type allocationRequest struct {
+	pod *manifest.Pod
+	env map[string]string
 }
 
 func NewEvaluator(ctx context.Context, log *logx.Log, config EvaluatorConfig) (e *Evaluator) {
 	e = &Evaluator{
-		Control: supervisor.NewControl(ctx),
-		log:     log.GetLog("provision", "evaluator"),
-		config:  config,
+		Control:  supervisor.NewControl(ctx),
+		log:      log.GetLog("provision", "evaluator"),
+		config:   config,
+		requests: map[string]allocationRequest{},
+	}
+	if e.config.SystemdConn == nil {
+		e.config.SystemdConn = lib.NewDbusSystemdConn
+	}
+	if e.config.Reporter == nil {
+		e.config.Reporter = &metrics.BlackHole{}
 	}
 	e.state = NewEvaluatorState(e.log, config.Recovery)
 	return
@@ -51,7 +74,7 @@ func (e *Evaluator) Open() (err error) {
 
 // Returns all base constraints including resources
 func (e *Evaluator) GetConstraint(pod *manifest.Pod) (res manifest.Constraint) {
-	res = pod.Constraint.Clone()
+	res = pod.Constraint.Merge(pod.GetCounterConstraint())
 	if len(pod.Resources) > 0 {
 		c1 := manifest.Constraint{}
 		for _, r := range pod.Resources {
@@ -63,23 +86,78 @@ func (e *Evaluator) GetConstraint(pod *manifest.Pod) (res manifest.Constraint) {
 }
 
 func (e *Evaluator) Allocate(pod *manifest.Pod, env map[string]string) {
-
-	alloc := &allocation.Pod{
-		UnitFile: allocation.UnitFile{
-			SystemPaths: e.config.SystemPaths,
-		},
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests[pod.Name] = allocationRequest{
+		pod: pod,
+		env: env,
 	}
-	if err := alloc.FromManifest(pod, env); err != nil {
+	alloc, err := e.newAllocation(pod, env, e.state.Deployed())
+	if err != nil {
 		e.log.Error(err)
 		return
 	}
 	e.submitAllocation(pod.Name, alloc)
 }
 
+// Plan returns evaluation from last finished allocation to given pod without
+// execution.
+func (e *Evaluator) Plan(pod *manifest.Pod, env map[string]string) (evaluation *Evaluation, err error) {
+	alloc, err := e.newAllocation(pod, env, e.state.Deployed())
+	if err != nil {
+		return
+	}
+	evaluation = NewEvaluation(e.state.Finished(pod.Name), alloc)
+	return
+}
+
 func (e *Evaluator) Deallocate(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.requests, name)
 	e.submitAllocation(name, nil)
 }
 
+func (e *Evaluator) newAllocation(pod *manifest.Pod, env map[string]string, deployed map[string]string) (alloc *allocation.Pod, err error) {
+	alloc = &allocation.Pod{
+		UnitFile: allocation.UnitFile{
+			SystemPaths: e.config.SystemPaths,
+		},
+		Deployed: deployed,
+	}
+	err = alloc.FromManifest(pod, env)
+	return
+}
+
+// reallocateDependents resubmits pods which depend on finished evaluation
+// with actual dependency units. Should be called before commit to prevent
+// promotion of dependents with stale allocations.
+func (e *Evaluator) reallocateDependents(evaluation *Evaluation) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	name := evaluation.Name()
+	deployed := e.state.Deployed()
+	delete(deployed, name)
+	if evaluation.Right != nil {
+		deployed[name] = evaluation.Right.Namespace
+	}
+	for podName, request := range e.requests {
+		var dependent bool
+		for _, dependency := range request.pod.DependsOn {
+			dependent = dependent || dependency == name
+		}
+		if !dependent {
+			continue
+		}
+		alloc, err := e.newAllocation(request.pod, request.env, deployed)
+		if err != nil {
+			e.log.Error(err)
+			continue
+		}
+		e.submitAllocation(podName, alloc)
+	}
+}
+
 func (e *Evaluator) submitAllocation(name string, pod *allocation.Pod) {
 	next := e.state.Submit(name, pod)
 	e.fanOut(next)
@@ -94,9 +172,9 @@ func (e *Evaluator) fanOut(next []*Evaluation) {
 }
 
 func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
-	var failures []error
 	e.log.Tracef("begin: %s", evaluation)
-	conn, err := dbus.New()
+	start := time.Now()
+	conn, err := e.config.SystemdConn()
 	if err != nil {
 		e.log.Error(err)
 		return
@@ -105,8 +183,6 @@ func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 
 	plan := evaluation.Plan()
 	name := evaluation.Name()
-	var phase []Instruction
-	currentPhase := -1
 
 	state := "update"
 	if evaluation.Right == nil {
@@ -119,18 +195,21 @@ func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 		"state":   state,
 	}))
 
-	for _, instruction := range plan {
-		if currentPhase < instruction.Phase() {
-			currentPhase = instruction.Phase()
-			failures = append(failures, e.executePhase(phase, conn)...)
-			phase = []Instruction{}
-		}
-		phase = append(phase, instruction)
-	}
-	failures = append(failures, e.executePhase(phase, conn)...)
+	failures, deployFailed := e.executePlan(plan, conn)
 
 	e.log.Debugf("plan done: %s:%s (failures:%v)", evaluation, plan, failures)
 	e.log.Infof("evaluation done: %s (failures:%v)", evaluation, failures)
+	e.config.Reporter.Timing("provision_evaluation_duration_seconds", time.Since(start), "state:"+state)
+	result := "ok"
+	if len(failures) > 0 {
+		result = "failed"
+	}
+	e.config.Reporter.Count("provision_evaluations_total", 1, "state:"+state, "result:"+result)
+	if deployFailed && evaluation.Right != nil && evaluation.Right.Rollback {
+		e.rollbackEvaluation(conn, evaluation, failures)
+		return
+	}
+	e.notifyUnits(evaluation)
 	if evaluation.Right != nil {
 		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(name, map[string]string{
 			"present": "true",
@@ -140,12 +219,119 @@ func (e *Evaluator) executeEvaluation(evaluation *Evaluation) {
 		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), nil))
 	}
 
+	e.reallocateDependents(evaluation)
 	next := e.state.Commit(evaluation.Name())
 	e.fanOut(next)
+	if evaluation.Right != nil {
+		go e.checkHealth(evaluation)
+	}
+	return
+}
+
+// rollbackEvaluation restores left allocation after failed evaluation and
+// reports "rolled_back" state. Rolled back new pods are reported as removed.
+func (e *Evaluator) rollbackEvaluation(conn lib.SystemdConn, evaluation *Evaluation, failures []error) {
+	rollback := NewEvaluation(evaluation.Right, evaluation.Left)
+	e.log.Warningf("rolling back: %s (failures:%v)", evaluation, failures)
+	rollbackFailures, _ := e.executePlan(rollback.Plan(), conn)
+	e.log.Infof("rollback done: %s (failures:%v)", rollback, rollbackFailures)
+	e.notifyUnits(rollback)
+
+	if rollback.Right != nil {
+		var messages []string
+		for _, failure := range failures {
+			messages = append(messages, failure.Error())
+		}
+		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), map[string]string{
+			"present": "true",
+			"state":   statusRolledBack,
+			"failure": strings.Join(messages, "; "),
+		}))
+	} else {
+		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), nil))
+	}
+
+	e.reallocateDependents(rollback)
+	next := e.state.Rollback(evaluation.Name())
+	e.fanOut(next)
+}
+
+// executePlan executes plan instructions phase by phase. Returns all
+// failures and true if at least one deploy phase is failed.
+func (e *Evaluator) executePlan(plan []Instruction, conn lib.SystemdConn) (failures []error, deployFailed bool) {
+	var phase []Instruction
+	currentPhase := -1
+	flush := func() {
+		phaseFailures := e.executePhase(phase, conn)
+		if len(phaseFailures) > 0 && isDeployPhase(currentPhase) {
+			deployFailed = true
+		}
+		failures = append(failures, phaseFailures...)
+	}
+	for _, instruction := range plan {
+		if currentPhase < instruction.Phase() {
+			flush()
+			currentPhase = instruction.Phase()
+			phase = []Instruction{}
+		}
+		phase = append(phase, instruction)
+	}
+	flush()
 	return
 }
 
-func (e *Evaluator) executePhase(phase []Instruction, conn *dbus.Conn) (failures []error) {
+// notifyUnits sends names of deployed units to units consumer
+func (e *Evaluator) notifyUnits(evaluation *Evaluation) {
+	if e.config.UnitsConsumer == nil {
+		return
+	}
+	if evaluation.Right == nil {
+		e.config.UnitsConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), nil))
+		return
+	}
+	units := []string{}
+	for _, unit := range evaluation.Right.Units {
+		units = append(units, unit.UnitName())
+	}
+	e.config.UnitsConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), units))
+}
+
+// checkHealth reports "healthy" or "failed" state for committed pods with
+// unit health checks. Failures are reported to "provision.<pod>.failure".
+// State is not reported if allocation is already replaced.
+func (e *Evaluator) checkHealth(evaluation *Evaluation) {
+	var checked bool
+	for _, unit := range evaluation.Right.Units {
+		checked = checked || unit.Health != nil
+	}
+	if !checked {
+		return
+	}
+	var failures []string
+	conn, err := e.config.SystemdConn()
+	if err != nil {
+		failures = append(failures, err.Error())
+	} else {
+		failures = CheckHealth(e.Control.Ctx(), conn, evaluation.Right.Units)
+		conn.Close()
+	}
+	status := map[string]string{
+		"present": "true",
+		"state":   statusHealthy,
+	}
+	if len(failures) > 0 {
+		e.log.Errorf("health check failed: %s: %v", evaluation, failures)
+		status["state"] = statusFailed
+		status["failure"] = strings.Join(failures, "; ")
+	}
+	next, ok := e.state.SetStatus(evaluation.Right, status["state"])
+	if ok {
+		e.config.StatusConsumer.ConsumeMessage(bus.NewMessage(evaluation.Name(), status))
+	}
+	e.fanOut(next)
+}
+
+func (e *Evaluator) executePhase(phase []Instruction, conn lib.SystemdConn) (failures []error) {
 	if len(phase) == 0 {
 		return
 	}
@@ -160,19 +346,19 @@ func (e *Evaluator) executePhase(phase []Instruction, conn *dbus.Conn) (failures
 			var iErr error
 			if iErr = instruction.Execute(conn); iErr != nil {
 				e.log.Errorf("error while execute instruction %v: %s", instruction, iErr)
+				e.config.Reporter.Count("provision_instruction_failures_total", 1, "action:"+instruction.Action())
 			}
 			e.log.Tracef("finish instruction %s", instruction)
 			ch <- iErr
 		}(instruction)
 	}
-	go func() {
-		for res := range ch {
-			if res != nil {
-				failures = append(failures, res)
-			}
-		}
-	}()
 	wg.Wait()
+	close(ch)
+	for res := range ch {
+		if res != nil {
+			failures = append(failures, res)
+		}
+	}
 	e.log.Debugf("finish phase %v", phase)
 
 	return
@@ -0,0 +1,183 @@
+// +build ide test_unit
+
+package provision_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/provision"
+	"github.com/akaspin/soil/fixture"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluator_FakeSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-provision")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	paths := allocation.SystemPaths{
+		Local:   filepath.Join(dir, "etc"),
+		Runtime: filepath.Join(dir, "run"),
+	}
+	require.NoError(t, os.MkdirAll(paths.Local, 0755))
+	require.NoError(t, os.MkdirAll(paths.Runtime, 0755))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	systemd := fixture.NewFakeSystemd(paths.Local, paths.Runtime)
+	status := bus.NewTestingConsumer(ctx)
+	evaluator := provision.NewEvaluator(ctx, logx.GetLog("test"), provision.EvaluatorConfig{
+		SystemPaths:    paths,
+		StatusConsumer: status,
+		SystemdConn:    systemd.Conn,
+	})
+	require.NoError(t, evaluator.Open())
+
+	statesFn := func(expect map[string]string) func() error {
+		return func() (err error) {
+			if res := systemd.States(); !reflect.DeepEqual(expect, res) {
+				err = fmt.Errorf("not equal (expected)%v != (actual)%v", expect, res)
+			}
+			return
+		}
+	}
+
+	t.Run("0 allocate", func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		var registry manifest.PodSlice
+		assert.NoError(t, buffers.ReadFiles("testdata/evaluator_test_Allocate_0.hcl"))
+		assert.NoError(t, registry.Unmarshal("private", buffers.GetReaders()...))
+		evaluator.Allocate(registry[0], map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		})
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{
+			"pod-private-pod-1.service": "active",
+			"unit-1.service":            "active",
+		}))
+		for _, name := range []string{"pod-private-pod-1.service", "unit-1.service"} {
+			_, err := os.Stat(filepath.Join(paths.Runtime, name))
+			assert.NoError(t, err)
+		}
+	})
+	t.Run("1 deallocate", func(t *testing.T) {
+		evaluator.Deallocate("pod-1")
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{}))
+		_, err := os.Stat(filepath.Join(paths.Runtime, "unit-1.service"))
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("2 health check is not blocking", func(t *testing.T) {
+		var registry manifest.PodSlice
+		assert.NoError(t, registry.Unmarshal("private", strings.NewReader(`
+pod "pod-2" {
+  unit "unit-2.service" {
+    source = "[Service]\nExecStart=/usr/bin/sleep inf\n"
+    health {
+      exec = "false"
+      timeout = "10s"
+    }
+  }
+}
+`)))
+		evaluator.Allocate(registry[0], map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		})
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{
+			"pod-private-pod-2.service": "active",
+			"unit-2.service":            "active",
+		}))
+		evaluator.Deallocate("pod-2")
+		fixture.WaitNoErrorT(t, fixture.WaitConfig{
+			Retry:   time.Millisecond * 100,
+			Retries: 30,
+		}, statesFn(map[string]string{}))
+	})
+	// BLOBs under regular file can't be written
+	brokenBlob := filepath.Join(dir, "file", "blob")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+
+	t.Run("3 rollback create", func(t *testing.T) {
+		var registry manifest.PodSlice
+		assert.NoError(t, registry.Unmarshal("private", strings.NewReader(fmt.Sprintf(`
+pod "pod-3" {
+  rollback = true
+  unit "unit-3.service" {
+    source = "[Service]\nExecStart=/usr/bin/sleep inf\n"
+  }
+  blob "%s" {
+    source = "test"
+  }
+}
+`, brokenBlob))))
+		evaluator.Allocate(registry[0], map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		})
+		fixture.WaitNoErrorT10(t, status.ExpectLastMessageFn(bus.NewMessage("pod-3", nil)))
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{}))
+	})
+	t.Run("4 create dependent of rolled back dependency", func(t *testing.T) {
+		env := map[string]string{
+			"system.pod_exec": "ExecStart=/usr/bin/sleep inf",
+		}
+		var registry manifest.PodSlice
+		assert.NoError(t, registry.Unmarshal("private", strings.NewReader(`
+pod "pod-4" {
+  rollback = true
+  unit "unit-4.service" {
+    source = "[Service]\nExecStart=/usr/bin/sleep inf\n"
+  }
+}
+pod "pod-5" {
+  depends_on = ["pod-4"]
+  unit "unit-5.service" {
+    source = "[Service]\nExecStart=/usr/bin/sleep inf\n"
+  }
+}
+`)))
+		evaluator.Allocate(registry[0], env)
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{
+			"pod-private-pod-4.service": "active",
+			"unit-4.service":            "active",
+		}))
+
+		var broken manifest.PodSlice
+		assert.NoError(t, broken.Unmarshal("private", strings.NewReader(fmt.Sprintf(`
+pod "pod-4" {
+  rollback = true
+  unit "unit-4.service" {
+    source = "[Service]\nExecStart=/usr/bin/sleep inf\n"
+  }
+  blob "%s" {
+    source = "test"
+  }
+}
+`, brokenBlob))))
+		evaluator.Allocate(broken[0], env)
+		evaluator.Allocate(registry[1], env)
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{
+			"pod-private-pod-4.service": "active",
+			"unit-4.service":            "active",
+			"pod-private-pod-5.service": "active",
+			"unit-5.service":            "active",
+		}))
+
+		evaluator.Deallocate("pod-5")
+		evaluator.Deallocate("pod-4")
+		fixture.WaitNoErrorT10(t, statesFn(map[string]string{}))
+	})
+
+	evaluator.Close()
+	evaluator.Wait()
+}
@@ -1,11 +1,23 @@
 package provision
 
 import (
+	"fmt"
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/manifest"
+	"strings"
 	"sync"
 )
 
+// Provision statuses of finished allocations
+const (
+	statusRecovered  = "recovered"
+	statusDone       = "done"
+	statusHealthy    = "healthy"
+	statusFailed     = "failed"
+	statusRolledBack = "rolled_back"
+)
+
 type EvaluatorState struct {
 	log *logx.Log
 	mu  sync.Mutex
@@ -13,6 +25,8 @@ type EvaluatorState struct {
 	finished   map[string]*allocation.Pod // Finished evaluations
 	inProgress map[string]*allocation.Pod // Evaluations in progress
 	pending    map[string]*allocation.Pod // Pending allocations
+	status     map[string]string          // Provision status of finished allocations
+	failed     map[string]uint64          // Manifest marks of rolled back allocations
 }
 
 func NewEvaluatorState(log *logx.Log, recovered allocation.PodSlice) (s *EvaluatorState) {
@@ -21,9 +35,12 @@ func NewEvaluatorState(log *logx.Log, recovered allocation.PodSlice) (s *Evaluat
 		finished:   map[string]*allocation.Pod{},
 		inProgress: map[string]*allocation.Pod{},
 		pending:    map[string]*allocation.Pod{},
+		status:     map[string]string{},
+		failed:     map[string]uint64{},
 	}
 	for _, pod := range recovered {
 		s.finished[pod.Name] = pod
+		s.status[pod.Name] = statusRecovered
 	}
 	return
 }
@@ -33,6 +50,9 @@ func (s *EvaluatorState) Submit(name string, pod *allocation.Pod) (next []*Evalu
 	s.log.Tracef(`submit: %s`, name)
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if pod == nil {
+		delete(s.failed, name)
+	}
 	s.pending[name] = pod
 	s.log.Tracef(`submit: registered pending %s`, name)
 	next = s.next()
@@ -47,9 +67,11 @@ func (s *EvaluatorState) Commit(name string) (next []*Evaluation) {
 
 	if in := s.inProgress[name]; in != nil {
 		s.finished[name] = in
+		s.status[name] = statusDone
 		s.log.Tracef(`%s promoted to finished`, name)
 	} else {
 		delete(s.finished, name)
+		delete(s.status, name)
 		s.log.Tracef(`%s removed from finished`, name)
 	}
 	delete(s.inProgress, name)
@@ -58,6 +80,61 @@ func (s *EvaluatorState) Commit(name string) (next []*Evaluation) {
 	return
 }
 
+// SetStatus sets provision status of finished allocation like "healthy" or
+// "failed". Status is not set if given allocation is not finished or is
+// already replaced. Dependents are promoted only if dependency is done and
+// healthy.
+func (s *EvaluatorState) SetStatus(pod *allocation.Pod, status string) (next []*Evaluation, ok bool) {
+	s.log.Tracef(`status: %s %s`, pod.Name, status)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok = s.finished[pod.Name] == pod && s.inProgress[pod.Name] == nil; !ok {
+		return
+	}
+	s.status[pod.Name] = status
+	next = s.next()
+	return
+}
+
+// Finished returns last finished allocation or <nil>
+func (s *EvaluatorState) Finished(name string) (res *allocation.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = s.finished[name]
+	return
+}
+
+// Deployed returns namespaces of finished allocations by name
+func (s *EvaluatorState) Deployed() (res map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = map[string]string{}
+	for name, pod := range s.finished {
+		res[name] = pod.Namespace
+	}
+	return
+}
+
+// Rollback in progress evaluation. Finished allocation is left intact.
+// Allocations with the same manifest are not evaluated until manifest is
+// changed or pod is removed.
+func (s *EvaluatorState) Rollback(name string) (next []*Evaluation) {
+	s.log.Tracef(`rollback: %s`, name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if in := s.inProgress[name]; in != nil {
+		s.failed[name] = in.PodMark
+	}
+	delete(s.inProgress, name)
+	s.log.Tracef(`%s removed from in progress`, name)
+	if _, ok := s.finished[name]; ok {
+		s.status[name] = statusRolledBack
+	}
+	next = s.next()
+	return
+}
+
 func (s *EvaluatorState) next() (next []*Evaluation) {
 LOOP:
 	for pendingName, pending := range s.pending {
@@ -70,6 +147,16 @@ LOOP:
 			s.log.Tracef(`skip promote pending %s: in progress`, pendingName)
 			continue LOOP
 		}
+		if mark, failed := s.failed[pendingName]; failed && pending != nil && pending.PodMark == mark {
+			delete(s.pending, pendingName)
+			s.log.Debugf(`pending %s removed: manifest %x is rolled back`, pendingName, mark)
+			continue LOOP
+		}
+		// check for dependencies
+		if err := s.checkDependencies(pendingName, pending); err != nil {
+			s.log.Debugf(`skip promote pending %s: %v`, pendingName, err)
+			continue LOOP
+		}
 		// check for blockers
 		for _, finished := range s.finished {
 			if finished.Name != pendingName {
@@ -88,9 +175,90 @@ LOOP:
 		}
 		s.inProgress[pendingName] = pending
 		delete(s.pending, pendingName)
+		delete(s.failed, pendingName)
 		next = append(next, NewEvaluation(s.finished[pendingName], pending))
 		s.log.Tracef(`pending %s promoted to in progress`, pendingName)
 	}
 	s.log.Debugf(`next: %s`, next)
 	return
 }
+
+// checkDependencies returns error if pending allocation should wait for
+// dependencies. Pods are created and updated only after all their
+// dependencies are done and healthy. Dependencies are destroyed only after
+// all dependents.
+func (s *EvaluatorState) checkDependencies(name string, pending *allocation.Pod) (err error) {
+	if pending != nil {
+		if cycle := manifest.DependencyCycle(name, s.dependsOn); cycle != nil {
+			err = fmt.Errorf(`dependency cycle %s`, strings.Join(cycle, " -> "))
+			s.log.Errorf(`pending %s is blocked: %v`, name, err)
+			return
+		}
+		for _, dependency := range pending.DependsOn {
+			if _, ok := s.inProgress[dependency]; ok {
+				err = fmt.Errorf(`dependency %s is in progress`, dependency)
+				return
+			}
+			if dependencyPending, ok := s.pending[dependency]; ok && dependencyPending != nil && !allocation.IsEqual(s.finished[dependency], dependencyPending) {
+				err = fmt.Errorf(`dependency %s is pending`, dependency)
+				return
+			}
+			if _, ok := s.finished[dependency]; !ok {
+				err = fmt.Errorf(`dependency %s is not deployed`, dependency)
+				return
+			}
+			if !s.isReady(dependency) {
+				err = fmt.Errorf(`dependency %s is %s`, dependency, s.status[dependency])
+				return
+			}
+		}
+		return
+	}
+	for _, pods := range []map[string]*allocation.Pod{s.finished, s.inProgress} {
+		for dependentName, dependent := range pods {
+			if dependent != nil && dependsOn(dependent, name) {
+				err = fmt.Errorf(`dependent %s is not destroyed`, dependentName)
+				return
+			}
+		}
+	}
+	return
+}
+
+// isReady returns true if finished allocation is recovered, rolled back,
+// healthy or done without health checks
+func (s *EvaluatorState) isReady(name string) (ok bool) {
+	switch s.status[name] {
+	case statusRecovered, statusRolledBack, statusHealthy:
+		ok = true
+	case statusDone:
+		ok = true
+		for _, unit := range s.finished[name].Units {
+			ok = ok && unit.Health == nil
+		}
+	}
+	return
+}
+
+// dependsOn returns dependencies of latest known allocation with given name
+func (s *EvaluatorState) dependsOn(name string) (res []string) {
+	for _, pods := range []map[string]*allocation.Pod{s.pending, s.inProgress, s.finished} {
+		if pod, ok := pods[name]; ok {
+			if pod != nil {
+				res = pod.DependsOn
+			}
+			return
+		}
+	}
+	return
+}
+
+func dependsOn(pod *allocation.Pod, name string) (ok bool) {
+	for _, dependency := range pod.DependsOn {
+		if dependency == name {
+			ok = true
+			return
+		}
+	}
+	return
+}
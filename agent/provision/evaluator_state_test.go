@@ -4,6 +4,7 @@ package provision_test
 
 import (
 	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/agent/provision"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -51,4 +52,134 @@ func TestEvaluatorState_Submit(t *testing.T) {
 		next := state.Submit("pod-1", makeAllocations(t, "testdata/evaluator_state_test_4.hcl")[0])
 		assert.Len(t, next, 1, "pod-1 should be evaluated")
 	})
+	t.Run("5 rollback changed pod-1", func(t *testing.T) {
+		state := zeroEvaluatorState(t)
+		changed := makeAllocations(t, "testdata/evaluator_state_test_4.hcl")[0]
+		next := state.Submit("pod-1", changed)
+		assert.Len(t, next, 1, "pod-1 should be evaluated")
+		next = state.Rollback("pod-1")
+		assert.Len(t, next, 0)
+
+		next = state.Submit("pod-1", changed)
+		assert.Len(t, next, 0, "rolled back pod-1 should not be evaluated again")
+
+		fixed := *changed
+		fixed.PodMark++
+		next = state.Submit("pod-1", &fixed)
+		assert.Len(t, next, 1, "pod-1 with changed manifest should be evaluated")
+		assert.NotNil(t, next[0].Left)
+		assert.Len(t, next[0].Left.Units, 2, "left should be recovered pod-1")
+	})
+	t.Run("6 resubmit removed rolled back pod-1", func(t *testing.T) {
+		state := zeroEvaluatorState(t)
+		changed := makeAllocations(t, "testdata/evaluator_state_test_4.hcl")[0]
+		assert.Len(t, state.Submit("pod-1", changed), 1)
+		assert.Len(t, state.Rollback("pod-1"), 0)
+
+		next := state.Submit("pod-1", nil)
+		assert.Len(t, next, 1, "pod-1 should be destroyed")
+		assert.Len(t, state.Commit("pod-1"), 0)
+
+		next = state.Submit("pod-1", changed)
+		assert.Len(t, next, 1, "pod-1 should be evaluated after removal")
+	})
+}
+
+func TestEvaluatorState_DependsOn(t *testing.T) {
+	allocs := makeAllocations(t, "testdata/evaluator_state_test_depends.hcl")
+	byName := map[string]*allocation.Pod{}
+	for _, alloc := range allocs {
+		byName[alloc.Name] = alloc
+	}
+	var app, db = byName["app"], byName["db"]
+	assert.Equal(t, []string{"db"}, app.DependsOn)
+
+	t.Run(`create`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), nil)
+		next := state.Submit("app", app)
+		assert.Len(t, next, 0, "app should wait for db")
+
+		next = state.Submit("db", db)
+		assert.Len(t, next, 1)
+		assert.Equal(t, "db", next[0].Name())
+
+		next = state.Commit("db")
+		assert.Len(t, next, 1)
+		assert.Equal(t, "app", next[0].Name())
+	})
+	t.Run(`destroy`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), allocs)
+		next := state.Submit("db", nil)
+		assert.Len(t, next, 0, "db should wait for app")
+
+		next = state.Submit("app", nil)
+		assert.Len(t, next, 1)
+		assert.Equal(t, "app", next[0].Name())
+
+		next = state.Commit("app")
+		assert.Len(t, next, 1)
+		assert.Equal(t, "db", next[0].Name())
+		assert.Nil(t, next[0].Right)
+	})
+	var cache, worker = byName["cache"], byName["worker"]
+	t.Run(`health`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), nil)
+		next := state.Submit("worker", worker)
+		assert.Len(t, next, 0, "worker should wait for cache")
+
+		next = state.Submit("cache", cache)
+		assert.Len(t, next, 1)
+		next = state.Commit("cache")
+		assert.Len(t, next, 0, "worker should wait for healthy cache")
+		next, ok := state.SetStatus(cache, "failed")
+		assert.True(t, ok)
+		assert.Len(t, next, 0, "worker should wait for healthy cache")
+
+		changed := *cache
+		_, ok = state.SetStatus(&changed, "healthy")
+		assert.False(t, ok, "status of replaced allocation should be ignored")
+
+		next, ok = state.SetStatus(cache, "healthy")
+		assert.True(t, ok)
+		assert.Len(t, next, 1)
+		assert.Equal(t, "worker", next[0].Name())
+	})
+	t.Run(`rolled back dependency`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), []*allocation.Pod{db})
+		changed := *db
+		changed.AgentMark++
+		next := state.Submit("db", &changed)
+		assert.Len(t, next, 1)
+		next = state.Submit("app", app)
+		assert.Len(t, next, 0, "app should wait for db")
+
+		next = state.Rollback("db")
+		assert.Len(t, next, 1, "app should be created on restored db")
+		assert.Equal(t, "app", next[0].Name())
+	})
+	t.Run(`rolled back created dependency`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), nil)
+		next := state.Submit("db", db)
+		assert.Len(t, next, 1)
+		next = state.Submit("app", app)
+		assert.Len(t, next, 0, "app should wait for db")
+
+		next = state.Rollback("db")
+		assert.Len(t, next, 0, "app should wait for db")
+		assert.Nil(t, state.Finished("db"))
+		assert.Equal(t, map[string]string{}, state.Deployed())
+	})
+	t.Run(`cycle`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), nil)
+		assert.Len(t, state.Submit("loop-1", byName["loop-1"]), 0)
+		assert.Len(t, state.Submit("loop-2", byName["loop-2"]), 0)
+	})
+	t.Run(`unchanged dependency`, func(t *testing.T) {
+		state := provision.NewEvaluatorState(logx.GetLog("test"), []*allocation.Pod{db})
+		next := state.Submit("db", db)
+		assert.Len(t, next, 0)
+		next = state.Submit("app", app)
+		assert.Len(t, next, 1)
+		assert.Equal(t, "app", next[0].Name())
+	})
 }
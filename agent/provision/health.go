@@ -0,0 +1,125 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const healthCheckInterval = time.Second
+
+// CheckHealth waits for all units with health checks to become healthy.
+// Returns failures in form "<unit>: <error>".
+func CheckHealth(ctx context.Context, conn lib.SystemdConn, units allocation.UnitSlice) (failures []string) {
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	for _, unit := range units {
+		if unit.Health == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(unit *allocation.Unit) {
+			defer wg.Done()
+			if err := checkUnitHealth(ctx, conn, unit.UnitName(), *unit.Health); err != nil {
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("%s: %v", unit.UnitName(), err))
+				mu.Unlock()
+			}
+		}(unit)
+	}
+	wg.Wait()
+	return
+}
+
+func checkUnitHealth(ctx context.Context, conn lib.SystemdConn, unitName string, health manifest.Health) (err error) {
+	timeout, err := health.GetTimeout()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		if err = checkActiveState(conn, unitName); err == nil {
+			err = ProbeHealth(ctx, health)
+		}
+		if err == errUnitFailed || err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("timeout: %v", err)
+			return
+		case <-time.After(healthCheckInterval):
+		}
+	}
+}
+
+var errUnitFailed = fmt.Errorf("unit failed")
+
+func checkActiveState(conn lib.SystemdConn, unitName string) (err error) {
+	statuses, err := conn.ListUnits()
+	if err != nil {
+		return
+	}
+	state := "inactive"
+	for _, status := range statuses {
+		if status.Name == unitName {
+			state = status.ActiveState
+			break
+		}
+	}
+	switch state {
+	case "active":
+	case "failed":
+		err = errUnitFailed
+	default:
+		err = fmt.Errorf("unit is %s", state)
+	}
+	return
+}
+
+// ProbeHealth runs all probes defined in health check once
+func ProbeHealth(ctx context.Context, health manifest.Health) (err error) {
+	if health.Exec != "" {
+		args := strings.Fields(health.Exec)
+		if len(args) == 0 {
+			err = fmt.Errorf("exec is empty")
+			return
+		}
+		if err = exec.CommandContext(ctx, args[0], args[1:]...).Run(); err != nil {
+			err = fmt.Errorf("exec %s: %v", health.Exec, err)
+			return
+		}
+	}
+	if health.TCP != "" {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", health.TCP, healthCheckInterval); err != nil {
+			return
+		}
+		conn.Close()
+	}
+	if health.HTTP != "" {
+		var req *http.Request
+		if req, err = http.NewRequest(http.MethodGet, health.HTTP, nil); err != nil {
+			return
+		}
+		var resp *http.Response
+		if resp, err = (&http.Client{Timeout: healthCheckInterval}).Do(req.WithContext(ctx)); err != nil {
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err = fmt.Errorf("http %s: %s", health.HTTP, resp.Status)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,52 @@
+// +build ide test_unit
+
+package provision_test
+
+import (
+	"context"
+	"github.com/akaspin/soil/agent/provision"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeHealth(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	t.Run(`empty`, func(t *testing.T) {
+		assert.NoError(t, provision.ProbeHealth(ctx, manifest.Health{}))
+	})
+	t.Run(`exec ok`, func(t *testing.T) {
+		assert.NoError(t, provision.ProbeHealth(ctx, manifest.Health{Exec: "true"}))
+	})
+	t.Run(`exec empty`, func(t *testing.T) {
+		assert.Error(t, provision.ProbeHealth(ctx, manifest.Health{Exec: "  "}))
+	})
+	t.Run(`exec fail`, func(t *testing.T) {
+		assert.Error(t, provision.ProbeHealth(ctx, manifest.Health{Exec: "false"}))
+	})
+	t.Run(`tcp ok`, func(t *testing.T) {
+		assert.NoError(t, provision.ProbeHealth(ctx, manifest.Health{TCP: srv.Listener.Addr().String()}))
+	})
+	t.Run(`tcp fail`, func(t *testing.T) {
+		assert.Error(t, provision.ProbeHealth(ctx, manifest.Health{TCP: closedAddr}))
+	})
+	t.Run(`http ok`, func(t *testing.T) {
+		assert.NoError(t, provision.ProbeHealth(ctx, manifest.Health{HTTP: srv.URL + "/ok"}))
+	})
+	t.Run(`http fail`, func(t *testing.T) {
+		assert.Error(t, provision.ProbeHealth(ctx, manifest.Health{HTTP: srv.URL + "/fail"}))
+	})
+}
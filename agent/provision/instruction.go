@@ -3,24 +3,32 @@ package provision
 import (
 	"fmt"
 	"github.com/akaspin/soil/agent/allocation"
-	"github.com/coreos/go-systemd/dbus"
+	"github.com/akaspin/soil/lib"
 	"os"
+	"path/filepath"
 )
 
 const (
-	phaseDestroyCommand = iota // execute unit commands on destroy
-	phaseDestroyUnits          // Destroy units from filesystem
-	phaseDeployFS              // Write units to filesystem
-	phaseDeployPerm            // Enable or disable units
-	phaseDeployCommand         // Execute create/modify unit commands
-	phaseDestroyBlobs          // Destroy blobs from filesystem
+	phaseDestroyCommand       = iota // execute unit commands on destroy
+	phaseDestroyUnits                // Destroy units from filesystem
+	phaseDeployFS                    // Write units to filesystem
+	phaseDeployPerm                  // Enable or disable units
+	phaseDeployCommand               // Execute create/modify unit commands
+	phaseDestroyBlobs                // Destroy blobs from filesystem
+	phaseDestroyDropInCommand        // Execute parent unit commands for removed drop-ins
 )
 
+func isDeployPhase(phase int) bool {
+	return phase >= phaseDeployFS && phase <= phaseDeployCommand
+}
+
 // Instruction represents one atomic instruction bounded to specific phase
 type Instruction interface {
 	Phase() int
-	Execute(conn *dbus.Conn) (err error)
+	Execute(conn lib.SystemdConn) (err error)
 	String() string
+	Action() string // "write-unit", "start" etc.
+	Path() string   // unit or blob path
 }
 
 type baseUnitInstruction struct {
@@ -41,6 +49,14 @@ func (i *baseUnitInstruction) Phase() int {
 	return i.phase
 }
 
+func (i *baseUnitInstruction) Action() string {
+	return i.explain
+}
+
+func (i *baseUnitInstruction) Path() string {
+	return i.unitFile.Path
+}
+
 func (i *baseUnitInstruction) String() string {
 	return fmt.Sprintf("%d:%s:%s", i.phase, i.explain, i.unitFile.Path)
 }
@@ -56,7 +72,7 @@ func NewWriteUnitInstruction(unitFile allocation.UnitFile) *WriteUnitInstruction
 	}
 }
 
-func (i *WriteUnitInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *WriteUnitInstruction) Execute(conn lib.SystemdConn) (err error) {
 	if err = i.unitFile.Write(); err != nil {
 		return
 	}
@@ -73,7 +89,7 @@ func NewDeleteUnitInstruction(unitFile allocation.UnitFile) *DeleteUnitInstructi
 	return &DeleteUnitInstruction{newBaseInstruction(phaseDestroyUnits, "delete-unit", unitFile)}
 }
 
-func (i *DeleteUnitInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *DeleteUnitInstruction) Execute(conn lib.SystemdConn) (err error) {
 	conn.DisableUnitFiles([]string{i.unitFile.UnitName()}, i.unitFile.IsRuntime())
 	if err = os.Remove(i.unitFile.Path); err != nil {
 		return
@@ -90,7 +106,7 @@ func NewEnableUnitInstruction(unitFile allocation.UnitFile) *EnableUnitInstructi
 	return &EnableUnitInstruction{newBaseInstruction(phaseDeployPerm, "enable-unit", unitFile)}
 }
 
-func (i *EnableUnitInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *EnableUnitInstruction) Execute(conn lib.SystemdConn) (err error) {
 	_, _, err = conn.EnableUnitFiles([]string{i.unitFile.Path}, i.unitFile.IsRuntime(), false)
 	return
 }
@@ -103,7 +119,7 @@ func NewDisableUnitInstruction(unitFile allocation.UnitFile) *DisableUnitInstruc
 	return &DisableUnitInstruction{newBaseInstruction(phaseDeployPerm, "disable-unit", unitFile)}
 }
 
-func (i *DisableUnitInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *DisableUnitInstruction) Execute(conn lib.SystemdConn) (err error) {
 	_, err = conn.DisableUnitFiles([]string{i.unitFile.UnitName()}, i.unitFile.IsRuntime())
 	return
 }
@@ -120,7 +136,7 @@ func NewCommandInstruction(phase int, unitFile allocation.UnitFile, command stri
 	}
 }
 
-func (i *CommandInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *CommandInstruction) Execute(conn lib.SystemdConn) (err error) {
 	ch := make(chan string)
 	switch i.command {
 	case "start":
@@ -157,6 +173,14 @@ func (i *baseBlobInstruction) Phase() int {
 	return i.phase
 }
 
+func (i *baseBlobInstruction) Action() string {
+	return i.explain
+}
+
+func (i *baseBlobInstruction) Path() string {
+	return i.blob.Name
+}
+
 func (i *baseBlobInstruction) String() string {
 	return fmt.Sprintf("%d:%s:%s", i.phase, i.explain, i.blob.Name)
 }
@@ -176,7 +200,7 @@ func NewWriteBlobInstruction(phase int, blob *allocation.Blob) (i *WriteBlobInst
 	return
 }
 
-func (i *WriteBlobInstruction) Execute(conn *dbus.Conn) (err error) {
+func (i *WriteBlobInstruction) Execute(conn lib.SystemdConn) (err error) {
 	err = i.baseBlobInstruction.blob.Write()
 	return
 }
@@ -196,7 +220,80 @@ func NewDestroyBlobInstruction(phase int, blob *allocation.Blob) (i *DestroyBlob
 	return
 }
 
-func (i *DestroyBlobInstruction) Execute(conn *dbus.Conn) (err error) {
-	err = os.Remove(i.blob.Name)
+func (i *DestroyBlobInstruction) Execute(conn lib.SystemdConn) (err error) {
+	err = i.blob.Remove()
+	return
+}
+
+type baseDropInInstruction struct {
+	phase   int
+	explain string
+	dropIn  *allocation.DropIn
+}
+
+func (i *baseDropInInstruction) Phase() int {
+	return i.phase
+}
+
+func (i *baseDropInInstruction) Action() string {
+	return i.explain
+}
+
+func (i *baseDropInInstruction) Path() string {
+	return i.dropIn.Path
+}
+
+func (i *baseDropInInstruction) String() string {
+	return fmt.Sprintf("%d:%s:%s", i.phase, i.explain, i.dropIn.Path)
+}
+
+// WriteDropInInstruction writes drop-in to filesystem and runs daemon reload
+type WriteDropInInstruction struct {
+	*baseDropInInstruction
+}
+
+func NewWriteDropInInstruction(dropIn *allocation.DropIn) (i *WriteDropInInstruction) {
+	i = &WriteDropInInstruction{
+		&baseDropInInstruction{
+			phase:   phaseDeployFS,
+			explain: "write-dropin",
+			dropIn:  dropIn,
+		},
+	}
+	return
+}
+
+func (i *WriteDropInInstruction) Execute(conn lib.SystemdConn) (err error) {
+	if err = i.dropIn.Write(); err != nil {
+		return
+	}
+	err = conn.Reload()
+	return
+}
+
+// DeleteDropInInstruction removes drop-in from filesystem and runs daemon
+// reload
+type DeleteDropInInstruction struct {
+	*baseDropInInstruction
+}
+
+func NewDeleteDropInInstruction(dropIn *allocation.DropIn) (i *DeleteDropInInstruction) {
+	i = &DeleteDropInInstruction{
+		&baseDropInInstruction{
+			phase:   phaseDestroyUnits,
+			explain: "delete-dropin",
+			dropIn:  dropIn,
+		},
+	}
+	return
+}
+
+func (i *DeleteDropInInstruction) Execute(conn lib.SystemdConn) (err error) {
+	if err = os.Remove(i.dropIn.Path); err != nil {
+		return
+	}
+	// remove "<unit>.d" directory only if it is empty
+	os.Remove(filepath.Dir(i.dropIn.Path))
+	err = conn.Reload()
 	return
 }
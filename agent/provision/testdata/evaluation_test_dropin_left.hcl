@@ -0,0 +1,9 @@
+pod "pod-1" {
+  runtime = false
+  dropin "docker.service" "10-soil.conf" {
+    source = "[Service]\nEnvironment=A=1"
+  }
+  dropin "docker.service" "20-soil.conf" {
+    source = "[Service]\nEnvironment=B=1"
+  }
+}
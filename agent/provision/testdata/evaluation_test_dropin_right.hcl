@@ -0,0 +1,13 @@
+pod "pod-1" {
+  runtime = false
+  dropin "docker.service" "10-soil.conf" {
+    source = "[Service]\nEnvironment=A=2"
+  }
+  dropin "docker.service" "20-soil.conf" {
+    source = "[Service]\nEnvironment=B=2"
+  }
+  dropin "nginx.service" "10-soil.conf" {
+    update = "reload"
+    source = "[Service]\nEnvironment=C=1"
+  }
+}
@@ -0,0 +1,51 @@
+// "app" depends on "db", "worker" depends on "cache" with health check.
+// "loop-1" and "loop-2" depend on each other.
+
+pod "db" {
+  unit "db-1.service" {
+    source = <<EOF
+      [Service]
+      ExecStart=/usr/bin/sleep inf
+    EOF
+  }
+}
+
+pod "app" {
+  depends_on = ["db"]
+  unit "app-1.service" {
+    source = <<EOF
+      [Service]
+      ExecStart=/usr/bin/sleep inf
+    EOF
+  }
+}
+
+pod "cache" {
+  unit "cache-1.service" {
+    source = <<EOF
+      [Service]
+      ExecStart=/usr/bin/sleep inf
+    EOF
+    health {
+      exec = "/usr/bin/true"
+    }
+  }
+}
+
+pod "worker" {
+  depends_on = ["cache"]
+  unit "worker-1.service" {
+    source = <<EOF
+      [Service]
+      ExecStart=/usr/bin/sleep inf
+    EOF
+  }
+}
+
+pod "loop-1" {
+  depends_on = ["loop-2"]
+}
+
+pod "loop-2" {
+  depends_on = ["loop-1"]
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/agent/bus/pipe"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/agent/resource/estimator"
 	"github.com/akaspin/soil/manifest"
 	"github.com/akaspin/supervisor"
@@ -30,6 +31,7 @@ type Evaluator struct {
 	log        *logx.Log
 	upstream   bus.Consumer // upstream bus consumer
 	downstream bus.Consumer // downstream consumer
+	reporter   metrics.Reporter
 
 	allocations map[string]allocation.ResourceSlice // allocations by pod
 	sandboxes   map[string]*Sandbox
@@ -40,11 +42,12 @@ type Evaluator struct {
 	deallocateChan chan string
 }
 
-func NewEvaluator(ctx context.Context, log *logx.Log, upstream, downstream bus.Consumer, dirty allocation.PodSlice) (e *Evaluator) {
+func NewEvaluator(ctx context.Context, log *logx.Log, upstream, downstream bus.Consumer, reporter metrics.Reporter, dirty allocation.PodSlice) (e *Evaluator) {
 	e = &Evaluator{
 		Control:        supervisor.NewControl(ctx),
 		log:            log.GetLog("resource", "evaluator"),
 		upstream:       pipe.NewLift("provider", upstream),
+		reporter:       reporter,
 		allocations:    map[string]allocation.ResourceSlice{},
 		sandboxes:      map[string]*Sandbox{},
 		providerOpChan: make(chan opProvider),
@@ -116,7 +119,7 @@ func (e *Evaluator) GetConstraint(pod *manifest.Pod) (c manifest.Constraint) {
 	for _, r := range pod.Resources {
 		c1[fmt.Sprintf("${provider.%s.allocated}", r.Provider)] = "true"
 	}
-	c = pod.Constraint.Merge(c1)
+	c = pod.Constraint.Merge(c1, pod.GetCounterConstraint())
 	return
 }
 
@@ -128,7 +131,7 @@ func (e *Evaluator) Allocate(pod *manifest.Pod, env map[string]string) {
 		}
 		select {
 		case <-e.Control.Ctx().Done():
-			e.log.Warningf(`skip allocate "%s": %v`, pod, e.Control.Ctx().Err())
+			e.log.Warningf(`skip allocate "%s": %v`, pod.Name, e.Control.Ctx().Err())
 		case e.allocateChan <- &alloc:
 			e.log.Tracef(`allocate sent: "%s"`, alloc)
 		}
@@ -242,6 +245,7 @@ LOOP:
 					sandbox.Destroy(id)
 				}
 			}
+			e.reportAllocations()
 		case podName := <-e.deallocateChan:
 			if resources, ok := e.allocations[podName]; ok {
 				for _, resource := range resources {
@@ -253,6 +257,7 @@ LOOP:
 					e.log.Warningf(`destroy "%s": provider "%s" not found`, id, resource.Request.Provider)
 				}
 				delete(e.allocations, podName)
+				e.reportAllocations()
 				e.log.Infof(`deallocated "%s"`, podName)
 				continue LOOP
 			}
@@ -261,6 +266,22 @@ LOOP:
 	}
 }
 
+// reportAllocations reports number of allocated resources for each provider
+func (e *Evaluator) reportAllocations() {
+	counts := map[string]int{}
+	for provider := range e.sandboxes {
+		counts[provider] = 0
+	}
+	for _, resources := range e.allocations {
+		for _, res := range resources {
+			counts[res.Request.Provider]++
+		}
+	}
+	for provider, count := range counts {
+		e.reporter.Gauge("resource_allocations", float64(count), "provider:"+provider)
+	}
+}
+
 func (e *Evaluator) createSandbox(id string, alloc *allocation.Provider) (s *Sandbox) {
 	s = NewSandbox(
 		SandboxConfig{
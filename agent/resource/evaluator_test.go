@@ -8,6 +8,7 @@ import (
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/agent/resource"
 	"github.com/akaspin/soil/fixture"
 	"github.com/akaspin/soil/manifest"
@@ -21,7 +22,7 @@ func TestEvaluator_GetConstraint(t *testing.T) {
 
 	upstream := bus.NewTestingConsumer(ctx)
 	downstream := bus.NewTestingConsumer(ctx)
-	evaluator := resource.NewEvaluator(ctx, logx.GetLog("test"), upstream, downstream, nil)
+	evaluator := resource.NewEvaluator(ctx, logx.GetLog("test"), upstream, downstream, &metrics.BlackHole{}, nil)
 	assert.NoError(t, evaluator.Open())
 
 	t.Run(`with resources`, func(t *testing.T) {
@@ -130,7 +131,7 @@ func TestNewEvaluator(t *testing.T) {
 
 			upstream := bus.NewTestingConsumer(ctx)
 			downstream := bus.NewTestingConsumer(ctx)
-			evaluator := resource.NewEvaluator(ctx, logx.GetLog("test"), upstream, downstream, dirty)
+			evaluator := resource.NewEvaluator(ctx, logx.GetLog("test"), upstream, downstream, &metrics.BlackHole{}, dirty)
 			assert.NoError(t, evaluator.Open())
 
 			t.Run(`recovery`, func(t *testing.T) {
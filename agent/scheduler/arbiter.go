@@ -2,8 +2,10 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
 	"github.com/akaspin/logx"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/manifest"
 	"github.com/akaspin/supervisor"
 	"regexp"
@@ -13,11 +15,13 @@ type arbiterEntity struct {
 	id         string
 	constraint manifest.Constraint
 	notifyFn   func(error, bus.Message)
+	dryRun     bool // entity is evaluated without binding
 }
 
 type ArbiterConfig struct {
 	Required       manifest.Constraint
 	ConstraintOnly []*regexp.Regexp
+	Reporter       metrics.Reporter // Optional metrics reporter
 }
 
 type Arbiter struct {
@@ -30,21 +34,42 @@ type Arbiter struct {
 	env      bus.Message
 	entities map[string]arbiterEntity
 
-	messageChan chan bus.Message
-	bindChan    chan arbiterEntity
-	unbindChan  chan arbiterEntity
+	messageChan  chan bus.Message
+	bindChan     chan arbiterEntity
+	unbindChan   chan arbiterEntity
+	evaluateChan chan arbiterEntity
+	explainChan  chan arbiterExplainRequest
+	stateChan    chan chan map[string]string
+}
+
+type arbiterExplainRequest struct {
+	id      string
+	resChan chan arbiterExplainResult
+}
+
+type arbiterExplainResult struct {
+	constraint manifest.Constraint
+	state      map[string]string
+	ok         bool
 }
 
 func NewArbiter(ctx context.Context, log *logx.Log, name string, config ArbiterConfig) (a *Arbiter) {
 	a = &Arbiter{
-		Control:     supervisor.NewControl(ctx),
-		log:         log.GetLog("arbiter", name),
-		config:      config,
-		state:       bus.NewMessage(name, nil),
-		entities:    map[string]arbiterEntity{},
-		messageChan: make(chan bus.Message),
-		bindChan:    make(chan arbiterEntity),
-		unbindChan:  make(chan arbiterEntity),
+		Control:      supervisor.NewControl(ctx),
+		log:          log.GetLog("arbiter", name),
+		name:         name,
+		config:       config,
+		state:        bus.NewMessage(name, nil),
+		entities:     map[string]arbiterEntity{},
+		messageChan:  make(chan bus.Message),
+		bindChan:     make(chan arbiterEntity),
+		unbindChan:   make(chan arbiterEntity),
+		evaluateChan: make(chan arbiterEntity),
+		explainChan:  make(chan arbiterExplainRequest),
+		stateChan:    make(chan chan map[string]string),
+	}
+	if a.config.Reporter == nil {
+		a.config.Reporter = &metrics.BlackHole{}
 	}
 	return
 }
@@ -80,6 +105,49 @@ func (a *Arbiter) Unbind(id string, callback func()) {
 	}
 }
 
+// Evaluate constraint against current arbiter state without binding. Callback
+// is invoked exactly once. Evaluations are not reported to metrics.
+func (a *Arbiter) Evaluate(constraint manifest.Constraint, callback func(error, bus.Message)) {
+	select {
+	case <-a.Control.Ctx().Done():
+		callback(a.Control.Ctx().Err(), bus.NewMessage(a.name, nil))
+	case a.evaluateChan <- arbiterEntity{
+		constraint: constraint,
+		notifyFn:   callback,
+		dryRun:     true,
+	}:
+	}
+}
+
+// Explain returns constraint bound to entity including required constraint
+// and current arbiter state. If entity is not bound ok is false.
+func (a *Arbiter) Explain(id string) (constraint manifest.Constraint, state map[string]string, ok bool) {
+	resChan := make(chan arbiterExplainResult, 1)
+	select {
+	case <-a.Control.Ctx().Done():
+		return
+	case a.explainChan <- arbiterExplainRequest{
+		id:      id,
+		resChan: resChan,
+	}:
+	}
+	res := <-resChan
+	constraint, state, ok = res.constraint, res.state, res.ok
+	return
+}
+
+// State returns current arbiter state which is used to check constraints
+func (a *Arbiter) State() (state map[string]string) {
+	resChan := make(chan map[string]string, 1)
+	select {
+	case <-a.Control.Ctx().Done():
+		return
+	case a.stateChan <- resChan:
+	}
+	state = <-resChan
+	return
+}
+
 func (a *Arbiter) ConsumeMessage(message bus.Message) (err error) {
 	select {
 	case <-a.Control.Ctx().Done():
@@ -115,10 +183,40 @@ LOOP:
 			delete(a.entities, req.id)
 			log.Infof(`unregistered "%s"`, req.id)
 			req.notifyFn(nil, bus.NewMessage(a.name, nil))
+		case req := <-a.evaluateChan:
+			if a.state.Payload().IsEmpty() {
+				req.notifyFn(fmt.Errorf("state is empty"), bus.NewMessage(a.name, nil))
+				continue LOOP
+			}
+			a.notify(req)
+		case req := <-a.explainChan:
+			entity, ok := a.entities[req.id]
+			if !ok {
+				req.resChan <- arbiterExplainResult{}
+				continue LOOP
+			}
+			req.resChan <- arbiterExplainResult{
+				constraint: entity.constraint.Merge(a.config.Required),
+				state:      a.stateMap(),
+				ok:         true,
+			}
+		case resChan := <-a.stateChan:
+			resChan <- a.stateMap()
 		}
 	}
 }
 
+// stateMap returns copy of current state
+func (a *Arbiter) stateMap() (state map[string]string) {
+	state = map[string]string{}
+	if !a.state.Payload().IsEmpty() {
+		if err := a.state.Payload().Unmarshal(&state); err != nil {
+			a.log.Error(err)
+		}
+	}
+	return
+}
+
 func (a *Arbiter) updateCache() {
 	if len(a.config.ConstraintOnly) == 0 {
 		a.env = bus.NewMessage(a.state.Topic(), a.state.Payload())
@@ -136,8 +234,8 @@ LOOP:
 			if reg.MatchString(k) {
 				continue LOOP
 			}
-			env[k] = v
 		}
+		env[k] = v
 	}
 	a.env = bus.NewMessage(a.state.Topic(), env)
 }
@@ -158,15 +256,25 @@ func (a *Arbiter) notify(entity arbiterEntity) {
 	if a.config.Required != nil {
 		if err := a.config.Required.Check(statePayload); err != nil {
 			a.log.Warningf(`notifying "%s" (required): %v`, entity.id, err)
+			a.report(entity, "failed")
 			entity.notifyFn(err, bus.NewMessage(a.name, nil))
 			return
 		}
 	}
 	if err := entity.constraint.Check(statePayload); err != nil {
 		a.log.Debugf(`notifying "%s": %v`, entity.id, err)
+		a.report(entity, "failed")
 		entity.notifyFn(err, bus.NewMessage(a.name, nil))
 		return
 	}
 	a.log.Debugf(`notifying "%s": ok:%x`, entity.id, a.env.Payload().Hash())
+	a.report(entity, "passed")
 	entity.notifyFn(nil, a.env)
 }
+
+func (a *Arbiter) report(entity arbiterEntity, result string) {
+	if entity.dryRun {
+		return
+	}
+	a.config.Reporter.Count("arbiter_notifications_total", 1, "arbiter:"+a.name, "result:"+result)
+}
@@ -6,7 +6,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
 	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/agent/scheduler"
 	"github.com/akaspin/soil/fixture"
 	"github.com/akaspin/soil/manifest"
@@ -245,3 +247,183 @@ func TestArbiter_ConsumeMessage(t *testing.T) {
 	}
 
 }
+
+func TestArbiter_Evaluate(t *testing.T) {
+	reporter := metrics.NewDummy("test")
+	arbiter := scheduler.NewArbiter(context.Background(), logx.GetLog("test"), "test",
+		scheduler.ArbiterConfig{
+			Required: manifest.Constraint{"${drain}": "!= true"},
+			Reporter: reporter,
+		},
+	)
+	assert.NoError(t, arbiter.Open())
+	defer arbiter.Close()
+
+	evaluate := func(constraint manifest.Constraint) (err error, message bus.Message) {
+		done := make(chan struct{})
+		arbiter.Evaluate(constraint, func(reason error, msg bus.Message) {
+			err, message = reason, msg
+			close(done)
+		})
+		<-done
+		return
+	}
+
+	t.Run("empty state", func(t *testing.T) {
+		err, _ := evaluate(manifest.Constraint{"${1}": "true"})
+		assert.EqualError(t, err, "state is empty")
+	})
+	arbiter.ConsumeMessage(bus.NewMessage("", map[string]string{
+		"1": "true",
+	}))
+	t.Run("ok", func(t *testing.T) {
+		err, message := evaluate(manifest.Constraint{"${1}": "true"})
+		assert.NoError(t, err)
+		var env map[string]string
+		assert.NoError(t, message.Payload().Unmarshal(&env))
+		assert.Equal(t, map[string]string{"1": "true"}, env)
+	})
+	t.Run("fail", func(t *testing.T) {
+		err, _ := evaluate(manifest.Constraint{"${2}": "true"})
+		assert.EqualError(t, err, `constraint failed: "${2}":"true" ("${2}":"true")`)
+	})
+	t.Run("not reported", func(t *testing.T) {
+		assert.Empty(t, reporter.Data)
+	})
+}
+
+func TestArbiter_ConstraintOnly(t *testing.T) {
+	arbiter := scheduler.NewArbiter(context.Background(), logx.GetLog("test"), "test",
+		scheduler.ArbiterConfig{
+			ConstraintOnly: []*regexp.Regexp{
+				regexp.MustCompile(`^provision\..+`),
+				regexp.MustCompile(`^counter\..+`),
+				regexp.MustCompile(`^unit\..+`),
+			},
+		},
+	)
+	assert.NoError(t, arbiter.Open())
+	defer arbiter.Close()
+
+	entity := &dummyArbiterEntity{}
+	arbiter.ConsumeMessage(bus.NewMessage("", map[string]string{
+		"meta.rack":                           "left",
+		"provision.pod-1.state":               "done",
+		"counter.pod-1.slots":                 "1",
+		"unit.pod-1.unit-1.service.sub_state": "running",
+	}))
+	arbiter.Bind("1", manifest.Constraint{
+		"${counter.pod-1.slots}":                 "1",
+		"${unit.pod-1.unit-1.service.sub_state}": "running",
+	}, entity.notify)
+	fixture.WaitNoErrorT10(t, func() (err error) {
+		entity.mu.Lock()
+		defer entity.mu.Unlock()
+		if len(entity.messages) != 1 || entity.errors[0] != nil {
+			err = fmt.Errorf("not notified: %v %v", entity.errors, entity.messages)
+			return
+		}
+		var env map[string]string
+		if err = entity.messages[0].Payload().Unmarshal(&env); err != nil {
+			return
+		}
+		if expect := map[string]string{"meta.rack": "left"}; !reflect.DeepEqual(expect, env) {
+			err = fmt.Errorf("not equal (expected)%v != (actual)%v", expect, env)
+		}
+		return
+	})
+}
+
+func TestArbiter_ConstraintOnly_Counter(t *testing.T) {
+	// provision arbiter configuration
+	arbiter := scheduler.NewArbiter(context.Background(), logx.GetLog("test"), "provision",
+		scheduler.ArbiterConfig{
+			ConstraintOnly: []*regexp.Regexp{
+				regexp.MustCompile(`^provision\..+`),
+				regexp.MustCompile(`^counter\..+`),
+				regexp.MustCompile(`^unit\..+`),
+			},
+		},
+	)
+	assert.NoError(t, arbiter.Open())
+	defer arbiter.Close()
+
+	pod := &manifest.Pod{
+		Namespace: manifest.PublicNamespace,
+		Name:      "uncounted",
+		Runtime:   true,
+		Target:    "multi-user.target",
+	}
+	entity := &dummyArbiterEntity{}
+	arbiter.Bind(pod.Name, pod.Constraint, entity.notify)
+	for i, slots := range []string{"1", "2"} {
+		arbiter.ConsumeMessage(bus.NewMessage("", map[string]string{
+			"meta.rack":                 "left",
+			"counter.counted.slots":     slots,
+			"counter.counted.allocated": "true",
+		}))
+		fixture.WaitNoErrorT10(t, func() (err error) {
+			entity.mu.Lock()
+			defer entity.mu.Unlock()
+			if len(entity.messages) != i+1 {
+				err = fmt.Errorf("not notified: %v", entity.messages)
+			}
+			return
+		})
+	}
+
+	var marks []uint64
+	entity.mu.Lock()
+	defer entity.mu.Unlock()
+	for _, message := range entity.messages {
+		var env map[string]string
+		assert.NoError(t, message.Payload().Unmarshal(&env))
+		var alloc allocation.Pod
+		assert.NoError(t, alloc.FromManifest(pod, env))
+		marks = append(marks, alloc.AgentMark)
+	}
+	assert.Equal(t, marks[0], marks[1])
+}
+
+func TestArbiter_Explain(t *testing.T) {
+	arbiter := scheduler.NewArbiter(context.Background(), logx.GetLog("test"), "test",
+		scheduler.ArbiterConfig{
+			Required: manifest.Constraint{"${drain}": "!= true"},
+		},
+	)
+	assert.NoError(t, arbiter.Open())
+	defer arbiter.Close()
+
+	entity := &dummyArbiterEntity{}
+	arbiter.ConsumeMessage(bus.NewMessage("", map[string]string{
+		"1": "true",
+	}))
+	arbiter.Bind("1", manifest.Constraint{"${1}": "true"}, entity.notify)
+
+	t.Run("bound", func(t *testing.T) {
+		constraint, state, ok := arbiter.Explain("1")
+		assert.True(t, ok)
+		assert.Equal(t, manifest.Constraint{"${1}": "true", "${drain}": "!= true"}, constraint)
+		assert.Equal(t, map[string]string{"1": "true"}, state)
+	})
+	t.Run("not bound", func(t *testing.T) {
+		_, _, ok := arbiter.Explain("2")
+		assert.False(t, ok)
+	})
+}
+
+func TestArbiter_State(t *testing.T) {
+	arbiter := scheduler.NewArbiter(context.Background(), logx.GetLog("test"), "test",
+		scheduler.ArbiterConfig{})
+	assert.NoError(t, arbiter.Open())
+	defer arbiter.Close()
+
+	arbiter.ConsumeMessage(bus.NewMessage("", map[string]string{
+		"meta.rack": "left",
+		"drain":     "false",
+	}))
+	assert.Equal(t, map[string]string{
+		"meta.rack": "left",
+		"drain":     "false",
+	}, arbiter.State())
+}
@@ -9,24 +9,36 @@ import (
 	"github.com/akaspin/soil/agent/bus"
 	"github.com/akaspin/soil/agent/bus/pipe"
 	"github.com/akaspin/soil/agent/cluster"
+	"github.com/akaspin/soil/agent/counter"
+	"github.com/akaspin/soil/agent/host"
+	"github.com/akaspin/soil/agent/meta"
+	"github.com/akaspin/soil/agent/metrics"
 	"github.com/akaspin/soil/agent/provider"
 	"github.com/akaspin/soil/agent/provision"
 	"github.com/akaspin/soil/agent/resource"
 	"github.com/akaspin/soil/agent/scheduler"
+	"github.com/akaspin/soil/agent/unit"
 	"github.com/akaspin/soil/lib"
 	"github.com/akaspin/soil/manifest"
 	"github.com/akaspin/soil/proto"
 	"github.com/akaspin/supervisor"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"sync"
 )
 
+const runtimeMetaFile = "meta.json"
+
 var ServerVersion string
 
 type ServerOptions struct {
-	AgentId    string
-	ConfigPath []string
-	Address    string
-	Meta       map[string]string
+	AgentId     string
+	ConfigPath  []string
+	Address     string
+	Meta        map[string]string
+	SystemPaths *allocation.SystemPaths // Optional SystemD paths
+	SystemdConn lib.SystemdConnFactory  // Optional SystemD connection factory
 }
 
 // Agent instance
@@ -40,11 +52,19 @@ type Server struct {
 	confPipe  bus.Consumer
 	sink      *scheduler.Sink
 	kv        *cluster.KV
+	counter   *counter.Evaluator
+	host      *host.Collector
+	meta      *meta.Merger
 	api       *api_server.Router
 	endpoints struct {
 		registryGet    *api_server.Endpoint
 		statusNodesGet *api_server.Endpoint
+		eventsGet      *api_server.Endpoint
 	}
+
+	mu    sync.Mutex
+	node  proto.NodeInfo // announced node info
+	drain bool
 }
 
 func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Server) {
@@ -53,13 +73,23 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 		log:     log.GetLog("server"),
 		options: options,
 	}
-	s.kv = cluster.NewKV(ctx, log, cluster.DefaultBackendFactory)
+	reporter := metrics.NewPrometheus("soil")
+	s.kv = cluster.NewKV(ctx, log, cluster.DefaultBackendFactory, reporter)
+	s.endpoints.eventsGet = api.NewEventsGet(log)
+	events := s.endpoints.eventsGet.Processor().(*api.EventsProcessor)
 
 	// Recovery
 
 	systemPaths := allocation.DefaultSystemPaths()
+	if options.SystemPaths != nil {
+		systemPaths = *options.SystemPaths
+	}
+	systemdConn := options.SystemdConn
+	if systemdConn == nil {
+		systemdConn = lib.NewDbusSystemdConn
+	}
 	var state allocation.PodSlice
-	if recoveryErr := state.FromFilesystem(systemPaths, allocation.DefaultDbusDiscoveryFunc); recoveryErr != nil {
+	if recoveryErr := state.FromFilesystem(systemPaths, allocation.GetDiscoveryFunc(systemdConn)); recoveryErr != nil {
 		s.log.Errorf("recovered with failure: %v", recoveryErr)
 	}
 
@@ -70,40 +100,61 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 			Required: manifest.Constraint{"${agent.drain}": "!= true"},
 			ConstraintOnly: []*regexp.Regexp{
 				regexp.MustCompile(`^provision\..+`),
+				regexp.MustCompile(`^counter\..+`),
+				regexp.MustCompile(`^unit\..+`),
 			},
+			Reporter: reporter,
 		})
 	provisionDrainPipe := pipe.NewDivert(provisionArbiter, bus.NewMessage("private", map[string]string{"agent.drain": "true"}))
 	provisionStrictPipe := pipe.NewStrict(
 		"private", log, provisionDrainPipe,
 		"meta",
 		"system",
+		"host",
+		"counter",   // downstream from counter evaluator
 		"resource",  // downstream from provision evaluator
 		"provision", // upstream from provision executor
+		"unit",      // upstream from unit watcher
 	)
 	provisionStateConsumer := pipe.NewLift("provision", pipe.NewTee(
 		provisionStrictPipe,
+		events.Consumer("provision"),
 	))
+	unitWatcher := unit.NewWatcher(ctx, log, unit.WatcherConfig{
+		Downstream:  pipe.NewTee(provisionStrictPipe),
+		SystemdConn: systemdConn,
+	}, state)
 	provisionEvaluator := provision.NewEvaluator(ctx, s.log, provision.EvaluatorConfig{
 		SystemPaths:    systemPaths,
 		Recovery:       state,
 		StatusConsumer: provisionStateConsumer,
+		UnitsConsumer:  unitWatcher,
+		SystemdConn:    systemdConn,
+		Reporter:       reporter,
 	})
 
 	// Resource
 
 	resourceArbiter := scheduler.NewArbiter(ctx, log, "resource", scheduler.ArbiterConfig{
 		Required: manifest.Constraint{"${agent.drain}": "!= true"},
+		ConstraintOnly: []*regexp.Regexp{
+			regexp.MustCompile(`^counter\..+`),
+		},
+		Reporter: reporter,
 	})
 	resourceDrainPipe := pipe.NewDivert(resourceArbiter, bus.NewMessage("private", map[string]string{"agent.drain": "true"}))
 	resourceStrictPipe := pipe.NewStrict(
 		"private", log, resourceDrainPipe,
 		"meta",
 		"system",
+		"host",
+		"counter",  // downstream from counter evaluator
 		"provider", // resource evaluator upstream
 	)
 	resourceEvaluator := resource.NewEvaluator(ctx, log,
 		resourceStrictPipe,
-		provisionStrictPipe,
+		pipe.NewTee(provisionStrictPipe, events.Consumer("resource")),
+		reporter,
 		state)
 
 	// Provider evaluator
@@ -113,41 +164,99 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 		ConstraintOnly: []*regexp.Regexp{
 			regexp.MustCompile(`^provider\..+`),
 			regexp.MustCompile(`^provision\..+`),
+			regexp.MustCompile(`^counter\..+`),
 		},
+		Reporter: reporter,
 	})
 	providerDrainPipe := pipe.NewDivert(providerArbiter, bus.NewMessage("private", map[string]string{"agent.drain": "true"}))
 	providerStrictPipe := pipe.NewStrict(
 		"private", log, providerDrainPipe,
 		"meta",
 		"system",
+		"host",
+		"counter", // downstream from counter evaluator
 	)
 	providerEvaluator := provider.NewEvaluator(ctx, log, resourceEvaluator, state)
 
-	// Meta and system
+	// Counter
+
+	counterArbiter := scheduler.NewArbiter(ctx, log, "counter", scheduler.ArbiterConfig{
+		Required: manifest.Constraint{"${agent.drain}": "!= true"},
+		Reporter: reporter,
+	})
+	counterDrainPipe := pipe.NewDivert(counterArbiter, bus.NewMessage("private", map[string]string{"agent.drain": "true"}))
+	counterStrictPipe := pipe.NewStrict(
+		"private", log, counterDrainPipe,
+		"meta",
+		"system",
+		"host",
+	)
+	s.counter = counter.NewEvaluator(ctx, log, counter.EvaluatorConfig{
+		Store: s.kv.VolatileStore("counter"),
+		Downstream: pipe.NewTee(
+			providerStrictPipe,
+			resourceStrictPipe,
+			provisionStrictPipe,
+		),
+	}, state)
+
+	// Meta, system and host
 
 	s.confPipe = pipe.NewTee(
+		counterStrictPipe,
 		providerStrictPipe,
 		resourceStrictPipe,
 		provisionStrictPipe,
 	)
 
+	s.meta = meta.NewMerger(ctx, log, s.confPipe, filepath.Join(systemPaths.State, runtimeMetaFile))
+	s.host = host.NewCollector(ctx, log, host.CollectorConfig{
+		Downstream: s.confPipe,
+	})
+
 	drainFn := func(on bool) {
+		s.mu.Lock()
+		s.drain = on
+		s.mu.Unlock()
+		counterDrainPipe.Divert(on)
 		providerDrainPipe.Divert(on)
 		resourceDrainPipe.Divert(on)
 		provisionDrainPipe.Divert(on)
 	}
 
+	plan := &planner{
+		stages: []planStage{
+			{"counter", counterArbiter, s.counter, (*manifest.Pod).IsCounted},
+			{"provider", providerArbiter, providerEvaluator, func(pod *manifest.Pod) bool {
+				return len(pod.Providers) > 0
+			}},
+			{"resource", resourceArbiter, resourceEvaluator, func(pod *manifest.Pod) bool {
+				return len(pod.Resources) > 0
+			}},
+			{"provision", provisionArbiter, provisionEvaluator, nil},
+		},
+		provision: provisionEvaluator,
+	}
+
 	s.endpoints.statusNodesGet = api.NewClusterNodesGet(log)
 	s.endpoints.registryGet = api.NewRegistryPodsGet()
 
-	s.api = api_server.NewRouter(s.log,
+	s.api = api_server.NewRouter(s.log, reporter,
 		// status
 		api.NewStatusPingGet(),
+		api.NewStatusNodeGet(s.nodeStatus),
+		api.NewStatusPodsExplainGet(plan.Explain),
+		api.NewStatusEnvGet(plan.Env),
+		api.NewMetricsGet(reporter),
+		s.endpoints.eventsGet,
 
 		// agent
 		api.NewAgentReloadPut(s.Configure),
 		api.NewAgentDrainPut(drainFn),
 		api.NewAgentDrainDelete(drainFn),
+		api.NewAgentMetaPut(s.meta.SetRuntime),
+		api.NewAgentMetaDelete(s.meta.DeleteRuntime),
+		api.NewPlanPost(plan.Plan),
 
 		// cluster
 		s.endpoints.statusNodesGet,
@@ -159,6 +268,7 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	)
 
 	s.sink = scheduler.NewSink(ctx, s.log, state,
+		scheduler.NewBoundedEvaluator(counterArbiter, s.counter),
 		scheduler.NewBoundedEvaluator(providerArbiter, providerEvaluator),
 		scheduler.NewBoundedEvaluator(resourceArbiter, resourceEvaluator),
 		scheduler.NewBoundedEvaluator(provisionArbiter, provisionEvaluator),
@@ -167,10 +277,15 @@ func NewServer(ctx context.Context, log *logx.Log, options ServerOptions) (s *Se
 	s.sv = supervisor.NewChain(ctx,
 		s.kv,
 		supervisor.NewGroup(ctx,
+			counterArbiter,
 			providerArbiter,
 			resourceArbiter,
 			provisionArbiter),
 		supervisor.NewGroup(ctx,
+			s.meta,
+			s.host,
+			unitWatcher,
+			s.counter,
 			providerEvaluator,
 			resourceEvaluator,
 			provisionEvaluator),
@@ -188,11 +303,15 @@ func (s *Server) Open() (err error) {
 	s.kv.Producer("nodes").Subscribe(s.ctx, pipe.NewSlice(s.log, pipe.NewTee(
 		s.api,
 		s.endpoints.statusNodesGet.Processor().(bus.Consumer),
+		s.endpoints.eventsGet.Processor().(*api.EventsProcessor).Consumer("nodes"),
 	)))
 	s.kv.Producer("registry").Subscribe(s.ctx, pipe.NewSlice(s.log, pipe.NewTee(
 		s.sink,
 		s.endpoints.registryGet.Processor().(bus.Consumer),
+		s.endpoints.eventsGet.Processor().(*api.EventsProcessor).Consumer("registry"),
 	)))
+	s.kv.Producer("counter").Subscribe(s.ctx, s.counter)
+	s.kv.Producer("meta").Subscribe(s.ctx, s.meta)
 
 	s.Configure()
 	return
@@ -230,18 +349,45 @@ func (s *Server) Configure() {
 	}
 
 	s.kv.Configure(clusterConfig)
+	s.counter.Configure(clusterConfig)
 
 	// announce node
-	s.kv.VolatileStore("nodes").ConsumeMessage(bus.NewMessage("", proto.NodeInfo{
+	node := proto.NodeInfo{
 		ID:        clusterConfig.NodeID,
 		Advertise: clusterConfig.Advertise,
 		Version:   proto.Version,
 		API:       proto.APIV1Version,
-	}))
-
-	s.confPipe.ConsumeMessage(bus.NewMessage("meta", serverCfg.Meta))
+	}
+	s.mu.Lock()
+	s.node = node
+	s.mu.Unlock()
+	s.kv.VolatileStore("nodes").ConsumeMessage(bus.NewMessage("", node))
+
+	var kvNode string
+	if clusterConfig.MetaFromKV {
+		kvNode = clusterConfig.NodeID
+	}
+	s.meta.Configure(serverCfg.Meta, serverCfg.MetaSources, kvNode)
 	s.confPipe.ConsumeMessage(bus.NewMessage("system", serverCfg.System))
+	s.host.Refresh()
 
 	s.sink.ConsumeRegistry(registry)
 	s.log.Debug("configure: done")
 }
+
+// nodeStatus returns agent info and current meta
+func (s *Server) nodeStatus() (res proto.NodeStatus, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = proto.NodeStatus{
+		Agent: map[string]string{
+			"id":        s.node.ID,
+			"advertise": s.node.Advertise,
+			"version":   s.node.Version,
+			"api":       s.node.API,
+			"drain":     strconv.FormatBool(s.drain),
+		},
+		Meta: s.meta.Meta(),
+	}
+	return
+}
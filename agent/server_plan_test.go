@@ -0,0 +1,138 @@
+// +build ide test_unit
+
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/client"
+	"github.com/akaspin/soil/fixture"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer_Plan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	paths := allocation.SystemPaths{
+		Local:   filepath.Join(dir, "etc"),
+		Runtime: filepath.Join(dir, "run"),
+		State:   filepath.Join(dir, "state"),
+	}
+	for _, path := range []string{paths.Local, paths.Runtime, paths.State} {
+		require.NoError(t, os.MkdirAll(path, 0755))
+	}
+
+	systemd := fixture.NewFakeSystemd(paths.Local, paths.Runtime)
+	port := fixture.RandomPort(t)
+	server := agent.NewServer(context.Background(), logx.GetLog("test"), agent.ServerOptions{
+		AgentId:     "node-1",
+		ConfigPath:  []string{"testdata/server_plan_test.hcl"},
+		Address:     fmt.Sprintf("127.0.0.1:%d", port),
+		SystemPaths: &paths,
+		SystemdConn: systemd.Conn,
+	})
+	require.NoError(t, server.Open())
+	defer server.Wait()
+	defer server.Close()
+	server.Configure()
+
+	var buffers lib.StaticBuffers
+	var pods manifest.PodSlice
+	require.NoError(t, buffers.ReadFiles("testdata/server_plan_test_pods.hcl"))
+	require.NoError(t, pods.Unmarshal(manifest.PublicNamespace, buffers.GetReaders()...))
+
+	cli := client.NewClient(client.Config{
+		URL: fmt.Sprintf("http://127.0.0.1:%d", port),
+	})
+	var plans []proto.PodPlan
+	fixture.WaitNoErrorT10(t, func() (err error) {
+		if plans, err = cli.Plan(context.Background(), pods); err != nil {
+			return
+		}
+		for _, plan := range plans {
+			for _, failure := range plan.Failures {
+				if strings.Contains(failure, "state is empty") {
+					err = fmt.Errorf("%s: %s", plan.Name, failure)
+					return
+				}
+			}
+		}
+		return
+	})
+	require.Len(t, plans, 4)
+	byName := map[string]proto.PodPlan{}
+	for _, plan := range plans {
+		byName[plan.Name] = plan
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		plan := byName["plain"]
+		assert.True(t, plan.Allocated)
+		assert.Empty(t, plan.Failures)
+		assert.Empty(t, plan.Pending)
+		assert.NotEmpty(t, plan.Instructions)
+	})
+	t.Run("failed", func(t *testing.T) {
+		plan := byName["failed"]
+		assert.False(t, plan.Allocated)
+		require.Len(t, plan.Failures, 1)
+		assert.True(t, strings.HasPrefix(plan.Failures[0], "provision: "), plan.Failures[0])
+	})
+	t.Run("with resource", func(t *testing.T) {
+		plan := byName["with-resource"]
+		assert.True(t, plan.Allocated)
+		assert.Empty(t, plan.Failures)
+		assert.Equal(t, []string{
+			`resource: "${provider.with-resource.port.allocated}":"true"`,
+			`provision: "${resource.with-resource.ok.allocated}":"true"`,
+		}, plan.Pending)
+	})
+	t.Run("counted", func(t *testing.T) {
+		plan := byName["counted"]
+		assert.True(t, plan.Allocated)
+		assert.Empty(t, plan.Failures)
+		assert.Equal(t, []string{
+			`provision: "${counter.counted.allocated}":"true"`,
+		}, plan.Pending)
+	})
+	t.Run("dry run", func(t *testing.T) {
+		assert.Empty(t, systemd.States())
+	})
+	t.Run("explain", func(t *testing.T) {
+		var provision proto.ConstraintExplain
+		fixture.WaitNoErrorT10(t, func() (err error) {
+			res, err := cli.ExplainPod(context.Background(), "explained")
+			if err != nil {
+				return
+			}
+			for _, explain := range res {
+				if explain.Arbiter == "provision" {
+					provision = explain
+					return
+				}
+			}
+			err = fmt.Errorf("provision is not explained: %v", res)
+			return
+		})
+		assert.False(t, provision.Passed)
+		assert.Contains(t, provision.Pairs, proto.ConstraintPair{
+			Left: "${meta.rack}", Right: "right", InterpolatedLeft: "left", InterpolatedRight: "right",
+		})
+		assert.Contains(t, provision.Pairs, proto.ConstraintPair{
+			Left: "${meta.zone|left}", Right: "left", InterpolatedLeft: "left", InterpolatedRight: "left", Passed: true,
+		})
+	})
+}
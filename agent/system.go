@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"fmt"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/lib"
+	"os"
+)
+
+const (
+	SystemModeSystem = "system" // manage SystemD system instance
+	SystemModeUser   = "user"   // manage SystemD user instance
+)
+
+// GetSystemMode returns SystemD paths and connection factory for given
+// "system.mode". Empty mode is treated as "system". In "user" mode
+// GetSystemMode also creates unit directories if they are not exist.
+func GetSystemMode(mode string) (paths allocation.SystemPaths, factory lib.SystemdConnFactory, err error) {
+	switch mode {
+	case "", SystemModeSystem:
+		paths = allocation.DefaultSystemPaths()
+		factory = lib.NewDbusSystemdConn
+	case SystemModeUser:
+		if paths, err = allocation.UserSystemPaths(); err != nil {
+			return
+		}
+		for _, dir := range []string{paths.Local, paths.Runtime} {
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				return
+			}
+		}
+		factory = lib.NewDbusUserSystemdConn
+	default:
+		err = fmt.Errorf(`unknown system mode "%s"`, mode)
+	}
+	return
+}
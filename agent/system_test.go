@@ -0,0 +1,88 @@
+// +build ide test_unit
+
+package agent_test
+
+import (
+	"github.com/akaspin/soil/agent"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetSystemMode(t *testing.T) {
+	t.Run("system", func(t *testing.T) {
+		for _, mode := range []string{"", "system"} {
+			paths, factory, err := agent.GetSystemMode(mode)
+			assert.NoError(t, err)
+			assert.NotNil(t, factory)
+			assert.Equal(t, allocation.DefaultSystemPaths(), paths)
+		}
+	})
+	t.Run("user", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		defer setEnv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))()
+		defer setEnv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))()
+		defer setEnv("XDG_STATE_HOME", filepath.Join(dir, "state"))()
+		paths, factory, err := agent.GetSystemMode("user")
+		require.NoError(t, err)
+		assert.NotNil(t, factory)
+		assert.Equal(t, allocation.SystemPaths{
+			Local:   filepath.Join(dir, "config", "systemd", "user"),
+			Runtime: filepath.Join(dir, "run", "systemd", "user"),
+			State:   filepath.Join(dir, "state", "soil"),
+		}, paths)
+		for _, p := range []string{paths.Local, paths.Runtime} {
+			info, err := os.Stat(p)
+			assert.NoError(t, err)
+			assert.True(t, info.IsDir())
+		}
+	})
+	t.Run("user dirs in home", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		defer setEnv("HOME", dir)()
+		defer setEnv("XDG_CONFIG_HOME", "")()
+		defer setEnv("XDG_STATE_HOME", "")()
+		defer setEnv("XDG_DATA_HOME", "")()
+		defer setEnv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))()
+		paths, _, err := agent.GetSystemMode("user")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, ".config", "systemd", "user"), paths.Local)
+		assert.Equal(t, filepath.Join(dir, ".local", "share", "soil"), paths.State)
+	})
+	t.Run("user without runtime dir", func(t *testing.T) {
+		defer setEnv("XDG_RUNTIME_DIR", "")()
+		_, _, err := agent.GetSystemMode("user")
+		assert.Error(t, err)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		_, _, err := agent.GetSystemMode("session")
+		assert.Error(t, err)
+	})
+}
+
+// setEnv sets environment variable and returns function which restores
+// previous value. Empty value unsets variable.
+func setEnv(key, value string) (restore func()) {
+	old, ok := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	restore = func() {
+		if ok {
+			os.Setenv(key, old)
+			return
+		}
+		os.Unsetenv(key)
+	}
+	return
+}
@@ -0,0 +1,18 @@
+meta {
+  "rack" = "left"
+}
+
+meta_source "env" {
+  prefix = "SOIL_META_"
+}
+
+meta_source "file" {
+  path = "/etc/soil/meta.json"
+  interval = "5s"
+}
+
+meta_source "exec" {
+  command = "/usr/local/bin/facts --json"
+  interval = "1m"
+  timeout = "10s"
+}
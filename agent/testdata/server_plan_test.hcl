@@ -0,0 +1,11 @@
+meta {
+  "rack" = "left"
+}
+
+// not allocated, both pairs are interpolated to "left"
+pod "explained" {
+  constraint {
+    "${meta.rack}" = "right"
+    "${meta.zone|left}" = "left"
+  }
+}
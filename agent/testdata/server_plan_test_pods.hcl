@@ -0,0 +1,29 @@
+pod "plain" {
+  constraint {
+    "${meta.rack}" = "left"
+  }
+  unit "plain-1.service" {
+    source = <<EOF
+[Service]
+ExecStart=/usr/bin/sleep inf
+EOF
+  }
+}
+
+pod "failed" {
+  constraint {
+    "${meta.rack}" = "right"
+  }
+}
+
+pod "with-resource" {
+  provider "range" "port" {
+    min = 3000
+    max = 4000
+  }
+  resource "with-resource.port" "ok" {}
+}
+
+pod "counted" {
+  count = 1
+}
@@ -0,0 +1,202 @@
+package unit
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/bus/pipe"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/supervisor"
+	"github.com/coreos/go-systemd/dbus"
+	"time"
+)
+
+const pollInterval = time.Second
+
+type WatcherConfig struct {
+	Downstream  bus.Consumer           // Consumer for "unit.<pod>.<unit>.*"
+	SystemdConn lib.SystemdConnFactory // Optional SystemD connection factory
+}
+
+type podUnits struct {
+	name  string
+	units []string
+}
+
+// Watcher polls SystemD unit states every second and notifies downstream
+// on change with
+//
+//	unit.<pod>.<unit>.active_state = "<ActiveState>"
+//	unit.<pod>.<unit>.sub_state = "<SubState>"
+//
+// Units which are not loaded are reported as "inactive" and "dead".
+type Watcher struct {
+	*supervisor.Control
+	log        *logx.Log
+	config     WatcherConfig
+	downstream bus.Consumer
+
+	pods     map[string][]string        // units by pod
+	statuses map[string]dbus.UnitStatus // last known unit statuses
+
+	podChan chan podUnits
+}
+
+func NewWatcher(ctx context.Context, log *logx.Log, config WatcherConfig, state allocation.PodSlice) (w *Watcher) {
+	w = &Watcher{
+		Control:    supervisor.NewControl(ctx),
+		log:        log.GetLog("unit", "watcher"),
+		config:     config,
+		downstream: pipe.NewLift("unit", config.Downstream),
+		pods:       map[string][]string{},
+		statuses:   map[string]dbus.UnitStatus{},
+		podChan:    make(chan podUnits),
+	}
+	if w.config.SystemdConn == nil {
+		w.config.SystemdConn = lib.NewDbusSystemdConn
+	}
+	for _, pod := range state {
+		w.pods[pod.Name] = unitNames(pod)
+	}
+	return
+}
+
+func (w *Watcher) Open() (err error) {
+	go w.loop()
+	if err = w.downstream.ConsumeMessage(bus.NewMessage("", map[string]map[string]string{})); err != nil {
+		w.log.Error(err)
+	}
+	err = w.Control.Open()
+	return
+}
+
+// ConsumeMessage accepts "<pod>":["<unit>",...] messages. Message with
+// empty payload removes pod from watch.
+func (w *Watcher) ConsumeMessage(message bus.Message) (err error) {
+	req := podUnits{
+		name: message.Topic(),
+	}
+	if !message.Payload().IsEmpty() {
+		if err = message.Payload().Unmarshal(&req.units); err != nil {
+			w.log.Error(err)
+			return
+		}
+		if req.units == nil {
+			req.units = []string{}
+		}
+	}
+	select {
+	case <-w.Control.Ctx().Done():
+		w.log.Warningf(`skip watch "%s": %v`, req.name, w.Control.Ctx().Err())
+	case w.podChan <- req:
+		w.log.Tracef(`watch sent: "%s":%v`, req.name, req.units)
+	}
+	return
+}
+
+func (w *Watcher) loop() {
+	log := w.log.WithTags("watcher", "loop")
+	log.Trace("open")
+
+	var conn lib.SystemdConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	conn = w.poll(conn)
+
+LOOP:
+	for {
+		select {
+		case <-w.Control.Ctx().Done():
+			break LOOP
+		case req := <-w.podChan:
+			if req.units == nil {
+				delete(w.pods, req.name)
+			} else {
+				w.pods[req.name] = req.units
+			}
+			w.notify(req.name)
+		case <-ticker.C:
+			conn = w.poll(conn)
+		}
+	}
+	log.Trace("close")
+}
+
+// poll lists units and notifies pods with changed units. Returns connection
+// for next poll or <nil> if connection should be reopened.
+func (w *Watcher) poll(conn lib.SystemdConn) lib.SystemdConn {
+	var err error
+	if conn == nil {
+		if conn, err = w.config.SystemdConn(); err != nil {
+			w.log.Errorf("unable to connect to systemd: %v", err)
+			return nil
+		}
+	}
+	statuses, err := conn.ListUnits()
+	if err != nil {
+		w.log.Errorf("unable to list units: %v", err)
+		conn.Close()
+		return nil
+	}
+	current := map[string]dbus.UnitStatus{}
+	for _, status := range statuses {
+		current[status.Name] = status
+	}
+	changed := map[string]struct{}{}
+	for name, status := range current {
+		if last, ok := w.statuses[name]; !ok || isStateChanged(last, status) {
+			changed[name] = struct{}{}
+		}
+	}
+	for name := range w.statuses {
+		if _, ok := current[name]; !ok {
+			changed[name] = struct{}{}
+		}
+	}
+	w.statuses = current
+	for pod, units := range w.pods {
+		for _, unit := range units {
+			if _, ok := changed[unit]; ok {
+				w.notify(pod)
+				break
+			}
+		}
+	}
+	return conn
+}
+
+func (w *Watcher) notify(pod string) {
+	units, ok := w.pods[pod]
+	if !ok {
+		w.downstream.ConsumeMessage(bus.NewMessage(pod, nil))
+		return
+	}
+	data := map[string]string{}
+	for _, unit := range units {
+		activeState, subState := "inactive", "dead"
+		if status, ok := w.statuses[unit]; ok {
+			activeState, subState = status.ActiveState, status.SubState
+		}
+		data[unit+".active_state"] = activeState
+		data[unit+".sub_state"] = subState
+	}
+	w.downstream.ConsumeMessage(bus.NewMessage(pod, data))
+}
+
+func isStateChanged(u1, u2 dbus.UnitStatus) bool {
+	return u1.ActiveState != u2.ActiveState || u1.SubState != u2.SubState
+}
+
+func unitNames(pod *allocation.Pod) (res []string) {
+	res = []string{}
+	for _, u := range pod.Units {
+		res = append(res, u.UnitName())
+	}
+	return
+}
@@ -0,0 +1,66 @@
+// +build ide test_unit
+
+package unit_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/unit"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatcher_FakeSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-unit-watcher")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	systemd := fixture.NewFakeSystemd(dir)
+	cons := bus.NewTestingConsumer(ctx)
+	watcher := unit.NewWatcher(ctx, logx.GetLog("test"), unit.WatcherConfig{
+		Downstream:  cons,
+		SystemdConn: systemd.Conn,
+	}, nil)
+	assert.NoError(t, watcher.Open())
+
+	t.Run(`0 watch inactive`, func(t *testing.T) {
+		watcher.ConsumeMessage(bus.NewMessage("pod-1", []string{"unit-1.service"}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{
+			"pod-1.unit-1.service.active_state": "inactive",
+			"pod-1.unit-1.service.sub_state":    "dead",
+		})))
+	})
+	t.Run(`1 start unit`, func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "unit-1.service"), []byte("[Service]\n"), 0644))
+		conn, _ := systemd.Conn()
+		_, err := conn.StartUnit("unit-1.service", "replace", nil)
+		assert.NoError(t, err)
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{
+			"pod-1.unit-1.service.active_state": "active",
+			"pod-1.unit-1.service.sub_state":    "running",
+		})))
+	})
+	t.Run(`2 crash unit`, func(t *testing.T) {
+		systemd.SetState("unit-1.service", "failed", "failed")
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{
+			"pod-1.unit-1.service.active_state": "failed",
+			"pod-1.unit-1.service.sub_state":    "failed",
+		})))
+	})
+	t.Run(`3 unwatch`, func(t *testing.T) {
+		watcher.ConsumeMessage(bus.NewMessage("pod-1", nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{})))
+	})
+
+	watcher.Close()
+	watcher.Wait()
+}
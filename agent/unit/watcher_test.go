@@ -0,0 +1,52 @@
+// +build ide test_systemd
+
+package unit_test
+
+import (
+	"context"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/unit"
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWatcher(t *testing.T) {
+	fixture.DestroyUnits("test-unit-*")
+	defer fixture.DestroyUnits("test-unit-*")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cons := bus.NewTestingConsumer(ctx)
+	watcher := unit.NewWatcher(ctx, logx.GetLog("test"), unit.WatcherConfig{
+		Downstream: cons,
+	}, nil)
+	assert.NoError(t, watcher.Open())
+
+	t.Run(`0 watch inactive`, func(t *testing.T) {
+		watcher.ConsumeMessage(bus.NewMessage("pod-1", []string{"test-unit-1.service"}))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{
+			"pod-1.test-unit-1.service.active_state": "inactive",
+			"pod-1.test-unit-1.service.sub_state":    "dead",
+		})))
+	})
+	t.Run(`1 start unit`, func(t *testing.T) {
+		assert.NoError(t, fixture.CreateUnit("/run/systemd/system/test-unit-1.service", `
+[Service]
+ExecStart=/usr/bin/sleep inf
+`, nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{
+			"pod-1.test-unit-1.service.active_state": "active",
+			"pod-1.test-unit-1.service.sub_state":    "running",
+		})))
+	})
+	t.Run(`2 unwatch`, func(t *testing.T) {
+		watcher.ConsumeMessage(bus.NewMessage("pod-1", nil))
+		fixture.WaitNoErrorT10(t, cons.ExpectLastMessageFn(bus.NewMessage("unit", map[string]string{})))
+	})
+
+	watcher.Close()
+	watcher.Wait()
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+)
+
+// Reload rereads agent configuration
+func (c *Client) Reload(ctx context.Context) (err error) {
+	err = c.doJSON(ctx, http.MethodPut, proto.V1AgentReload, nil, nil)
+	return
+}
+
+// Drain removes all pods from agent
+func (c *Client) Drain(ctx context.Context) (err error) {
+	err = c.doJSON(ctx, http.MethodPut, proto.V1AgentDrain, nil, nil)
+	return
+}
+
+// Undrain returns agent to normal operation
+func (c *Client) Undrain(ctx context.Context) (err error) {
+	err = c.doJSON(ctx, http.MethodDelete, proto.V1AgentDrain, nil, nil)
+	return
+}
+
+// MetaPut sets runtime agent meta
+func (c *Client) MetaPut(ctx context.Context, values map[string]string) (err error) {
+	err = c.doJSON(ctx, http.MethodPut, proto.V1AgentMeta, values, nil)
+	return
+}
+
+// MetaDelete removes runtime agent meta keys
+func (c *Client) MetaDelete(ctx context.Context, keys ...string) (err error) {
+	err = c.doJSON(ctx, http.MethodDelete, proto.V1AgentMeta, keys, nil)
+	return
+}
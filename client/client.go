@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultURL = "http://127.0.0.1:7654"
+
+type Config struct {
+	URL        string       // Agent API URL
+	Node       string       // Optional node ID to proxy or redirect requests
+	Redirect   bool         // Allow redirects to node instead proxying
+	HTTPClient *http.Client // Optional HTTP client
+}
+
+// Client works with Soil Agent API
+type Client struct {
+	config Config
+}
+
+func NewClient(config Config) (c *Client) {
+	c = &Client{
+		config: config,
+	}
+	if c.config.URL == "" {
+		c.config.URL = DefaultURL
+	}
+	if c.config.HTTPClient == nil {
+		c.config.HTTPClient = http.DefaultClient
+	}
+	return
+}
+
+// WithNode returns client which sends all requests to given node. Empty node
+// means agent addressed by URL.
+func (c *Client) WithNode(node string) (res *Client) {
+	config := c.config
+	config.Node = node
+	res = NewClient(config)
+	return
+}
+
+// Error is returned on non-2xx API responses
+type Error struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Reason)
+}
+
+// URL returns full URL for given API path with node and redirect query
+// parameters
+func (c *Client) URL(path string, query url.Values) (res string) {
+	values := url.Values{}
+	for k, v := range query {
+		values[k] = v
+	}
+	if c.config.Node != "" {
+		values.Set("node", c.config.Node)
+	}
+	if c.config.Redirect {
+		values.Set("redirect", "")
+	}
+	res = strings.TrimSuffix(c.config.URL, "/") + path
+	if len(values) > 0 {
+		res += "?" + values.Encode()
+	}
+	return
+}
+
+// do sends request and returns response body on success. Caller should close
+// returned body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in interface{}) (body io.ReadCloser, err error) {
+	var reqBody io.Reader
+	if in != nil {
+		var buf bytes.Buffer
+		if err = json.NewEncoder(&buf).Encode(in); err != nil {
+			return
+		}
+		reqBody = &buf
+	}
+	req, err := http.NewRequest(method, c.URL(path, query), reqBody)
+	if err != nil {
+		return
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.config.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = &Error{
+			StatusCode: resp.StatusCode,
+			Reason:     strings.TrimSpace(string(msg)),
+		}
+		return
+	}
+	body = resp.Body
+	return
+}
+
+// doJSON sends JSON request and decodes JSON response to out if out is not nil
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out interface{}) (err error) {
+	body, err := c.do(ctx, method, path, nil, in)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	if out != nil {
+		err = json.NewDecoder(body).Decode(out)
+	}
+	return
+}
@@ -0,0 +1,150 @@
+// +build ide test_unit
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/logx"
+	"github.com/akaspin/soil/agent/api"
+	"github.com/akaspin/soil/agent/api/api-server"
+	"github.com/akaspin/soil/agent/bus"
+	"github.com/akaspin/soil/agent/metrics"
+	"github.com/akaspin/soil/client"
+	"github.com/akaspin/soil/fixture"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClient_URL(t *testing.T) {
+	cli := client.NewClient(client.Config{
+		URL:      "http://127.0.0.1:7654/",
+		Redirect: true,
+	})
+	assert.Equal(t, "http://127.0.0.1:7654/v1/status/ping?redirect=", cli.URL(proto.V1StatusPing, nil))
+	assert.Equal(t, "http://127.0.0.1:7654/v1/events?node=node-1&redirect=&topics=nodes",
+		cli.WithNode("node-1").URL(proto.V1Events, url.Values{"topics": {"nodes"}}))
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := logx.GetLog("test")
+
+	registryCons := bus.NewTestingConsumer(ctx)
+	nodesGet := api.NewClusterNodesGet(log)
+	var drained []bool
+	drainFn := func(on bool) {
+		drained = append(drained, on)
+	}
+	nodeStatus := proto.NodeStatus{
+		Agent: map[string]string{"id": "node-1", "drain": "false"},
+		Meta:  map[string]string{"rack": "left"},
+	}
+	env := map[string]map[string]string{
+		"provision": {"meta.rack": "left", "system.pod_exec": "ExecStart=/usr/bin/sleep inf"},
+	}
+	router := api_server.NewRouter(log, &metrics.BlackHole{},
+		api.NewStatusPingGet(),
+		api.NewStatusNodeGet(func() (proto.NodeStatus, error) {
+			return nodeStatus, nil
+		}),
+		api.NewStatusEnvGet(func() (map[string]map[string]string, error) {
+			return env, nil
+		}),
+		nodesGet,
+		api.NewAgentDrainPut(drainFn),
+		api.NewAgentDrainDelete(drainFn),
+		api.NewRegistryPodsPut(log, registryCons),
+		api.NewRegistryPodsDelete(log, registryCons),
+	)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	nodesGet.Processor().(bus.Consumer).ConsumeMessage(bus.NewMessage("nodes", proto.NodesInfo{
+		{ID: "node-1", Advertise: "127.0.0.1:7654"},
+	}))
+	router.ConsumeMessage(bus.NewMessage("nodes", proto.NodesInfo{
+		{ID: "node-1", Advertise: srv.Listener.Addr().String()},
+	}))
+	cli := client.NewClient(client.Config{
+		URL: srv.URL,
+	})
+
+	t.Run(`ping`, func(t *testing.T) {
+		assert.NoError(t, cli.Ping(ctx))
+	})
+	t.Run(`nodes`, func(t *testing.T) {
+		nodes, err := cli.Nodes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, proto.NodesInfo{{ID: "node-1", Advertise: "127.0.0.1:7654"}}, nodes)
+	})
+	t.Run(`node`, func(t *testing.T) {
+		res, err := cli.Node(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, nodeStatus, res)
+	})
+	t.Run(`env`, func(t *testing.T) {
+		res, err := cli.Env(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, env, res)
+	})
+	t.Run(`proxy`, func(t *testing.T) {
+		assert.NoError(t, cli.WithNode("node-1").Ping(ctx))
+	})
+	t.Run(`node not found`, func(t *testing.T) {
+		err := cli.WithNode("node-2").Ping(ctx)
+		require.Error(t, err)
+		assert.Equal(t, 404, err.(*client.Error).StatusCode)
+	})
+	t.Run(`drain`, func(t *testing.T) {
+		assert.NoError(t, cli.Drain(ctx))
+		assert.NoError(t, cli.Undrain(ctx))
+		assert.Equal(t, []bool{true, false}, drained)
+	})
+	t.Run(`registry put`, func(t *testing.T) {
+		require.NoError(t, cli.RegistryPut(ctx, manifest.PodSlice{
+			{Name: "1", Namespace: manifest.PublicNamespace},
+		}))
+		fixture.WaitNoErrorT10(t, registryCons.ExpectLastMessageFn(bus.NewMessage("1", manifest.Pod{Name: "1", Namespace: manifest.PublicNamespace})))
+	})
+	t.Run(`registry delete`, func(t *testing.T) {
+		require.NoError(t, cli.RegistryDelete(ctx, "1"))
+		fixture.WaitNoErrorT10(t, registryCons.ExpectLastMessageFn(bus.NewMessage("1", nil)))
+	})
+	t.Run(`reload not found`, func(t *testing.T) {
+		err := cli.Reload(ctx)
+		require.Error(t, err)
+		assert.Equal(t, 404, err.(*client.Error).StatusCode)
+	})
+}
+
+func TestClient_Events(t *testing.T) {
+	large := strings.Repeat("a", 1024*128)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "{\"Topic\":\"registry\",\"Payload\":{\"large\":%q}}\n", large)
+		fmt.Fprint(w, "{\"Topic\":\"nodes\",\"Payload\":null}\n")
+	}))
+	defer srv.Close()
+
+	cli := client.NewClient(client.Config{
+		URL: srv.URL,
+	})
+	var topics []string
+	var payloads []string
+	err := cli.Events(context.Background(), nil, func(event proto.Event) error {
+		topics = append(topics, event.Topic)
+		payloads = append(payloads, string(event.Payload))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry", "nodes"}, topics)
+	assert.Equal(t, []string{fmt.Sprintf("{\"large\":%q}", large), "null"}, payloads)
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/akaspin/soil/proto"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Events streams agent events with given topics to fn until context is done,
+// stream is closed or fn returns error. Empty topics means all topics.
+func (c *Client) Events(ctx context.Context, topics []string, fn func(event proto.Event) error) (err error) {
+	query := url.Values{}
+	if len(topics) > 0 {
+		query.Set("topics", strings.Join(topics, ","))
+	}
+	body, err := c.do(ctx, http.MethodGet, proto.V1Events, query, nil)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	decoder := json.NewDecoder(body)
+	for {
+		var event proto.Event
+		if err = decoder.Decode(&event); err != nil {
+			break
+		}
+		if err = fn(event); err != nil {
+			return
+		}
+	}
+	if err == io.EOF || ctx.Err() != nil {
+		err = nil
+	}
+	return
+}
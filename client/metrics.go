@@ -0,0 +1,20 @@
+package client
+
+import (
+	"context"
+	"github.com/akaspin/soil/proto"
+	"io/ioutil"
+	"net/http"
+)
+
+// Metrics returns agent metrics in Prometheus text format
+func (c *Client) Metrics(ctx context.Context) (res string, err error) {
+	body, err := c.do(ctx, http.MethodGet, proto.V1Metrics, nil, nil)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	raw, err := ioutil.ReadAll(body)
+	res = string(raw)
+	return
+}
@@ -0,0 +1,14 @@
+package client
+
+import (
+	"context"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+)
+
+// Plan returns what agent will do with given pods without registry update
+func (c *Client) Plan(ctx context.Context, pods manifest.PodSlice) (res []proto.PodPlan, err error) {
+	err = c.doJSON(ctx, http.MethodPost, proto.V1Plan, pods, &res)
+	return
+}
@@ -1,4 +0,0 @@
-package client
-
-type Processor interface {
-}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+)
+
+// Registry returns public registry pods
+func (c *Client) Registry(ctx context.Context) (res manifest.PodSlice, err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1Registry, nil, &res)
+	return
+}
+
+// RegistryPut puts pods to public registry
+func (c *Client) RegistryPut(ctx context.Context, pods manifest.PodSlice) (err error) {
+	err = c.doJSON(ctx, http.MethodPut, proto.V1Registry, pods, nil)
+	return
+}
+
+// RegistryDelete removes pods with given names from public registry
+func (c *Client) RegistryDelete(ctx context.Context, names ...string) (err error) {
+	err = c.doJSON(ctx, http.MethodDelete, proto.V1Registry, names, nil)
+	return
+}
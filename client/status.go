@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"github.com/akaspin/soil/proto"
+	"net/http"
+)
+
+// Ping checks agent is alive
+func (c *Client) Ping(ctx context.Context) (err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1StatusPing, nil, nil)
+	return
+}
+
+// Nodes returns all nodes in cluster
+func (c *Client) Nodes(ctx context.Context) (res proto.NodesInfo, err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1StatusNodes, nil, &res)
+	return
+}
+
+// ExplainPod explains pod constraints evaluation by all arbiters
+func (c *Client) ExplainPod(ctx context.Context, name string) (res []proto.ConstraintExplain, err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1StatusPods+name+"/explain", nil, &res)
+	return
+}
+
+// Node returns agent and meta info of specific agent
+func (c *Client) Node(ctx context.Context) (res proto.NodeStatus, err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1StatusNode, nil, &res)
+	return
+}
+
+// Env returns environment of each arbiter
+func (c *Client) Env(ctx context.Context) (res map[string]map[string]string, err error) {
+	err = c.doJSON(ctx, http.MethodGet, proto.V1StatusEnv, nil, &res)
+	return
+}
@@ -46,6 +46,18 @@ func (a *Agent) Run(args ...string) (err error) {
 		a.ServerOptions.Meta[split[0]] = split[1]
 	}
 
+	// system mode can not be changed on reload
+	bootConfig := agent.DefaultConfig()
+	if readErr := bootConfig.Read(a.ServerOptions.ConfigPath...); readErr != nil {
+		log.Warningf("read system mode: %v", readErr)
+	}
+	systemPaths, systemdConn, err := agent.GetSystemMode(bootConfig.System["mode"])
+	if err != nil {
+		return
+	}
+	a.ServerOptions.SystemPaths = &systemPaths
+	a.ServerOptions.SystemdConn = systemdConn
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"context"
+	"github.com/akaspin/cut"
+	"github.com/spf13/cobra"
+)
+
+type AgentDrain struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *AgentDrain) Bind(cc *cobra.Command) {
+	cc.Use = `drain`
+	cc.Short = "Remove all pods from agent"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *AgentDrain) Run(args ...string) (err error) {
+	err = c.Client().Drain(context.Background())
+	return
+}
+
+type AgentUndrain struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *AgentUndrain) Bind(cc *cobra.Command) {
+	cc.Use = `undrain`
+	cc.Short = "Return drained agent to normal operation"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *AgentUndrain) Run(args ...string) (err error) {
+	err = c.Client().Undrain(context.Background())
+	return
+}
+
+type AgentReload struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *AgentReload) Bind(cc *cobra.Command) {
+	cc.Use = `reload`
+	cc.Short = "Reload agent configuration"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *AgentReload) Run(args ...string) (err error) {
+	err = c.Client().Reload(context.Background())
+	return
+}
+
+type AgentMetaSet struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *AgentMetaSet) Bind(cc *cobra.Command) {
+	cc.Use = `meta-set field=value...`
+	cc.Short = "Set runtime agent metadata"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *AgentMetaSet) Run(args ...string) (err error) {
+	values := map[string]string{}
+	if err = parseKV(values, args); err != nil {
+		return
+	}
+	err = c.Client().MetaPut(context.Background(), values)
+	return
+}
+
+type AgentMetaDelete struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *AgentMetaDelete) Bind(cc *cobra.Command) {
+	cc.Use = `meta-delete field...`
+	cc.Short = "Remove runtime agent metadata"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *AgentMetaDelete) Run(args ...string) (err error) {
+	err = c.Client().MetaDelete(context.Background(), args...)
+	return
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/akaspin/soil/client"
+	"github.com/spf13/cobra"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	outputFormatTable = "table"
+	outputFormatJSON  = "json"
+)
+
+type ClientURLOptions struct {
+	URL      string
+	NodeID   string
+	Redirect bool
+}
+
+func (o *ClientURLOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.URL, "url", "", client.DefaultURL, "agent API URL")
+	cc.Flags().StringVarP(&o.NodeID, "node", "", "", "node id")
+	cc.Flags().BoolVarP(&o.Redirect, "redirect", "", false, "allow redirects to node instead proxying")
+}
+
+// Client returns API client
+func (o *ClientURLOptions) Client() (c *client.Client) {
+	c = client.NewClient(client.Config{
+		URL:      o.URL,
+		Node:     o.NodeID,
+		Redirect: o.Redirect,
+	})
+	return
+}
+
+type ClientOutputOptions struct {
+	Format string
+}
+
+func (o *ClientOutputOptions) Bind(cc *cobra.Command) {
+	cc.Flags().StringVarP(&o.Format, "format", "", outputFormatTable, "output format (table or json)")
+}
+
+// Write writes v as JSON or calls fn to write table
+func (o *ClientOutputOptions) Write(w io.Writer, v interface{}, fn func(w io.Writer)) (err error) {
+	switch o.Format {
+	case outputFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(v)
+	case outputFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fn(tw)
+		err = tw.Flush()
+	default:
+		err = fmt.Errorf("unknown output format %s", o.Format)
+	}
+	return
+}
@@ -1,37 +1,37 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"github.com/akaspin/cut"
 	"github.com/spf13/cobra"
-	"net/http"
+	"io"
+	"sort"
 )
 
-type ClientURLOptions struct {
-	URL      string
-	NodeID   string
-	Redirect bool
-}
-
-type ClientOutputOptions struct {
-}
-
 type Nodes struct {
 	*cut.Environment
 	*ClientURLOptions
+	*ClientOutputOptions
 }
 
 func (c *Nodes) Bind(cc *cobra.Command) {
 	cc.Use = `nodes`
 	cc.Short = "List nodes in cluster"
+	cc.Args = cobra.NoArgs
 }
 
 func (c *Nodes) Run(args ...string) (err error) {
-	p := fmt.Sprintf("%s/v1/status/nodes", c.ClientURLOptions.URL)
-	_, err = http.NewRequest(http.MethodGet, p, nil)
+	nodes, err := c.Client().Nodes(context.Background())
 	if err != nil {
 		return
 	}
-
+	sort.Sort(nodes)
+	err = c.Write(c.Stdout, nodes, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tADVERTISE\tVERSION\tAPI")
+		for _, node := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.ID, node.Advertise, node.Version, node.API)
+		}
+	})
 	return
 }
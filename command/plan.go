@@ -0,0 +1,86 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/cut"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/akaspin/soil/proto"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+type Plan struct {
+	*cut.Environment
+	*ClientURLOptions
+	All bool
+}
+
+func (c *Plan) Bind(cc *cobra.Command) {
+	cc.Use = `plan [flags] manifest...`
+	cc.Short = "Show what agents will do with pods without registry update"
+	cc.Args = cobra.MinimumNArgs(1)
+	cc.Flags().BoolVarP(&c.All, "all", "", false, "plan on all nodes in cluster")
+}
+
+func (c *Plan) Run(args ...string) (err error) {
+	var buffers lib.StaticBuffers
+	if err = buffers.ReadFiles(args...); err != nil {
+		return
+	}
+	var pods manifest.PodSlice
+	if err = pods.Unmarshal(manifest.PublicNamespace, buffers.GetReaders()...); err != nil {
+		return
+	}
+	ctx := context.Background()
+	cli := c.Client()
+	nodes := []string{c.NodeID}
+	if c.All {
+		var info proto.NodesInfo
+		if info, err = cli.WithNode("").Nodes(ctx); err != nil {
+			return
+		}
+		nodes = nil
+		for _, node := range info {
+			nodes = append(nodes, node.ID)
+		}
+	}
+	for _, node := range nodes {
+		var plans []proto.PodPlan
+		if plans, err = cli.WithNode(node).Plan(ctx, pods); err != nil {
+			return
+		}
+		if c.All {
+			fmt.Fprintf(c.Stdout, "node %s:\n", node)
+		}
+		c.writePlans(plans)
+	}
+	return
+}
+
+func (c *Plan) writePlans(plans []proto.PodPlan) {
+	for _, plan := range plans {
+		if !plan.Allocated {
+			fmt.Fprintf(c.Stdout, "pod %s: not allocated\n", plan.Name)
+			for _, failure := range plan.Failures {
+				fmt.Fprintf(c.Stdout, "  %s\n", failure)
+			}
+			continue
+		}
+		if len(plan.Instructions) == 0 {
+			fmt.Fprintf(c.Stdout, "pod %s: no changes\n", plan.Name)
+			continue
+		}
+		fmt.Fprintf(c.Stdout, "pod %s:\n", plan.Name)
+		for _, pending := range plan.Pending {
+			fmt.Fprintf(c.Stdout, "  pending %s\n", pending)
+		}
+		for _, instruction := range plan.Instructions {
+			fmt.Fprintf(c.Stdout, "  %d:%s:%s\n", instruction.Phase, instruction.Action, instruction.Path)
+			if instruction.Diff != "" {
+				fmt.Fprintf(c.Stdout, "    %s\n", strings.Replace(strings.TrimSpace(instruction.Diff), "\n", "\n    ", -1))
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/akaspin/cut"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+type Registry struct {
+	*cut.Environment
+}
+
+func (c *Registry) Bind(cc *cobra.Command) {
+	cc.Use = `registry`
+	cc.Short = "Manage public registry"
+}
+
+type RegistryGet struct {
+	*cut.Environment
+	*ClientURLOptions
+	*ClientOutputOptions
+}
+
+func (c *RegistryGet) Bind(cc *cobra.Command) {
+	cc.Use = `get`
+	cc.Short = "List pods in public registry"
+	cc.Args = cobra.NoArgs
+}
+
+func (c *RegistryGet) Run(args ...string) (err error) {
+	pods, err := c.Client().Registry(context.Background())
+	if err != nil {
+		return
+	}
+	err = c.Write(c.Stdout, pods, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tTARGET\tCOUNT\tUNITS\tBLOBS\tRESOURCES\tPROVIDERS")
+		for _, pod := range pods {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+				pod.Name, pod.Target, pod.Count, len(pod.Units), len(pod.Blobs), len(pod.Resources), len(pod.Providers))
+		}
+	})
+	return
+}
+
+type RegistryPut struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *RegistryPut) Bind(cc *cobra.Command) {
+	cc.Use = `put [flags] manifest...`
+	cc.Short = "Put pods from manifests to public registry"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *RegistryPut) Run(args ...string) (err error) {
+	var buffers lib.StaticBuffers
+	if err = buffers.ReadFiles(args...); err != nil {
+		return
+	}
+	var pods manifest.PodSlice
+	if err = pods.Unmarshal(manifest.PublicNamespace, buffers.GetReaders()...); err != nil {
+		return
+	}
+	if err = c.Client().RegistryPut(context.Background(), pods); err != nil {
+		return
+	}
+	for _, pod := range pods {
+		fmt.Fprintf(c.Stdout, "pod %s: registered\n", pod.Name)
+	}
+	return
+}
+
+type RegistryDelete struct {
+	*cut.Environment
+	*ClientURLOptions
+}
+
+func (c *RegistryDelete) Bind(cc *cobra.Command) {
+	cc.Use = `delete [flags] pod...`
+	cc.Short = "Remove pods from public registry"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *RegistryDelete) Run(args ...string) (err error) {
+	if err = c.Client().RegistryDelete(context.Background(), args...); err != nil {
+		return
+	}
+	for _, name := range args {
+		fmt.Fprintf(c.Stdout, "pod %s: removed\n", name)
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package command
+
+import (
+	"fmt"
+	"github.com/akaspin/cut"
+	"github.com/akaspin/soil/agent"
+	"github.com/akaspin/soil/agent/allocation"
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+type Render struct {
+	*cut.Environment
+	Namespace string
+	Meta      []string // Metadata set
+	System    []string // System properties set
+	Host      []string // Host facts set
+}
+
+func (c *Render) Bind(cc *cobra.Command) {
+	cc.Use = `render [flags] manifest...`
+	cc.Short = "Print unit files and blobs produced by pods manifests"
+	cc.Args = cobra.MinimumNArgs(1)
+	cc.Flags().StringVarP(&c.Namespace, "namespace", "", manifest.PrivateNamespace, "pods namespace")
+	cc.Flags().StringArrayVarP(&c.Meta, "meta", "", nil, "node metadata in form field=value")
+	cc.Flags().StringArrayVarP(&c.System, "system", "", nil, "system property in form field=value")
+	cc.Flags().StringArrayVarP(&c.Host, "host", "", nil, "host fact in form field=value")
+}
+
+func (c *Render) Run(args ...string) (err error) {
+	var buffers lib.StaticBuffers
+	if err = buffers.ReadFiles(args...); err != nil {
+		return
+	}
+	var pods manifest.PodSlice
+	if err = pods.Unmarshal(c.Namespace, buffers.GetReaders()...); err != nil {
+		return
+	}
+	config := agent.DefaultConfig()
+	if err = parseKV(config.Meta, c.Meta); err != nil {
+		return
+	}
+	if err = parseKV(config.System, c.System); err != nil {
+		return
+	}
+	host := map[string]string{}
+	if err = parseKV(host, c.Host); err != nil {
+		return
+	}
+	env := map[string]string{}
+	for k, v := range config.Meta {
+		env["meta."+k] = v
+	}
+	for k, v := range config.System {
+		env["system."+k] = v
+	}
+	for k, v := range host {
+		env["host."+k] = v
+	}
+	for _, pod := range pods {
+		alloc := &allocation.Pod{
+			UnitFile: allocation.UnitFile{
+				SystemPaths: allocation.DefaultSystemPaths(),
+			},
+		}
+		if err = alloc.FromManifest(pod, env); err != nil {
+			return
+		}
+		fmt.Fprintf(c.Stdout, "# %s\n%s\n", alloc.UnitFile.Path, alloc.UnitFile.Source)
+		for _, unit := range alloc.Units {
+			fmt.Fprintf(c.Stdout, "# %s\n%s\n", unit.UnitFile.Path, unit.UnitFile.Source)
+		}
+		for _, blob := range alloc.Blobs {
+			if blob.IsExternal() {
+				fmt.Fprintf(c.Stdout, "# %s (%#o) from %s%s sha256:%s\n\n", blob.Name, blob.Permissions, blob.SourceURL, blob.SourceFile, blob.SHA256)
+				continue
+			}
+			fmt.Fprintf(c.Stdout, "# %s (%#o)\n%s\n", blob.Name, blob.Permissions, blob.Source)
+		}
+		for _, dropIn := range alloc.DropIns {
+			fmt.Fprintf(c.Stdout, "# %s\n%s\n", dropIn.Path, dropIn.Source)
+		}
+	}
+	return
+}
+
+// parseKV parses "field=value" chunks to given map
+func parseKV(dst map[string]string, chunks []string) (err error) {
+	for _, chunk := range chunks {
+		split := strings.SplitN(chunk, "=", 2)
+		if len(split) != 2 {
+			err = fmt.Errorf("bad %s: should be field=value", chunk)
+			return
+		}
+		dst[split[0]] = split[1]
+	}
+	return
+}
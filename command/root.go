@@ -21,6 +21,8 @@ func Run(stderr, stdout io.Writer, stdin io.Reader, args ...string) (err error)
 		Stdout: stdout,
 	}
 	configs := &AgentOptions{}
+	clientURLOptions := &ClientURLOptions{}
+	clientOutputOptions := &ClientOutputOptions{}
 
 	cmd := cut.Attach(
 		&Soil{env}, []cut.Binder{env},
@@ -29,6 +31,77 @@ func Run(stderr, stdout io.Writer, stdin io.Reader, args ...string) (err error)
 				Environment:  env,
 				AgentOptions: configs,
 			}, []cut.Binder{configs},
+			cut.Attach(
+				&AgentDrain{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+			cut.Attach(
+				&AgentUndrain{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+			cut.Attach(
+				&AgentReload{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+			cut.Attach(
+				&AgentMetaSet{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+			cut.Attach(
+				&AgentMetaDelete{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+		),
+		cut.Attach(
+			&Nodes{
+				Environment:         env,
+				ClientURLOptions:    clientURLOptions,
+				ClientOutputOptions: clientOutputOptions,
+			}, []cut.Binder{clientURLOptions, clientOutputOptions},
+		),
+		cut.Attach(
+			&Registry{env}, nil,
+			cut.Attach(
+				&RegistryGet{
+					Environment:         env,
+					ClientURLOptions:    clientURLOptions,
+					ClientOutputOptions: clientOutputOptions,
+				}, []cut.Binder{clientURLOptions, clientOutputOptions},
+			),
+			cut.Attach(
+				&RegistryPut{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+			cut.Attach(
+				&RegistryDelete{
+					Environment:      env,
+					ClientURLOptions: clientURLOptions,
+				}, []cut.Binder{clientURLOptions},
+			),
+		),
+		cut.Attach(
+			&Plan{
+				Environment:      env,
+				ClientURLOptions: clientURLOptions,
+			}, []cut.Binder{clientURLOptions},
+		),
+		cut.Attach(
+			&Validate{env}, nil,
+		),
+		cut.Attach(
+			&Render{Environment: env}, nil,
 		),
 		cut.Attach(
 			&Version{env}, nil,
@@ -10,5 +10,6 @@ func main() {
 	err := command.Run(os.Stderr, os.Stdout, os.Stdin, os.Args[1:]...)
 	if err != nil {
 		logx.GetLog("main").Critical(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"fmt"
+	"github.com/akaspin/cut"
+	"github.com/akaspin/soil/manifest"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+)
+
+type Validate struct {
+	*cut.Environment
+}
+
+func (c *Validate) Bind(cc *cobra.Command) {
+	cc.Use = `validate manifest...`
+	cc.Short = "Validate pods manifests"
+	cc.Args = cobra.MinimumNArgs(1)
+}
+
+func (c *Validate) Run(args ...string) (err error) {
+	var problems int
+	for _, path := range args {
+		var src []byte
+		if src, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		for _, problem := range manifest.Validate(path, src) {
+			fmt.Fprintln(c.Stdout, problem.Error())
+			problems++
+		}
+	}
+	if problems > 0 {
+		err = fmt.Errorf("%d problems found", problems)
+	}
+	return
+}
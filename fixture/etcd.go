@@ -0,0 +1,124 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/coreos/etcd/embed"
+	"github.com/coreos/pkg/capnslog"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type EtcdServerConfig struct {
+	Port     int
+	PeerPort int
+}
+
+// EtcdServer runs single node embedded etcd server in test process. Data
+// directory is kept between Down and Up and removed on Clean.
+type EtcdServer struct {
+	t       *testing.T
+	dataDir string
+	Config  *EtcdServerConfig
+	etcd    *embed.Etcd
+}
+
+func NewEtcdServer(t *testing.T, configFn func(config *EtcdServerConfig)) (s *EtcdServer) {
+	t.Helper()
+	ports := RandomPorts(t, 2)
+	s = &EtcdServer{
+		t: t,
+		Config: &EtcdServerConfig{
+			Port:     ports[0],
+			PeerPort: ports[1],
+		},
+	}
+	if configFn != nil {
+		configFn(s.Config)
+	}
+	var err error
+	if s.dataDir, err = ioutil.TempDir("", "etcd"); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	capnslog.SetGlobalLogLevel(capnslog.WARNING)
+	return
+}
+
+func (s *EtcdServer) Address() (res string) {
+	res = fmt.Sprintf("127.0.0.1:%d", s.Config.Port)
+	return
+}
+
+func (s *EtcdServer) Up() {
+	s.t.Helper()
+	if s.etcd != nil {
+		return
+	}
+	clientURL := url.URL{Scheme: "http", Host: s.Address()}
+	peerURL := url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", s.Config.PeerPort)}
+	config := embed.NewConfig()
+	config.Name = TestName(s.t)
+	config.Dir = s.dataDir
+	config.LCUrls, config.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	config.LPUrls, config.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	config.InitialCluster = config.InitialClusterFromName(config.Name)
+	etcd, err := embed.StartEtcd(config)
+	if err != nil {
+		s.t.Error(err)
+		s.t.FailNow()
+		return
+	}
+	select {
+	case <-etcd.Server.ReadyNotify():
+	case <-time.After(time.Second * 10):
+		etcd.Close()
+		s.t.Error(`etcd is not ready`)
+		s.t.FailNow()
+		return
+	}
+	s.etcd = etcd
+	s.t.Logf(`started: %s on %s`, TestName(s.t), s.Address())
+}
+
+func (s *EtcdServer) Down() {
+	s.t.Helper()
+	if s.etcd == nil {
+		return
+	}
+	s.etcd.Close()
+	s.etcd = nil
+}
+
+func (s *EtcdServer) Clean() {
+	s.t.Helper()
+	s.Down()
+	os.RemoveAll(s.dataDir)
+}
+
+func (s *EtcdServer) WaitAlive() {
+	s.t.Helper()
+	WaitNoErrorT(s.t, WaitConfig{
+		Retry:   time.Millisecond * 500,
+		Retries: 100,
+	}, func() (err error) {
+		resp, err := http.Get(fmt.Sprintf("http://%s/health", s.Address()))
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return
+		}
+		if resp.StatusCode != 200 || !strings.Contains(string(body), `"true"`) {
+			err = fmt.Errorf("etcd is not healthy: %s", string(body))
+		}
+		return
+	})
+	s.t.Logf(`etcd %s is alive`, s.Address())
+}
@@ -0,0 +1,254 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/akaspin/soil/lib"
+	"github.com/coreos/go-systemd/dbus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+type fakeUnit struct {
+	activeState string
+	subState    string
+	enabled     bool
+}
+
+// FakeSystemd is in-memory SystemD. FakeSystemd discovers unit files in given
+// directories and tracks unit states. All connections opened by Conn share
+// the same state.
+type FakeSystemd struct {
+	dirs []string
+
+	mu      sync.Mutex
+	units   map[string]*fakeUnit
+	reloads int
+}
+
+func NewFakeSystemd(dirs ...string) (s *FakeSystemd) {
+	s = &FakeSystemd{
+		dirs:  dirs,
+		units: map[string]*fakeUnit{},
+	}
+	return
+}
+
+// Conn opens new connection. Conn can be used as lib.SystemdConnFactory.
+func (s *FakeSystemd) Conn() (conn lib.SystemdConn, err error) {
+	conn = &fakeSystemdConn{
+		systemd: s,
+	}
+	return
+}
+
+// SetState sets unit states. Use it to simulate unit crash.
+func (s *FakeSystemd) SetState(name, activeState, subState string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.getUnit(name)
+	u.activeState, u.subState = activeState, subState
+}
+
+// States returns active states of all units with unit files
+func (s *FakeSystemd) States() (res map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = map[string]string{}
+	for name := range s.findFiles("*") {
+		res[name] = s.getUnit(name).activeState
+	}
+	return
+}
+
+// IsEnabled returns true if unit is enabled
+func (s *FakeSystemd) IsEnabled(name string) (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok = s.getUnit(name).enabled
+	return
+}
+
+// Reloads returns number of daemon reloads
+func (s *FakeSystemd) Reloads() (res int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res = s.reloads
+	return
+}
+
+func (s *FakeSystemd) getUnit(name string) (u *fakeUnit) {
+	u, ok := s.units[name]
+	if !ok {
+		u = &fakeUnit{
+			activeState: "inactive",
+			subState:    "dead",
+		}
+		s.units[name] = u
+	}
+	return
+}
+
+// findFiles returns unit files paths by unit name
+func (s *FakeSystemd) findFiles(pattern string) (res map[string]string) {
+	res = map[string]string{}
+	for _, dir := range s.dirs {
+		infos, _ := ioutil.ReadDir(dir)
+		for _, info := range infos {
+			if info.IsDir() {
+				continue
+			}
+			if ok, _ := filepath.Match(pattern, info.Name()); ok {
+				if _, exists := res[info.Name()]; !exists {
+					res[info.Name()] = filepath.Join(dir, info.Name())
+				}
+			}
+		}
+	}
+	return
+}
+
+type fakeSystemdConn struct {
+	systemd *FakeSystemd
+}
+
+func (c *fakeSystemdConn) Reload() (err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	c.systemd.reloads++
+	return
+}
+
+func (c *fakeSystemdConn) EnableUnitFiles(files []string, runtime bool, force bool) (ok bool, changes []dbus.EnableUnitFileChange, err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	for _, file := range files {
+		if _, statErr := os.Stat(file); statErr != nil {
+			err = statErr
+			return
+		}
+		c.systemd.getUnit(filepath.Base(file)).enabled = true
+	}
+	return
+}
+
+func (c *fakeSystemdConn) DisableUnitFiles(files []string, runtime bool) (changes []dbus.DisableUnitFileChange, err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	for _, file := range files {
+		c.systemd.getUnit(filepath.Base(file)).enabled = false
+	}
+	return
+}
+
+func (c *fakeSystemdConn) StartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.job(name, ch, func(u *fakeUnit) (err error) {
+		u.activeState, u.subState = "active", "running"
+		return
+	})
+}
+
+func (c *fakeSystemdConn) StopUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.job(name, ch, func(u *fakeUnit) (err error) {
+		u.activeState, u.subState = "inactive", "dead"
+		return
+	})
+}
+
+func (c *fakeSystemdConn) ReloadUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.job(name, ch, func(u *fakeUnit) (err error) {
+		if u.activeState != "active" {
+			err = fmt.Errorf("unit %s is not active", name)
+		}
+		return
+	})
+}
+
+func (c *fakeSystemdConn) RestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.StartUnit(name, mode, ch)
+}
+
+func (c *fakeSystemdConn) TryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.job(name, ch, func(u *fakeUnit) (err error) {
+		return
+	})
+}
+
+func (c *fakeSystemdConn) ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.StartUnit(name, mode, ch)
+}
+
+func (c *fakeSystemdConn) ReloadOrTryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return c.TryRestartUnit(name, mode, ch)
+}
+
+func (c *fakeSystemdConn) ListUnits() (res []dbus.UnitStatus, err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	files := c.systemd.findFiles("*")
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u := c.systemd.getUnit(name)
+		res = append(res, dbus.UnitStatus{
+			Name:        name,
+			LoadState:   "loaded",
+			ActiveState: u.activeState,
+			SubState:    u.subState,
+		})
+	}
+	return
+}
+
+func (c *fakeSystemdConn) ListUnitFilesByPatterns(states []string, patterns []string) (res []dbus.UnitFile, err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	found := map[string]string{}
+	for _, pattern := range patterns {
+		for name, path := range c.systemd.findFiles(pattern) {
+			found[name] = path
+		}
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fileType := "static"
+		if c.systemd.getUnit(name).enabled {
+			fileType = "enabled"
+		}
+		res = append(res, dbus.UnitFile{
+			Path: found[name],
+			Type: fileType,
+		})
+	}
+	return
+}
+
+func (c *fakeSystemdConn) Close() {}
+
+// job runs fn on unit and sends "done" to ch
+func (c *fakeSystemdConn) job(name string, ch chan<- string, fn func(u *fakeUnit) error) (id int, err error) {
+	c.systemd.mu.Lock()
+	defer c.systemd.mu.Unlock()
+	if _, ok := c.systemd.findFiles(name)[name]; !ok {
+		err = fmt.Errorf("unit %s not found", name)
+		return
+	}
+	if err = fn(c.systemd.getUnit(name)); err != nil {
+		return
+	}
+	if ch != nil {
+		go func() {
+			ch <- "done"
+		}()
+	}
+	return
+}
@@ -0,0 +1,63 @@
+// +build ide test_unit
+
+package fixture_test
+
+import (
+	"github.com/akaspin/soil/fixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFakeSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soil-fake-systemd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	systemd := fixture.NewFakeSystemd(dir)
+	conn, err := systemd.Conn()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Run("0 start without unit file", func(t *testing.T) {
+		_, err := conn.StartUnit("test-1.service", "replace", nil)
+		assert.Error(t, err)
+	})
+	t.Run("1 enable and start", func(t *testing.T) {
+		path := filepath.Join(dir, "test-1.service")
+		require.NoError(t, ioutil.WriteFile(path, []byte("[Service]\n"), 0644))
+		assert.NoError(t, conn.Reload())
+		_, _, err := conn.EnableUnitFiles([]string{path}, true, false)
+		assert.NoError(t, err)
+		ch := make(chan string)
+		_, err = conn.StartUnit("test-1.service", "replace", ch)
+		assert.NoError(t, err)
+		assert.Equal(t, "done", <-ch)
+		assert.Equal(t, map[string]string{"test-1.service": "active"}, systemd.States())
+		assert.True(t, systemd.IsEnabled("test-1.service"))
+		assert.Equal(t, 1, systemd.Reloads())
+
+		files, err := conn.ListUnitFilesByPatterns(nil, []string{"test-*"})
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+		assert.Equal(t, path, files[0].Path)
+	})
+	t.Run("2 crash", func(t *testing.T) {
+		systemd.SetState("test-1.service", "failed", "failed")
+		units, err := conn.ListUnits()
+		assert.NoError(t, err)
+		assert.Len(t, units, 1)
+		assert.Equal(t, "failed", units[0].ActiveState)
+	})
+	t.Run("3 stop and remove", func(t *testing.T) {
+		_, err := conn.StopUnit("test-1.service", "replace", nil)
+		assert.NoError(t, err)
+		_, err = conn.DisableUnitFiles([]string{filepath.Join(dir, "test-1.service")}, true)
+		assert.NoError(t, err)
+		require.NoError(t, os.Remove(filepath.Join(dir, "test-1.service")))
+		assert.Equal(t, map[string]string{}, systemd.States())
+	})
+}
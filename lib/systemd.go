@@ -0,0 +1,47 @@
+package lib
+
+import "github.com/coreos/go-systemd/dbus"
+
+// SystemdConn is connection to SystemD used by agent. *dbus.Conn satisfies
+// SystemdConn.
+type SystemdConn interface {
+	Reload() error
+	EnableUnitFiles(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
+	DisableUnitFiles(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+
+	StartUnit(name string, mode string, ch chan<- string) (int, error)
+	StopUnit(name string, mode string, ch chan<- string) (int, error)
+	ReloadUnit(name string, mode string, ch chan<- string) (int, error)
+	RestartUnit(name string, mode string, ch chan<- string) (int, error)
+	TryRestartUnit(name string, mode string, ch chan<- string) (int, error)
+	ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error)
+	ReloadOrTryRestartUnit(name string, mode string, ch chan<- string) (int, error)
+
+	ListUnits() ([]dbus.UnitStatus, error)
+	ListUnitFilesByPatterns(states []string, patterns []string) ([]dbus.UnitFile, error)
+
+	Close()
+}
+
+// SystemdConnFactory opens new SystemD connection
+type SystemdConnFactory func() (conn SystemdConn, err error)
+
+// NewDbusSystemdConn opens connection to system SystemD instance over dbus
+func NewDbusSystemdConn() (conn SystemdConn, err error) {
+	dbusConn, err := dbus.New()
+	if err != nil {
+		return
+	}
+	conn = dbusConn
+	return
+}
+
+// NewDbusUserSystemdConn opens connection to SystemD user instance over dbus
+func NewDbusUserSystemdConn() (conn SystemdConn, err error) {
+	dbusConn, err := dbus.NewUserConnection()
+	if err != nil {
+		return
+	}
+	conn = dbusConn
+	return
+}
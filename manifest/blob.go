@@ -1,11 +1,20 @@
 package manifest
 
 import (
+	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"regexp"
 	"strings"
 )
 
+var (
+	// supported blob archive formats
+	BlobArchiveFormats = []string{"tar", "tar.gz", "tgz", "zip"}
+
+	sha256Re = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
 type Blobs []Blob
 
 func (b *Blobs) Empty() ObjectParser {
@@ -23,9 +32,17 @@ func (b *Blobs) Append(v interface{}) (err error) {
 // Pod file
 type Blob struct {
 	Name        string
-	Permissions int  `json:",omitempty"`
-	Leave       bool `json:",omitempty"`
+	Permissions int    `json:",omitempty"`
+	Owner       string `json:",omitempty"`                // File owner name or uid
+	Group       string `json:",omitempty"`                // File group name or gid
+	DirMode     int    `json:",omitempty" hcl:"dir_mode"` // Permissions of created parent directories
+	Backup      bool   `json:",omitempty"`                // Keep replaced content in "<name>.bak"
+	Leave       bool   `json:",omitempty"`
 	Source      string
+	SourceFile  string `json:",omitempty" hcl:"source_file"` // Path to source on agent
+	SourceURL   string `json:",omitempty" hcl:"source_url"`  // URL to fetch source from
+	SHA256      string `json:",omitempty" hcl:"sha256"`      // Source URL checksum
+	Archive     string `json:",omitempty"`                   // Archive format to extract source to directory
 }
 
 func (b Blob) GetID(parent ...string) string {
@@ -34,7 +51,47 @@ func (b Blob) GetID(parent ...string) string {
 
 func (b *Blob) ParseAST(raw *ast.ObjectItem) (err error) {
 	b.Name = raw.Keys[0].Token.Value().(string)
-	err = hcl.DecodeObject(b, raw)
+	if err = hcl.DecodeObject(b, raw); err != nil {
+		return
+	}
 	b.Source = Heredoc(b.Source)
+	if err = b.validateSource(); err != nil {
+		return
+	}
+	err = checkInterpolation(fmt.Sprintf(`blob "%s"`, b.Name), b.Name, b.Source, b.SourceFile, b.SourceURL)
+	return
+}
+
+func (b *Blob) validateSource() (err error) {
+	var sources int
+	for _, source := range []string{b.Source, b.SourceFile, b.SourceURL} {
+		if source != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		err = fmt.Errorf(`blob "%s": only one of source, source_file and source_url can be defined`, b.Name)
+	case b.SourceURL != "" && !sha256Re.MatchString(b.SHA256):
+		err = fmt.Errorf(`blob "%s": source_url requires sha256 checksum in hex`, b.Name)
+	case b.SHA256 != "" && b.SourceURL == "" && b.SourceFile == "":
+		err = fmt.Errorf(`blob "%s": sha256 can be defined only with source_file or source_url`, b.Name)
+	case b.SHA256 != "" && !sha256Re.MatchString(b.SHA256):
+		err = fmt.Errorf(`blob "%s": sha256 should be checksum in hex`, b.Name)
+	case b.Archive != "" && b.SourceFile == "" && b.SourceURL == "":
+		err = fmt.Errorf(`blob "%s": archive requires source_file or source_url`, b.Name)
+	case b.Archive != "" && !isBlobArchiveFormat(b.Archive):
+		err = fmt.Errorf(`blob "%s": unknown archive format "%s"`, b.Name, b.Archive)
+	}
+	return
+}
+
+func isBlobArchiveFormat(format string) (ok bool) {
+	for _, candidate := range BlobArchiveFormats {
+		if format == candidate {
+			ok = true
+			return
+		}
+	}
 	return
 }
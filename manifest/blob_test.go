@@ -0,0 +1,41 @@
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBlob_ParseAST(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	cases := []struct {
+		blob string
+		ok   bool
+	}{
+		{`source = "a"`, true},
+		{`source_file = "/opt/a"`, true},
+		{`source_url = "http://example.com/a"` + "\n" + `sha256 = "` + sum + `"`, true},
+		{`source_url = "http://example.com/a.tgz"` + "\n" + `sha256 = "` + sum + `"` + "\n" + `archive = "tgz"`, true},
+		{`source_file = "/opt/a.zip"` + "\n" + `archive = "zip"`, true},
+		{`source = "a"` + "\n" + `source_file = "/opt/a"`, false},
+		{`source_url = "http://example.com/a"`, false},
+		{`source_url = "http://example.com/a"` + "\n" + `sha256 = "bad"`, false},
+		{`source_file = "/opt/a"` + "\n" + `sha256 = "` + sum + `"`, true},
+		{`source_file = "/opt/a"` + "\n" + `sha256 = "bad"`, false},
+		{`source = "a"` + "\n" + `sha256 = "` + sum + `"`, false},
+		{`source = "a"` + "\n" + `archive = "tar"`, false},
+		{`source_file = "/opt/a.rar"` + "\n" + `archive = "rar"`, false},
+	}
+	for i, c := range cases {
+		var pods manifest.PodSlice
+		err := pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader("pod \"1\" {\n  blob \"/opt/blob\" {\n"+c.blob+"\n  }\n}\n"))
+		if c.ok {
+			assert.NoError(t, err, "%d", i)
+		} else {
+			assert.Error(t, err, "%d", i)
+		}
+	}
+}
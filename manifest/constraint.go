@@ -1,8 +1,15 @@
 package manifest
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"hash/crc64"
 	"math/big"
+	"net"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -16,12 +23,96 @@ const (
 	opGreaterOrEqual = ">="
 	opIn             = "~"
 	opNotIn          = "!~"
+	opMatch          = "=~"
+	opInCIDR         = "in_cidr"
+
+	anyConstraintPrefix = "any:"
 )
 
 // Constraint can contain interpolations in form ${ns.key}.
-// Right field can also begins with compare operation: "<", ">" or "~" (in).
+// Right field can also begins with compare operation: "<", ">", "~" (in),
+// "=~" (regex match) or "in_cidr". Pairs with "any:" left field hold groups
+// created by NewAnyConstraint.
 type Constraint map[string]string
 
+// NewAnyConstraint returns constraint with one pair which is passed if any of
+// given groups is passed
+func NewAnyConstraint(groups ...Constraint) (res Constraint) {
+	buf, _ := json.Marshal(groups)
+	res = Constraint{
+		fmt.Sprintf("%s%x", anyConstraintPrefix, crc64.Checksum(buf, crc64.MakeTable(crc64.ECMA))): string(buf),
+	}
+	return
+}
+
+// ParseConstraintAST decodes constraint block. Nested "any" blocks can
+// contain pairs and "group" blocks. Each pair and group in "any" block is
+// alternative.
+func ParseConstraintAST(node ast.Node) (res Constraint, err error) {
+	body, ok := node.(*ast.ObjectType)
+	if !ok {
+		err = fmt.Errorf("should be an object")
+		return
+	}
+	res = Constraint{}
+	plain := &ast.ObjectList{}
+	for _, item := range body.List.Items {
+		anyBody, isObject := item.Val.(*ast.ObjectType)
+		if len(item.Keys) != 1 || item.Keys[0].Token.Value() != "any" || !isObject {
+			plain.Add(item)
+			continue
+		}
+		var groups []Constraint
+		for _, anyItem := range anyBody.List.Items {
+			if len(anyItem.Keys) == 1 && anyItem.Keys[0].Token.Value() == "group" {
+				var group Constraint
+				if group, err = ParseConstraintAST(anyItem.Val); err != nil {
+					return
+				}
+				groups = append(groups, group)
+				continue
+			}
+			var pair Constraint
+			if err = hcl.DecodeObject(&pair, &ast.ObjectList{Items: []*ast.ObjectItem{anyItem}}); err != nil {
+				return
+			}
+			groups = append(groups, pair)
+		}
+		res = res.Merge(NewAnyConstraint(groups...))
+	}
+	var pairs map[string]string
+	if err = hcl.DecodeObject(&pairs, plain); err != nil {
+		return
+	}
+	for left, right := range pairs {
+		res[left] = right
+	}
+	return
+}
+
+// anyGroups returns groups of "any" pair
+func anyGroups(left, right string) (groups []Constraint, ok bool) {
+	if !strings.HasPrefix(left, anyConstraintPrefix) {
+		return
+	}
+	ok = json.Unmarshal([]byte(right), &groups) == nil
+	return
+}
+
+// fields returns variables referenced by constraint pair
+func fields(left, right string) (res []string) {
+	if groups, ok := anyGroups(left, right); ok {
+		for _, group := range groups {
+			for groupLeft, groupRight := range group {
+				res = append(res, fields(groupLeft, groupRight)...)
+			}
+		}
+		return
+	}
+	res = ExtractEnv(left + right)
+	return
+}
+
 // Returns clone of constraint
 func (c Constraint) Clone() (res Constraint) {
 	res = Constraint{}
@@ -45,12 +136,11 @@ func (c Constraint) Merge(constraint ...Constraint) (res Constraint) {
 // FilterOut returns Constraint without pairs which contains references with given prefixes
 func (c Constraint) FilterOut(prefix ...string) (res Constraint) {
 	res = Constraint{}
-	var fields []string
 LOOP:
 	for left, right := range c {
-		fields = ExtractEnv(left + right)
+		pairFields := fields(left, right)
 		for _, p := range prefix {
-			for _, field := range fields {
+			for _, field := range pairFields {
 				if strings.HasPrefix(field, p) {
 					continue LOOP
 				}
@@ -61,19 +151,161 @@ LOOP:
 	return
 }
 
-// Check constraint against given environment
+// Check constraint against given environment. Returns *ConstraintError with
+// all failed pairs.
 func (c Constraint) Check(env map[string]string) (err error) {
+	var failures []ConstraintFailure
 	for left, right := range c {
+		if groups, ok := anyGroups(left, right); ok {
+			if anyErr := checkAny(groups, env); anyErr != nil {
+				failures = append(failures, ConstraintFailure{
+					Left:              left,
+					Right:             right,
+					InterpolatedLeft:  left,
+					InterpolatedRight: anyErr.Error(),
+				})
+			}
+			continue
+		}
 		leftV := Interpolate(left, env)
 		rightV := Interpolate(right, env)
 		if !check(leftV, rightV) {
-			err = fmt.Errorf(`constraint failed: "%s":"%s" ("%s":"%s")`, leftV, rightV, left, right)
+			failures = append(failures, ConstraintFailure{
+				Left:              left,
+				Right:             right,
+				InterpolatedLeft:  leftV,
+				InterpolatedRight: rightV,
+			})
+		}
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Left < failures[j].Left
+		})
+		err = &ConstraintError{
+			Failures: failures,
+		}
+	}
+	return
+}
+
+// Interpolate returns constraint with interpolated left and right fields
+func (c Constraint) Interpolate(env map[string]string) (res Constraint) {
+	res = Constraint{}
+	for left, right := range c {
+		if groups, ok := anyGroups(left, right); ok {
+			var interpolated []Constraint
+			for _, group := range groups {
+				interpolated = append(interpolated, group.Interpolate(env))
+			}
+			buf, _ := json.Marshal(interpolated)
+			res[left] = string(buf)
+			continue
+		}
+		res[Interpolate(left, env)] = Interpolate(right, env)
+	}
+	return
+}
+
+// Explain returns all constraint pairs with interpolated fields sorted by left
+// field. Unlike Interpolate Explain keeps pairs with equal interpolated left
+// fields.
+func (c Constraint) Explain(env map[string]string) (res []ConstraintPair) {
+	for left, right := range c {
+		if groups, ok := anyGroups(left, right); ok {
+			var interpolated []Constraint
+			for _, group := range groups {
+				interpolated = append(interpolated, group.Interpolate(env))
+			}
+			buf, _ := json.Marshal(interpolated)
+			res = append(res, ConstraintPair{
+				Left:              left,
+				Right:             right,
+				InterpolatedLeft:  left,
+				InterpolatedRight: string(buf),
+				Passed:            checkAny(groups, env) == nil,
+			})
+			continue
+		}
+		leftV := Interpolate(left, env)
+		rightV := Interpolate(right, env)
+		res = append(res, ConstraintPair{
+			Left:              left,
+			Right:             right,
+			InterpolatedLeft:  leftV,
+			InterpolatedRight: rightV,
+			Passed:            check(leftV, rightV),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Left < res[j].Left
+	})
+	return
+}
+
+// checkAny returns nil if any of given groups is passed. Otherwise returns
+// failures of all groups.
+func checkAny(groups []Constraint, env map[string]string) (err error) {
+	var chunks []string
+	for _, group := range groups {
+		groupErr := group.Check(env)
+		if groupErr == nil {
 			return
 		}
+		chunks = append(chunks, fmt.Sprintf("(%v)", groupErr))
 	}
+	err = fmt.Errorf("any failed: %s", strings.Join(chunks, " or "))
 	return
 }
 
+// GetEnv returns environment values referenced by constraint
+func (c Constraint) GetEnv(env map[string]string) (res map[string]string) {
+	res = map[string]string{}
+	for left, right := range c {
+		for _, field := range fields(left, right) {
+			field = strings.SplitN(field, "|", 2)[0]
+			if value, ok := env[field]; ok {
+				res[field] = value
+			}
+		}
+	}
+	return
+}
+
+// ConstraintPair describes one constraint pair evaluated against environment
+type ConstraintPair struct {
+	Left              string
+	Right             string
+	InterpolatedLeft  string
+	InterpolatedRight string
+	Passed            bool
+}
+
+// ConstraintFailure describes one failed constraint pair
+type ConstraintFailure struct {
+	Left              string
+	Right             string
+	InterpolatedLeft  string
+	InterpolatedRight string
+}
+
+func (f ConstraintFailure) String() string {
+	return fmt.Sprintf(`constraint failed: "%s":"%s" ("%s":"%s")`, f.InterpolatedLeft, f.InterpolatedRight, f.Left, f.Right)
+}
+
+// ConstraintError holds all failed constraint pairs
+type ConstraintError struct {
+	Failures []ConstraintFailure
+}
+
+func (e *ConstraintError) Error() string {
+	var chunks []string
+	for _, failure := range e.Failures {
+		chunks = append(chunks, failure.String())
+	}
+	return strings.Join(chunks, "; ")
+}
+
 func check(left, right string) (res bool) {
 	// try to get op
 	split := strings.SplitN(right, " ", 2)
@@ -93,10 +325,16 @@ func check(left, right string) (res bool) {
 		var cmpRes int
 		leftN, leftErr := strconv.ParseFloat(left, 64)
 		rightN, rightErr := strconv.ParseFloat(right, 64)
-		if leftErr == nil && rightErr == nil {
+		leftV, leftVerErr := parseSemver(left)
+		rightV, rightVerErr := parseSemver(right)
+		switch {
+		case (isVersion(left) || isVersion(right)) && leftVerErr == nil && rightVerErr == nil:
+			// versions like "v1.10" or "1.10.0" are not numbers
+			cmpRes = leftV.compare(rightV)
+		case leftErr == nil && rightErr == nil:
 			// ok, we have numbers
 			cmpRes = big.NewFloat(leftN).Cmp(big.NewFloat(rightN))
-		} else {
+		default:
 			cmpRes = strings.Compare(left, right)
 		}
 		switch op {
@@ -109,6 +347,20 @@ func check(left, right string) (res bool) {
 		case opGreaterOrEqual:
 			res = cmpRes >= 0
 		}
+	case opMatch:
+		re, err := regexp.Compile(split[1])
+		res = err == nil && re.MatchString(left)
+	case opInCIDR:
+		ip := net.ParseIP(strings.TrimSpace(left))
+		if ip == nil {
+			return
+		}
+		for _, chunk := range strings.Split(split[1], ",") {
+			if _, network, err := net.ParseCIDR(strings.TrimSpace(chunk)); err == nil && network.Contains(ip) {
+				res = true
+				return
+			}
+		}
 	case opIn, opNotIn:
 		leftSplit := strings.Split(left, ",")
 		rightSplit := strings.Split(split[1], ",")
@@ -134,3 +386,9 @@ func check(left, right string) (res bool) {
 	}
 	return
 }
+
+// isVersion returns true if value has "v" prefix or more than one dot
+func isVersion(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "v") || strings.Count(value, ".") > 1
+}
@@ -121,12 +121,142 @@ func TestConstraint_Check(t *testing.T) {
 			"meta.num": "3",
 		}))
 	})
+	t.Run("semver ok", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.version}": ">= 0.9.0",
+		}
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.version": "v0.10.0",
+		}))
+	})
+	t.Run("semver minor", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.version}": ">= 1.9",
+		}
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.version": "1.10.0",
+		}))
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.version": "v1.10",
+		}))
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.version": "1.10",
+		}), "values without prefix and patch are numbers")
+	})
+	t.Run("semver prerelease", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.version}": ">= 1.0.0",
+		}
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.version": "1.0.0-rc.1",
+		}))
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.version": "1.0.0+build.5",
+		}))
+	})
+	t.Run("match ok", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.host}": "=~ ^web-[0-9]+$",
+		}
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.host": "web-12",
+		}))
+	})
+	t.Run("match fail", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.host}": "=~ ^web-[0-9]+$",
+		}
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.host": "db-1",
+		}))
+	})
+	t.Run("match bad regexp", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.host}": "=~ web-(",
+		}
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.host": "web-(",
+		}))
+	})
+	t.Run("in_cidr ok", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.ip}": "in_cidr 10.0.0.0/8, 192.168.1.0/24",
+		}
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.ip": "192.168.1.10",
+		}))
+	})
+	t.Run("in_cidr fail", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.ip}": "in_cidr 10.0.0.0/8",
+		}
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.ip": "192.168.1.10",
+		}))
+		assert.Error(t, constraint.Check(map[string]string{
+			"meta.ip": "not-an-ip",
+		}))
+	})
 	t.Run("empty", func(t *testing.T) {
 		constraint := manifest.Constraint{}
 		assert.NoError(t, constraint.Check(map[string]string{
 			"meta.num": "3",
 		}))
 	})
+	t.Run("all failures", func(t *testing.T) {
+		constraint := manifest.Constraint{
+			"${meta.a}": "1",
+			"${meta.b}": "2",
+			"${meta.c}": "3",
+		}
+		err := constraint.Check(map[string]string{
+			"meta.a": "2",
+			"meta.b": "2",
+			"meta.c": "1",
+		})
+		assert.EqualError(t, err, `constraint failed: "2":"1" ("${meta.a}":"1"); constraint failed: "1":"3" ("${meta.c}":"3")`)
+		assert.Equal(t, &manifest.ConstraintError{
+			Failures: []manifest.ConstraintFailure{
+				{Left: "${meta.a}", Right: "1", InterpolatedLeft: "2", InterpolatedRight: "1"},
+				{Left: "${meta.c}", Right: "3", InterpolatedLeft: "1", InterpolatedRight: "3"},
+			},
+		}, err)
+	})
+}
+
+func TestConstraint_GetEnv(t *testing.T) {
+	constraint := manifest.Constraint{
+		"${meta.a}":           "1",
+		"${meta.b|default}":   "~ ${meta.c}",
+		"${meta.nonexistent}": "true",
+	}
+	assert.Equal(t, map[string]string{
+		"meta.a": "1",
+		"meta.b": "2",
+		"meta.c": "1,2",
+	}, constraint.GetEnv(map[string]string{
+		"meta.a": "1",
+		"meta.b": "2",
+		"meta.c": "1,2",
+		"meta.d": "4",
+	}))
+}
+
+func TestConstraint_Explain(t *testing.T) {
+	constraint := manifest.Constraint{
+		"${meta.a}": "1",
+		"${meta.b}": "2",
+		"${meta.c}": "!= 1",
+	}
+	assert.Equal(t, []manifest.ConstraintPair{
+		{Left: "${meta.a}", Right: "1", InterpolatedLeft: "1", InterpolatedRight: "1", Passed: true},
+		{Left: "${meta.b}", Right: "2", InterpolatedLeft: "1", InterpolatedRight: "2", Passed: false},
+		{Left: "${meta.c}", Right: "!= 1", InterpolatedLeft: "1", InterpolatedRight: "!= 1", Passed: false},
+	}, constraint.Explain(map[string]string{
+		"meta.a": "1",
+		"meta.b": "1",
+		"meta.c": "1",
+	}))
 }
 
 func TestConstraint_FilterOut(t *testing.T) {
@@ -150,3 +280,65 @@ func TestConstraint_FilterOut(t *testing.T) {
 		})
 	})
 }
+
+func TestConstraint_Any(t *testing.T) {
+	constraint := manifest.Constraint{
+		"${meta.a}": "1",
+	}.Merge(manifest.NewAnyConstraint(
+		manifest.Constraint{
+			"${meta.rack}": "rack-1",
+		},
+		manifest.Constraint{
+			"${meta.rack}":                    "rack-2",
+			"${resource.port.8080.allocated}": "true",
+		},
+	))
+	t.Run("check first", func(t *testing.T) {
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.a":    "1",
+			"meta.rack": "rack-1",
+		}))
+	})
+	t.Run("check second", func(t *testing.T) {
+		assert.NoError(t, constraint.Check(map[string]string{
+			"meta.a":                       "1",
+			"meta.rack":                    "rack-2",
+			"resource.port.8080.allocated": "true",
+		}))
+	})
+	t.Run("check fail", func(t *testing.T) {
+		err := constraint.Check(map[string]string{
+			"meta.a":    "1",
+			"meta.rack": "rack-2",
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `any failed: (constraint failed: "rack-2":"rack-1"`)
+	})
+	t.Run("get env", func(t *testing.T) {
+		assert.Equal(t, map[string]string{
+			"meta.a":    "1",
+			"meta.rack": "rack-3",
+		}, constraint.GetEnv(map[string]string{
+			"meta.a":    "1",
+			"meta.rack": "rack-3",
+			"meta.b":    "2",
+		}))
+	})
+	t.Run("filter out", func(t *testing.T) {
+		assert.Equal(t, manifest.Constraint{
+			"${meta.a}": "1",
+		}, constraint.FilterOut("resource."))
+		assert.Equal(t, constraint, constraint.FilterOut("none."))
+	})
+	t.Run("same groups", func(t *testing.T) {
+		assert.Equal(t, constraint, constraint.Merge(manifest.NewAnyConstraint(
+			manifest.Constraint{
+				"${meta.rack}": "rack-1",
+			},
+			manifest.Constraint{
+				"${meta.rack}":                    "rack-2",
+				"${resource.port.8080.allocated}": "true",
+			},
+		)))
+	})
+}
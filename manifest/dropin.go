@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"strings"
+)
+
+type DropIns []DropIn
+
+func (d *DropIns) Empty() ObjectParser {
+	return &DropIn{
+		Transition: Transition{
+			Create:  "try-restart",
+			Update:  "try-restart",
+			Destroy: "try-restart",
+		},
+	}
+}
+
+func (d *DropIns) Append(v interface{}) (err error) {
+	v1 := v.(*DropIn)
+	*d = append(*d, *v1)
+	return
+}
+
+// DropIn is systemd drop-in for unit which is not managed by pod. Drop-in
+// transitions are executed on parent unit.
+type DropIn struct {
+	Transition `json:",omitempty" hcl:",squash"`
+	Unit       string `hcl:"-"` // Parent unit name
+	Name       string `hcl:"-"` // Drop-in file name
+	Source     string
+}
+
+func (d DropIn) GetID(parent ...string) string {
+	return strings.Join(append(parent, d.Unit, d.Name), ".")
+}
+
+func (d *DropIn) ParseAST(raw *ast.ObjectItem) (err error) {
+	if len(raw.Keys) != 2 {
+		err = fmt.Errorf(`dropin should be "unit" "name"`)
+		return
+	}
+	d.Unit = raw.Keys[0].Token.Value().(string)
+	d.Name = raw.Keys[1].Token.Value().(string)
+	if err = hcl.DecodeObject(d, raw); err != nil {
+		return
+	}
+	d.Source = Heredoc(d.Source)
+	err = checkInterpolation(fmt.Sprintf(`dropin "%s" "%s"`, d.Unit, d.Name), d.Unit, d.Name, d.Source)
+	return
+}
@@ -0,0 +1,40 @@
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDropIn_ParseAST(t *testing.T) {
+	var buffers lib.StaticBuffers
+	require.NoError(t, buffers.ReadFiles("testdata/TestDropIn_ParseAST.hcl"))
+	var pods manifest.PodSlice
+	require.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+	require.Len(t, pods, 1)
+	assert.Equal(t, manifest.DropIns{
+		{
+			Transition: manifest.Transition{
+				Create:  "try-restart",
+				Update:  "try-restart",
+				Destroy: "try-restart",
+			},
+			Unit:   "docker.service",
+			Name:   "10-soil.conf",
+			Source: "[Service]\nEnvironment=A=1\n",
+		},
+		{
+			Transition: manifest.Transition{
+				Create: "try-restart",
+				Update: "reload",
+			},
+			Unit:   "nginx.service",
+			Name:   "10-soil.conf",
+			Source: "[Service]",
+		},
+	}, pods[0].DropIns)
+}
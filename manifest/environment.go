@@ -3,13 +3,13 @@ package manifest
 import (
 	"encoding/json"
 	"regexp"
-	"strings"
 )
 
 const hiddenPrefix = "__"
 
 var (
-	envRe = regexp.MustCompile(`\$\{[a-zA-Z0-9_/\-.|]+}`)
+	// "${a.b}", "${a.b|default}" or "${fn(a.b, "literal", 1)}"
+	envRe = regexp.MustCompile(`\$\{(?:[a-zA-Z0-9_/\-.|]+|[a-zA-Z0-9_]+\((?:[^"}]|"(?:[^"\\]|\\.)*")*\))}`)
 )
 
 // FlatMap
@@ -52,54 +52,41 @@ func (e FlatMap) WithJSON(key string) (j FlatMap) {
 // Interpolate source
 func (e FlatMap) Interpolate(source string) (res string) {
 	res = envRe.ReplaceAllStringFunc(source, func(arg string) string {
-		var hasDefaultValue bool
-		var defaultValue string
-		stripped := arg[2 : len(arg)-1]
-		split := strings.SplitN(stripped, "|", 2)
-		if len(split) == 2 {
-			hasDefaultValue = true
-			defaultValue = split[1]
-			stripped = split[0]
-		}
-		if value, ok := e[stripped]; ok {
-			return value
-		}
-		if hasDefaultValue {
-			return defaultValue
-		}
-		return arg
+		return interpolate(arg, func(key string) (value string, ok bool) {
+			value, ok = e[key]
+			return
+		})
 	})
 	return
 }
 
+// ExtractEnv returns all variables referenced in given source. Plain
+// references are returned with default values.
 func ExtractEnv(v string) (res []string) {
 	res1 := envRe.FindAllString(v, -1)
 	for _, r := range res1 {
-		res = append(res, r[2:len(r)-1])
+		stripped := r[2 : len(r)-1]
+		if !isCall(stripped) {
+			res = append(res, stripped)
+			continue
+		}
+		if node, err := parseExpr(stripped); err == nil {
+			res = append(res, node.refs()...)
+		}
 	}
 	return
 }
 
 func Interpolate(v string, env ...map[string]string) (res string) {
 	res = envRe.ReplaceAllStringFunc(v, func(arg string) string {
-		var hasDefaultValue bool
-		var defaultValue string
-		stripped := arg[2 : len(arg)-1]
-		split := strings.SplitN(stripped, "|", 2)
-		if len(split) == 2 {
-			hasDefaultValue = true
-			defaultValue = split[1]
-			stripped = split[0]
-		}
-		for _, envChunk := range env {
-			if value, ok := envChunk[stripped]; ok {
-				return value
+		return interpolate(arg, func(key string) (value string, ok bool) {
+			for _, envChunk := range env {
+				if value, ok = envChunk[key]; ok {
+					return
+				}
 			}
-		}
-		if hasDefaultValue {
-			return defaultValue
-		}
-		return arg
+			return
+		})
 	})
 	return
 }
@@ -5,6 +5,7 @@ package manifest_test
 import (
 	"github.com/akaspin/soil/manifest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"regexp"
 	"testing"
 )
@@ -54,3 +55,54 @@ func TestInterpolate(t *testing.T) {
 		}))
 	})
 }
+
+func TestInterpolate_Functions(t *testing.T) {
+	env := map[string]string{
+		"meta.rack":   "Rack-1",
+		"meta.hosts":  "a,b,c",
+		"meta.port":   "8080",
+		"meta.values": `{"value":"9000","nested":{"list":[1,"two"]}}`,
+	}
+	cases := map[string]string{
+		`${upper(meta.rack)}`:                            "RACK-1",
+		`${lower(meta.rack)}`:                            "rack-1",
+		`${replace(meta.rack, "-", "_")}`:                "Rack_1",
+		`${split(meta.hosts, ",")}`:                      `["a","b","c"]`,
+		`${join(split(meta.hosts, ","), ":8080,")}:8080`: "a:8080,b:8080,c:8080",
+		`${base64(meta.rack)}`:                           "UmFjay0x",
+		`${sha256("")}`:                                  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		`${json(meta.values, "value")}`:                  "9000",
+		`${json(meta.values, "nested.list.1")}`:          "two",
+		`${json(meta.values, "nested.list")}`:            `[1,"two"]`,
+		`${add(meta.port, 100)}`:                         "8180",
+		`${sub(meta.port, 80)}`:                          "8000",
+		`${mul(2, div(meta.port, 3))}`:                   "5386",
+		`${mod(meta.port, 7)}`:                           "2",
+		`${upper(meta.missing|default)}`:                 "DEFAULT",
+		`${upper("a}b")}`:                                "A}B",
+		`port=${add(meta.port, 1)} rack=${meta.rack}`:    "port=8081 rack=Rack-1",
+		`${upper(meta.missing)}`:                         `${upper(meta.missing)}`,
+		`${div(meta.port, 0)}`:                           `${div(meta.port, 0)}`,
+		`${add(meta.rack, 1)}`:                           `${add(meta.rack, 1)}`,
+		`${json(meta.values, "missing")}`:                `${json(meta.values, "missing")}`,
+	}
+	for source, expect := range cases {
+		assert.Equal(t, expect, manifest.Interpolate(source, env), source)
+		assert.Equal(t, expect, manifest.FlatMap(env).Interpolate(source), source)
+	}
+}
+
+func TestCheckInterpolation(t *testing.T) {
+	assert.Empty(t, manifest.CheckInterpolation(`${meta.a} ${upper(meta.a)} ${join(split(meta.a, ","), " ")}`))
+	errs := manifest.CheckInterpolation(`${nope(meta.a)} ${upper(meta.a, 1)} ${upper(meta.a} ${upper("a)}`)
+	require.Len(t, errs, 4)
+	assert.EqualError(t, errs[0], `${nope(meta.a)}: unknown function "nope"`)
+	assert.EqualError(t, errs[1], `${upper(meta.a, 1)}: function "upper" requires 1 arguments, got 2`)
+	assert.EqualError(t, errs[2], `${upper(...: malformed function call`)
+	assert.EqualError(t, errs[3], `${upper(...: malformed function call`)
+}
+
+func TestExtractEnv_Functions(t *testing.T) {
+	assert.Equal(t, []string{"meta.a", "meta.b|1", "meta.c"},
+		manifest.ExtractEnv(`${add(meta.a, meta.b|1)} ${meta.c} ${nope(meta.d)}`))
+}
@@ -0,0 +1,415 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	errUnresolved = errors.New("unresolved")
+	callStartRe   = regexp.MustCompile(`\$\{[a-zA-Z0-9_]+\(`)
+
+	// interpolation functions available as ${name(arg, ...)}
+	interpolationFuncs = map[string]interpolationFunc{
+		"upper": {1, func(args []string) (string, error) {
+			return strings.ToUpper(args[0]), nil
+		}},
+		"lower": {1, func(args []string) (string, error) {
+			return strings.ToLower(args[0]), nil
+		}},
+		"replace": {3, func(args []string) (string, error) {
+			return strings.Replace(args[0], args[1], args[2], -1), nil
+		}},
+		"split": {2, funcSplit},
+		"join":  {2, funcJoin},
+		"base64": {1, func(args []string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(args[0])), nil
+		}},
+		"sha256": {1, func(args []string) (string, error) {
+			sum := sha256.Sum256([]byte(args[0]))
+			return hex.EncodeToString(sum[:]), nil
+		}},
+		"json": {2, funcJSON},
+		"add": {2, arithmetic(func(a, b int64) (int64, error) {
+			return a + b, nil
+		})},
+		"sub": {2, arithmetic(func(a, b int64) (int64, error) {
+			return a - b, nil
+		})},
+		"mul": {2, arithmetic(func(a, b int64) (int64, error) {
+			return a * b, nil
+		})},
+		"div": {2, arithmetic(func(a, b int64) (res int64, err error) {
+			if b == 0 {
+				err = errors.New("division by zero")
+				return
+			}
+			res = a / b
+			return
+		})},
+		"mod": {2, arithmetic(func(a, b int64) (res int64, err error) {
+			if b == 0 {
+				err = errors.New("division by zero")
+				return
+			}
+			res = a % b
+			return
+		})},
+	}
+)
+
+type interpolationFunc struct {
+	args int
+	fn   func(args []string) (string, error)
+}
+
+// CheckInterpolation returns errors for all malformed function calls in
+// given source
+func CheckInterpolation(source string) (res []error) {
+	for _, loc := range callStartRe.FindAllStringIndex(source, -1) {
+		match := envRe.FindStringIndex(source[loc[0]:])
+		if match == nil || match[0] != 0 {
+			res = append(res, fmt.Errorf(`%s...: malformed function call`, source[loc[0]:loc[1]]))
+			continue
+		}
+		arg := source[loc[0] : loc[0]+match[1]]
+		if _, err := parseExpr(arg[2 : len(arg)-1]); err != nil {
+			res = append(res, fmt.Errorf(`%s: %v`, arg, err))
+		}
+	}
+	return
+}
+
+// checkInterpolation returns first interpolation error in given values
+func checkInterpolation(subject string, values ...string) (err error) {
+	for _, value := range values {
+		if errs := CheckInterpolation(value); len(errs) > 0 {
+			err = fmt.Errorf(`%s: %v`, subject, errs[0])
+			return
+		}
+	}
+	return
+}
+
+// interpolate evaluates expression within "${...}". Returns source if
+// expression can not be evaluated.
+func interpolate(source string, lookup func(string) (string, bool)) (res string) {
+	stripped := source[2 : len(source)-1]
+	if !isCall(stripped) {
+		// plain reference with optional default value
+		split := strings.SplitN(stripped, "|", 2)
+		var ok bool
+		if res, ok = lookup(split[0]); ok {
+			return
+		}
+		if len(split) == 2 {
+			res = split[1]
+			return
+		}
+		res = source
+		return
+	}
+	node, err := parseExpr(stripped)
+	if err != nil {
+		res = source
+		return
+	}
+	if res, err = node.eval(lookup); err != nil {
+		res = source
+	}
+	return
+}
+
+// isCall returns true if expression within "${...}" is function call
+func isCall(expr string) bool {
+	return strings.Contains(expr, "(")
+}
+
+type exprNode interface {
+	eval(lookup func(string) (string, bool)) (string, error)
+	refs() []string
+}
+
+// variable reference with optional default value
+type refNode struct {
+	name         string
+	defaultValue *string
+}
+
+func (n refNode) eval(lookup func(string) (string, bool)) (res string, err error) {
+	var ok bool
+	if res, ok = lookup(n.name); ok {
+		return
+	}
+	if n.defaultValue != nil {
+		res = *n.defaultValue
+		return
+	}
+	err = errUnresolved
+	return
+}
+
+func (n refNode) refs() []string {
+	if n.defaultValue != nil {
+		return []string{n.name + "|" + *n.defaultValue}
+	}
+	return []string{n.name}
+}
+
+type literalNode string
+
+func (n literalNode) eval(lookup func(string) (string, bool)) (string, error) {
+	return string(n), nil
+}
+
+func (n literalNode) refs() []string {
+	return nil
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n callNode) eval(lookup func(string) (string, bool)) (res string, err error) {
+	var args []string
+	for _, arg := range n.args {
+		var value string
+		if value, err = arg.eval(lookup); err != nil {
+			return
+		}
+		args = append(args, value)
+	}
+	res, err = interpolationFuncs[n.name].fn(args)
+	return
+}
+
+func (n callNode) refs() (res []string) {
+	for _, arg := range n.args {
+		res = append(res, arg.refs()...)
+	}
+	return
+}
+
+// parseExpr parses expression within "${...}"
+func parseExpr(source string) (node exprNode, err error) {
+	p := &exprParser{source: source}
+	if node, err = p.parse(); err != nil {
+		return
+	}
+	if p.pos < len(p.source) {
+		err = fmt.Errorf(`unexpected "%s" at %d`, p.source[p.pos:], p.pos)
+	}
+	return
+}
+
+type exprParser struct {
+	source string
+	pos    int
+}
+
+func (p *exprParser) parse() (node exprNode, err error) {
+	p.skipSpaces()
+	if p.pos < len(p.source) && p.source[p.pos] == '"' {
+		node, err = p.parseString()
+		return
+	}
+	start := p.pos
+	for p.pos < len(p.source) && isIdentChar(p.source[p.pos]) {
+		p.pos++
+	}
+	token := p.source[start:p.pos]
+	if token == "" {
+		err = fmt.Errorf(`unexpected end of expression at %d`, p.pos)
+		if p.pos < len(p.source) {
+			err = fmt.Errorf(`unexpected "%c" at %d`, p.source[p.pos], p.pos)
+		}
+		return
+	}
+	if p.pos < len(p.source) && p.source[p.pos] == '(' {
+		node, err = p.parseCall(token)
+		return
+	}
+	if _, numErr := strconv.ParseFloat(token, 64); numErr == nil {
+		node = literalNode(token)
+		return
+	}
+	ref := refNode{name: token}
+	if p.pos < len(p.source) && p.source[p.pos] == '|' {
+		p.pos++
+		start = p.pos
+		for p.pos < len(p.source) && isIdentChar(p.source[p.pos]) {
+			p.pos++
+		}
+		value := p.source[start:p.pos]
+		ref.defaultValue = &value
+	}
+	node = ref
+	return
+}
+
+func (p *exprParser) parseCall(name string) (node exprNode, err error) {
+	fn, ok := interpolationFuncs[name]
+	if !ok {
+		err = fmt.Errorf(`unknown function "%s"`, name)
+		return
+	}
+	call := callNode{name: name}
+	p.pos++ // "("
+	p.skipSpaces()
+	if p.pos < len(p.source) && p.source[p.pos] == ')' {
+		p.pos++
+	} else {
+		for {
+			var arg exprNode
+			if arg, err = p.parse(); err != nil {
+				return
+			}
+			call.args = append(call.args, arg)
+			p.skipSpaces()
+			if p.pos >= len(p.source) {
+				err = fmt.Errorf(`function "%s": missing ")"`, name)
+				return
+			}
+			if p.source[p.pos] == ')' {
+				p.pos++
+				break
+			}
+			if p.source[p.pos] != ',' {
+				err = fmt.Errorf(`function "%s": unexpected "%c" at %d`, name, p.source[p.pos], p.pos)
+				return
+			}
+			p.pos++
+		}
+	}
+	if len(call.args) != fn.args {
+		err = fmt.Errorf(`function "%s" requires %d arguments, got %d`, name, fn.args, len(call.args))
+		return
+	}
+	p.skipSpaces()
+	node = call
+	return
+}
+
+func (p *exprParser) parseString() (node exprNode, err error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.source) {
+		switch p.source[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			var value string
+			if value, err = strconv.Unquote(p.source[start:p.pos]); err != nil {
+				return
+			}
+			node = literalNode(value)
+			p.skipSpaces()
+			return
+		}
+		p.pos++
+	}
+	err = fmt.Errorf(`unterminated string at %d`, start)
+	return
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '/' || c == '-' || c == '.'
+}
+
+// split returns JSON array of chunks
+func funcSplit(args []string) (res string, err error) {
+	buf, err := json.Marshal(strings.Split(args[0], args[1]))
+	res = string(buf)
+	return
+}
+
+// join joins JSON array with separator
+func funcJoin(args []string) (res string, err error) {
+	var chunks []interface{}
+	if err = json.Unmarshal([]byte(args[0]), &chunks); err != nil {
+		return
+	}
+	var values []string
+	for _, chunk := range chunks {
+		values = append(values, jsonString(chunk))
+	}
+	res = strings.Join(values, args[1])
+	return
+}
+
+// json returns value from JSON document by dot-separated path
+func funcJSON(args []string) (res string, err error) {
+	var value interface{}
+	if err = json.Unmarshal([]byte(args[0]), &value); err != nil {
+		return
+	}
+	if args[1] != "" {
+		for _, key := range strings.Split(args[1], ".") {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if value, ok = v[key]; !ok {
+					err = fmt.Errorf(`key "%s" not found`, key)
+					return
+				}
+			case []interface{}:
+				var idx int
+				if idx, err = strconv.Atoi(key); err != nil || idx < 0 || idx >= len(v) {
+					err = fmt.Errorf(`bad index "%s"`, key)
+					return
+				}
+				value = v[idx]
+			default:
+				err = fmt.Errorf(`key "%s" not found`, key)
+				return
+			}
+		}
+	}
+	res = jsonString(value)
+	return
+}
+
+// jsonString returns strings as is and JSON for other values
+func jsonString(value interface{}) (res string) {
+	if s, ok := value.(string); ok {
+		res = s
+		return
+	}
+	buf, _ := json.Marshal(value)
+	res = string(buf)
+	return
+}
+
+func arithmetic(op func(a, b int64) (int64, error)) func(args []string) (string, error) {
+	return func(args []string) (res string, err error) {
+		var a, b, v int64
+		if a, err = strconv.ParseInt(strings.TrimSpace(args[0]), 10, 64); err != nil {
+			return
+		}
+		if b, err = strconv.ParseInt(strings.TrimSpace(args[1]), 10, 64); err != nil {
+			return
+		}
+		if v, err = op(a, b); err != nil {
+			return
+		}
+		res = strconv.FormatInt(v, 10)
+		return
+	}
+}
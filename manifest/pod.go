@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/akaspin/soil/lib"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
@@ -15,6 +16,7 @@ const (
 	defaultPodTarget = "multi-user.target"
 	PrivateNamespace = "private"
 	PublicNamespace  = "public"
+	counterPrefix    = "counter"
 )
 
 type PodSlice []*Pod
@@ -54,9 +56,14 @@ type Pod struct {
 	Name       string
 	Runtime    bool
 	Target     string
+	Count      int        `json:",omitempty"`                    // Cluster-wide slots (public namespace only)
+	MaxPerNode int        `json:",omitempty" hcl:"max_per_node"` // Maximum slots claimed by one node
+	Rollback   bool       `json:",omitempty"`                    // Rollback to previous allocation on failure
+	DependsOn  []string   `json:",omitempty" hcl:"depends_on"`   // Pods which should be deployed before
 	Constraint Constraint `json:",omitempty"`
 	Units      Units      `json:",omitempty" hcl:"-"`
 	Blobs      Blobs      `json:",omitempty" hcl:"-"`
+	DropIns    DropIns    `json:",omitempty" hcl:"-"`
 	Resources  Resources  `json:",omitempty" hcl:"-"`
 	Providers  Providers  `json:",omitempty" hcl:"-"`
 }
@@ -69,13 +76,38 @@ func (p *Pod) ParseAST(raw *ast.ObjectItem) (err error) {
 	err = &multierror.Error{}
 	list := raw.Val.(*ast.ObjectType).List
 
-	if err = multierror.Append(err, hcl.DecodeObject(p, raw)); err.(*multierror.Error).ErrorOrNil() != nil {
+	// constraints are decoded separately because of "any" blocks
+	rest := &ast.ObjectList{}
+	var constraints []*ast.ObjectItem
+	for _, item := range list.Items {
+		if len(item.Keys) > 0 && item.Keys[0].Token.Value() == "constraint" {
+			constraints = append(constraints, item)
+			continue
+		}
+		rest.Add(item)
+	}
+	if err = multierror.Append(err, hcl.DecodeObject(p, &ast.ObjectItem{
+		Keys: raw.Keys,
+		Val:  &ast.ObjectType{List: rest},
+	})); err.(*multierror.Error).ErrorOrNil() != nil {
 		return
 	}
 	p.Name = raw.Keys[0].Token.Value().(string)
+	for _, item := range constraints {
+		constraint, parseErr := ParseConstraintAST(item.Val)
+		if parseErr != nil {
+			err = multierror.Append(err, fmt.Errorf(`pod "%s": constraint: %v`, p.Name, parseErr))
+			continue
+		}
+		p.Constraint = p.Constraint.Merge(constraint)
+	}
+	for left, right := range p.Constraint {
+		err = multierror.Append(err, checkInterpolation(fmt.Sprintf(`pod "%s": constraint`, p.Name), left, right))
+	}
 
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "unit", &p.Units))
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "blob", &p.Blobs))
+	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "dropin", &p.DropIns))
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "resource", &p.Resources))
 	err = multierror.Append(err, ParseList([]*ast.ObjectList{list}, "provider", &p.Providers))
 
@@ -83,6 +115,24 @@ func (p *Pod) ParseAST(raw *ast.ObjectItem) (err error) {
 	return
 }
 
+// IsCounted returns true if pod should be placed in cluster by counter
+func (p *Pod) IsCounted() (ok bool) {
+	ok = p.Namespace == PublicNamespace && p.Count > 0
+	return
+}
+
+// GetCounterConstraint returns "${counter.<pod>.allocated}":"true" for counted
+// pods. Elsewhere returns <nil>.
+func (p *Pod) GetCounterConstraint() (res Constraint) {
+	if !p.IsCounted() {
+		return
+	}
+	res = Constraint{
+		fmt.Sprintf("${%s.%s.allocated}", counterPrefix, p.Name): "true",
+	}
+	return
+}
+
 // Get Pod checksum
 func (p *Pod) Mark() (res uint64) {
 	buf, _ := json.Marshal(p)
@@ -104,3 +154,29 @@ func IsEqual(left, right *Pod) (ok bool) {
 	}
 	return
 }
+
+// DependencyCycle returns path from pod with given name back to itself
+// through dependencies or nil if there is no cycle. Dependencies of each pod
+// are returned by dependsOn.
+func DependencyCycle(name string, dependsOn func(name string) []string) (res []string) {
+	visited := map[string]struct{}{}
+	var walk func(path []string) bool
+	walk = func(path []string) bool {
+		for _, dependency := range dependsOn(path[len(path)-1]) {
+			if dependency == name {
+				res = append(append([]string{}, path...), name)
+				return true
+			}
+			if _, ok := visited[dependency]; ok {
+				continue
+			}
+			visited[dependency] = struct{}{}
+			if walk(append(path, dependency)) {
+				return true
+			}
+		}
+		return false
+	}
+	walk([]string{name})
+	return
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/akaspin/soil/lib"
 	"github.com/akaspin/soil/manifest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -179,3 +181,93 @@ func TestManifest_JSON(t *testing.T) {
 	data1, err := json.Marshal(pod)
 	assert.Equal(t, string(data), string(data1))
 }
+
+func TestPod_GetCounterConstraint(t *testing.T) {
+	var buffers lib.StaticBuffers
+	assert.NoError(t, buffers.ReadFiles("testdata/TestPod_GetCounterConstraint.hcl"))
+	t.Run(`private`, func(t *testing.T) {
+		var pods manifest.PodSlice
+		assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+		assert.Equal(t, 3, pods[0].Count)
+		assert.Equal(t, 2, pods[0].MaxPerNode)
+		assert.Nil(t, pods[0].GetCounterConstraint())
+		assert.Nil(t, pods[1].GetCounterConstraint())
+	})
+	t.Run(`public`, func(t *testing.T) {
+		var pods manifest.PodSlice
+		assert.NoError(t, pods.Unmarshal(manifest.PublicNamespace, buffers.GetReaders()...))
+		assert.Equal(t, manifest.Constraint{
+			"${counter.counted.allocated}": "true",
+		}, pods[0].GetCounterConstraint())
+		assert.Nil(t, pods[1].GetCounterConstraint())
+	})
+}
+
+func TestPods_Unmarshal_InterpolationFunctions(t *testing.T) {
+	t.Run(`ok`, func(t *testing.T) {
+		var pods manifest.PodSlice
+		assert.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(`
+pod "1" {
+  constraint {
+    "${lower(meta.rack)}" = "rack-1"
+  }
+  unit "1.service" {
+    source = "${add(resource.port.1.8080.value, 1)}"
+  }
+}
+`)))
+	})
+	for name, src := range map[string]string{
+		`constraint`: `pod "1" { constraint { "${nope(meta.rack)}" = "1" } }`,
+		`unit`:       `pod "1" { unit "1.service" { source = "${upper(meta.a, 1)}" } }`,
+		`health`:     `pod "1" { unit "1.service" { health { tcp = "${nope(meta.a)}" } } }`,
+		`blob`:       `pod "1" { blob "/etc/1" { source = "${nope(meta.a)}" } }`,
+		`dropin`:     `pod "1" { dropin "a.service" "1.conf" { source = "${nope(meta.a)}" } }`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var pods manifest.PodSlice
+			err := pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(src))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPods_Unmarshal_AnyConstraint(t *testing.T) {
+	var pods manifest.PodSlice
+	require.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, strings.NewReader(`
+pod "1" {
+  constraint {
+    "${meta.a}" = "1"
+    any {
+      "${meta.rack}" = "rack-1"
+      group {
+        "${meta.rack}" = "rack-2"
+        "${meta.version}" = ">= 1.2.0"
+      }
+    }
+  }
+}
+`)))
+	require.Len(t, pods, 1)
+	assert.Equal(t, manifest.Constraint{
+		"${meta.a}": "1",
+	}.Merge(manifest.NewAnyConstraint(
+		manifest.Constraint{
+			"${meta.rack}": "rack-1",
+		},
+		manifest.Constraint{
+			"${meta.rack}":    "rack-2",
+			"${meta.version}": ">= 1.2.0",
+		},
+	)), pods[0].Constraint)
+	assert.NoError(t, pods[0].Constraint.Check(map[string]string{
+		"meta.a":       "1",
+		"meta.rack":    "rack-2",
+		"meta.version": "1.10.0",
+	}))
+	assert.Error(t, pods[0].Constraint.Check(map[string]string{
+		"meta.a":       "1",
+		"meta.rack":    "rack-2",
+		"meta.version": "1.1.9",
+	}))
+}
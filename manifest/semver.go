@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is semantic version in form [v]MAJOR[.MINOR[.PATCH]][-PRERELEASE][+BUILD].
+// Omitted MINOR and PATCH are zero.
+type semver struct {
+	numbers    [3]uint64
+	prerelease []string
+}
+
+func parseSemver(value string) (res semver, err error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if idx := strings.IndexByte(value, '+'); idx != -1 {
+		value = value[:idx]
+	}
+	if idx := strings.IndexByte(value, '-'); idx != -1 {
+		if value[idx+1:] == "" {
+			err = fmt.Errorf("bad version %s", value)
+			return
+		}
+		res.prerelease = strings.Split(value[idx+1:], ".")
+		value = value[:idx]
+	}
+	split := strings.Split(value, ".")
+	if len(split) > 3 {
+		err = fmt.Errorf("bad version %s", value)
+		return
+	}
+	for i, chunk := range split {
+		if res.numbers[i], err = strconv.ParseUint(chunk, 10, 64); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// compare returns -1, 0 or 1 by semver precedence rules
+func (v semver) compare(other semver) (res int) {
+	for i := range v.numbers {
+		if res = compareUint(v.numbers[i], other.numbers[i]); res != 0 {
+			return
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return
+	case len(v.prerelease) == 0:
+		res = 1
+		return
+	case len(other.prerelease) == 0:
+		res = -1
+		return
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		left, leftErr := strconv.ParseUint(v.prerelease[i], 10, 64)
+		right, rightErr := strconv.ParseUint(other.prerelease[i], 10, 64)
+		switch {
+		case leftErr == nil && rightErr == nil:
+			res = compareUint(left, right)
+		case leftErr == nil:
+			res = -1
+		case rightErr == nil:
+			res = 1
+		default:
+			res = strings.Compare(v.prerelease[i], other.prerelease[i])
+		}
+		if res != 0 {
+			return
+		}
+	}
+	res = compareUint(uint64(len(v.prerelease)), uint64(len(other.prerelease)))
+	return
+}
+
+func compareUint(left, right uint64) (res int) {
+	switch {
+	case left < right:
+		res = -1
+	case left > right:
+		res = 1
+	}
+	return
+}
@@ -0,0 +1,13 @@
+pod "first" {
+  dropin "docker.service" "10-soil.conf" {
+    source = <<EOF
+    [Service]
+    Environment=A=1
+    EOF
+  }
+  dropin "nginx.service" "10-soil.conf" {
+    update = "reload"
+    destroy = ""
+    source = "[Service]"
+  }
+}
@@ -0,0 +1,6 @@
+pod "counted" {
+  count = 3
+  max_per_node = 2
+}
+
+pod "single" {}
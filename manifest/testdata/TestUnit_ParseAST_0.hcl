@@ -0,0 +1,19 @@
+pod "1" {
+  unit "1.service" {
+    source = "[Service]"
+    health {
+      tcp = "127.0.0.1:8080"
+    }
+  }
+  unit "2.service" {
+    source = "[Service]"
+    health {
+      timeout = "5s"
+      exec = "/usr/bin/true"
+      http = "http://127.0.0.1:8080/health"
+    }
+  }
+  unit "3.service" {
+    source = "[Service]"
+  }
+}
@@ -0,0 +1,7 @@
+pod "1" {
+  unit "1.service" {
+    health {
+      timeout = "never"
+    }
+  }
+}
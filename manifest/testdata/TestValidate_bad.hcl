@@ -0,0 +1,37 @@
+pod "first" {
+  runtme = true
+  depends_on = ["other", "first"]
+  constraint {
+    "${meta.rack}" = "=> rack-1"
+    "${metta.rack}" = "rack-1"
+  }
+  unit "1.service" {
+    create = "begin"
+    sorce = ""
+    health {
+      interval = "1s"
+    }
+  }
+  blob "/etc/first" {
+    source = "${hots.name}"
+  }
+  resource "port" {
+  }
+  dropin "docker.service" {
+  }
+  dropin "nginx.service" "10-${pood.name}.conf" {
+    update = "reboot"
+    mode = "0644"
+  }
+  blob "/etc/second" {
+    source = "${nope(meta.rack)}"
+  }
+  constraint {
+    any {
+      "${meta.ip}" = "in_cidr 10.0.0.0/33"
+      group {
+        "${meta.host}" = "=~ web-("
+      }
+    }
+  }
+}
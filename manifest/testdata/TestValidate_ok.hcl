@@ -0,0 +1,49 @@
+pod "first" {
+  runtime = true
+  depends_on = ["second"]
+  constraint {
+    "${meta.rack}" = "rack-1"
+    "${provision.other.state}" = "!= destroy"
+    "${meta.with.default|yes}" = "yes"
+    "${meta.ip}" = "in_cidr 10.0.0.0/8"
+    "${host.memory_mb}" = ">= 4096"
+    any {
+      "${meta.host}" = "=~ ^web-[0-9]+$"
+      group {
+        "${meta.version}" = ">= 1.2.0"
+      }
+    }
+  }
+  unit "${pod.name}-1.service" {
+    create = "start"
+    update = "reload-or-restart"
+    destroy = ""
+    source = <<EOF
+    [Service]
+    ExecStart=/usr/bin/sleep inf
+    # ${blob.etc-first}
+    EOF
+    health {
+      timeout = "10s"
+      tcp = "127.0.0.1:${resource.port.first.8080.value}"
+    }
+  }
+  blob "/etc/first" {
+    permissions = 0600
+    source = "RACK=${meta.rack}"
+  }
+  dropin "docker.service" "10-${pod.name}.conf" {
+    update = "reload-or-restart"
+    source = <<EOF
+    [Service]
+    Environment=RACK=${meta.rack}
+    EOF
+  }
+  resource "port" "8080" {
+    fixed = 8080
+  }
+  provider "range" "port" {
+    min = 8000
+    max = "${meta.max_port|9000}"
+  }
+}
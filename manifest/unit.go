@@ -1,11 +1,15 @@
 package manifest
 
 import (
+	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"strings"
+	"time"
 )
 
+const defaultHealthTimeout = "30s"
+
 type Units []Unit
 
 func (u *Units) Empty() ObjectParser {
@@ -28,6 +32,7 @@ type Unit struct {
 	Transition `json:",omitempty" hcl:",squash"`
 	Name       string
 	Source     string
+	Health     *Health `json:",omitempty"`
 }
 
 func (u Unit) GetID(parent ...string) string {
@@ -36,8 +41,23 @@ func (u Unit) GetID(parent ...string) string {
 
 func (u *Unit) ParseAST(raw *ast.ObjectItem) (err error) {
 	u.Name = raw.Keys[0].Token.Value().(string)
-	err = hcl.DecodeObject(u, raw)
+	if err = hcl.DecodeObject(u, raw); err != nil {
+		return
+	}
 	u.Source = Heredoc(u.Source)
+	if err = checkInterpolation(fmt.Sprintf(`unit "%s"`, u.Name), u.Name, u.Source); err != nil {
+		return
+	}
+	if u.Health != nil {
+		if u.Health.Timeout == "" {
+			u.Health.Timeout = defaultHealthTimeout
+		}
+		if _, err = u.Health.GetTimeout(); err != nil {
+			err = fmt.Errorf(`unit "%s": bad health timeout: %v`, u.Name, err)
+			return
+		}
+		err = checkInterpolation(fmt.Sprintf(`unit "%s": health`, u.Name), u.Health.Exec, u.Health.TCP, u.Health.HTTP)
+	}
 	return
 }
 
@@ -48,3 +68,17 @@ type Transition struct {
 	Destroy   string `json:",omitempty"`
 	Permanent bool   `json:",omitempty"`
 }
+
+// Unit health check. Unit is healthy when it is active and all defined probes
+// are passed before timeout.
+type Health struct {
+	Timeout string `json:",omitempty"`            // Time to wait for healthy state
+	Exec    string `json:",omitempty"`            // Command which should exit with zero status
+	TCP     string `json:",omitempty" hcl:"tcp"`  // Address to dial
+	HTTP    string `json:",omitempty" hcl:"http"` // URL which should respond with 2xx status
+}
+
+func (h Health) GetTimeout() (res time.Duration, err error) {
+	res, err = time.ParseDuration(h.Timeout)
+	return
+}
@@ -0,0 +1,38 @@
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/akaspin/soil/lib"
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUnit_ParseAST(t *testing.T) {
+	t.Run(`health`, func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		require.NoError(t, buffers.ReadFiles("testdata/TestUnit_ParseAST_0.hcl"))
+		var pods manifest.PodSlice
+		require.NoError(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+		require.Len(t, pods, 1)
+		require.Len(t, pods[0].Units, 3)
+		assert.Equal(t, &manifest.Health{
+			Timeout: "30s",
+			TCP:     "127.0.0.1:8080",
+		}, pods[0].Units[0].Health)
+		assert.Equal(t, &manifest.Health{
+			Timeout: "5s",
+			Exec:    "/usr/bin/true",
+			HTTP:    "http://127.0.0.1:8080/health",
+		}, pods[0].Units[1].Health)
+		assert.Nil(t, pods[0].Units[2].Health)
+	})
+	t.Run(`bad timeout`, func(t *testing.T) {
+		var buffers lib.StaticBuffers
+		require.NoError(t, buffers.ReadFiles("testdata/TestUnit_ParseAST_1.hcl"))
+		var pods manifest.PodSlice
+		assert.Error(t, pods.Unmarshal(manifest.PrivateNamespace, buffers.GetReaders()...))
+	})
+}
@@ -0,0 +1,423 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// interpolation namespaces available in pod manifests
+	interpolationNamespaces = map[string]struct{}{
+		"meta":      {},
+		"system":    {},
+		"host":      {},
+		"agent":     {},
+		"pod":       {},
+		"blob":      {},
+		"resource":  {},
+		"provider":  {},
+		"provision": {},
+		"unit":      {},
+		"counter":   {},
+	}
+
+	// available unit transition commands
+	unitCommands = map[string]struct{}{
+		"":                      {},
+		"start":                 {},
+		"stop":                  {},
+		"restart":               {},
+		"reload":                {},
+		"try-restart":           {},
+		"reload-or-restart":     {},
+		"reload-or-try-restart": {},
+	}
+
+	podKeys    = []string{"runtime", "target", "count", "max_per_node", "rollback", "depends_on", "constraint", "unit", "blob", "dropin", "resource", "provider"}
+	unitKeys   = []string{"create", "update", "destroy", "permanent", "source", "health"}
+	healthKeys = []string{"timeout", "exec", "tcp", "http"}
+	blobKeys   = []string{"permissions", "owner", "group", "dir_mode", "backup", "leave", "source", "source_file", "source_url", "sha256", "archive"}
+	dropInKeys = []string{"create", "update", "destroy", "source"}
+
+	constraintOps = []string{opEqual, opNotEqual, opLess, opLessOrEqual, opGreater, opGreaterOrEqual, opIn, opNotIn, opMatch, opInCIDR}
+)
+
+// ValidationError is manifest problem with position in source
+type ValidationError struct {
+	Pos     token.Pos
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Validate checks pods in manifest source. Name is used as filename in
+// positions. Returns all found problems ordered by position.
+func Validate(name string, src []byte) (res []ValidationError) {
+	file, err := parser.Parse(src)
+	if err != nil {
+		pos := token.Pos{}
+		if posErr, ok := err.(*parser.PosError); ok {
+			pos = posErr.Pos
+			err = posErr.Err
+		}
+		pos.Filename = name
+		res = append(res, ValidationError{Pos: pos, Message: err.Error()})
+		return
+	}
+	root, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		res = append(res, ValidationError{Pos: token.Pos{Filename: name}, Message: "root should be an object"})
+		return
+	}
+	v := &validator{
+		filename: name,
+	}
+	for _, item := range root.Filter("pod").Items {
+		v.validatePod(item)
+	}
+	if len(v.errors) == 0 {
+		// semantic errors without positions
+		var pods PodSlice
+		if err = pods.Unmarshal(PrivateNamespace, bytes.NewReader(src)); err != nil {
+			errs := []error{err}
+			if multi, isMulti := err.(*multierror.Error); isMulti {
+				errs = multi.Errors
+			}
+			for _, err1 := range errs {
+				v.report(token.Pos{}, "%s", err1.Error())
+			}
+		}
+		v.validateDependencyCycles(pods)
+	}
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		return v.errors[i].Pos.Before(v.errors[j].Pos)
+	})
+	res = v.errors
+	return
+}
+
+type validator struct {
+	filename string
+	errors   []ValidationError
+}
+
+func (v *validator) report(pos token.Pos, format string, args ...interface{}) {
+	pos.Filename = v.filename
+	v.errors = append(v.errors, ValidationError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validatePod(item *ast.ObjectItem) {
+	if len(item.Keys) != 1 {
+		v.report(item.Pos(), `pod should be defined as pod "name"`)
+		return
+	}
+	name := keyName(item.Keys[0])
+	body, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		v.report(item.Val.Pos(), `pod "%s": should be an object`, name)
+		return
+	}
+	v.checkKeys(body.List, podKeys, fmt.Sprintf(`pod "%s"`, name))
+	for _, sub := range body.List.Filter("depends_on").Items {
+		ast.Walk(sub.Val, func(node ast.Node) (ast.Node, bool) {
+			if lit, ok := node.(*ast.LiteralType); ok && lit.Token.Value() == name {
+				v.report(lit.Pos(), `pod "%s": depends on itself`, name)
+			}
+			return node, true
+		})
+	}
+	for _, sub := range body.List.Filter("constraint").Items {
+		v.validateConstraint(sub, name)
+	}
+	for _, sub := range body.List.Filter("unit").Items {
+		v.validateUnit(sub, name)
+	}
+	for _, sub := range body.List.Filter("blob").Items {
+		v.validateBlob(sub, name)
+	}
+	for _, sub := range body.List.Filter("dropin").Items {
+		v.validateDropIn(sub, name)
+	}
+	for _, sub := range body.List.Filter("resource").Items {
+		v.validatePair(sub, name, "resource", `"provider" "name"`)
+	}
+	for _, sub := range body.List.Filter("provider").Items {
+		v.validatePair(sub, name, "provider", `"kind" "name"`)
+	}
+}
+
+// validateDependencyCycles reports each dependency cycle between pods in
+// manifest once. Self-dependencies are reported by validatePod.
+func (v *validator) validateDependencyCycles(pods PodSlice) {
+	dependencies := map[string][]string{}
+	for _, pod := range pods {
+		dependencies[pod.Name] = pod.DependsOn
+	}
+	dependsOn := func(name string) []string {
+		return dependencies[name]
+	}
+	for _, pod := range pods {
+		cycle := DependencyCycle(pod.Name, dependsOn)
+		if len(cycle) < 3 {
+			continue
+		}
+		first := true
+		for _, name := range cycle {
+			first = first && pod.Name <= name
+		}
+		if first {
+			v.report(token.Pos{}, `pod "%s": dependency cycle %s`, pod.Name, strings.Join(cycle, " -> "))
+		}
+	}
+}
+
+func (v *validator) validateConstraint(item *ast.ObjectItem, pod string) {
+	body, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		v.report(item.Val.Pos(), `pod "%s": constraint should be an object`, pod)
+		return
+	}
+	v.validateConstraintPairs(body.List, pod, true)
+}
+
+func (v *validator) validateConstraintPairs(list *ast.ObjectList, pod string, allowAny bool) {
+	for _, pair := range list.Items {
+		left := keyName(pair.Keys[0])
+		if anyBody, isObject := pair.Val.(*ast.ObjectType); isObject {
+			switch {
+			case left == "any" && allowAny:
+				for _, sub := range anyBody.List.Items {
+					if keyName(sub.Keys[0]) == "group" {
+						if groupBody, isGroup := sub.Val.(*ast.ObjectType); isGroup {
+							v.validateConstraintPairs(groupBody.List, pod, true)
+							continue
+						}
+					}
+					v.validateConstraintPairs(&ast.ObjectList{Items: []*ast.ObjectItem{sub}}, pod, false)
+				}
+				continue
+			case left == "any":
+				v.report(pair.Val.Pos(), `pod "%s": constraint "any" should be defined as "group" in "any"`, pod)
+				continue
+			}
+		}
+		v.checkReferences(pair.Keys[0].Pos(), left)
+		lit, ok := pair.Val.(*ast.LiteralType)
+		if !ok || lit.Token.Type != token.STRING {
+			v.report(pair.Val.Pos(), `pod "%s": constraint "%s" should be a string`, pod, left)
+			continue
+		}
+		right, _ := lit.Token.Value().(string)
+		v.checkReferences(lit.Pos(), right)
+		split := strings.SplitN(right, " ", 2)
+		if len(split) != 2 {
+			continue
+		}
+		switch {
+		case split[0] == opInCIDR:
+			for _, chunk := range strings.Split(split[1], ",") {
+				chunk = strings.TrimSpace(chunk)
+				if _, _, err := net.ParseCIDR(chunk); err != nil && len(ExtractEnv(chunk)) == 0 {
+					v.report(lit.Pos(), `pod "%s": constraint "%s": bad CIDR "%s"`, pod, left, chunk)
+				}
+			}
+		case split[0] == opMatch:
+			if _, err := regexp.Compile(split[1]); err != nil && len(ExtractEnv(split[1])) == 0 {
+				v.report(lit.Pos(), `pod "%s": constraint "%s": %v`, pod, left, err)
+			}
+		case isOperatorLike(split[0]) && !isConstraintOp(split[0]):
+			v.report(lit.Pos(), `pod "%s": constraint "%s": unknown operator "%s"`, pod, left, split[0])
+		}
+	}
+}
+
+func (v *validator) validateUnit(item *ast.ObjectItem, pod string) {
+	if len(item.Keys) != 1 {
+		v.report(item.Pos(), `pod "%s": unit should be defined as unit "name"`, pod)
+		return
+	}
+	name := keyName(item.Keys[0])
+	v.checkReferences(item.Keys[0].Pos(), name)
+	body, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		v.report(item.Val.Pos(), `pod "%s": unit "%s": should be an object`, pod, name)
+		return
+	}
+	subject := fmt.Sprintf(`pod "%s": unit "%s"`, pod, name)
+	v.checkKeys(body.List, unitKeys, subject)
+	v.checkTransition(body.List, subject)
+	for _, sub := range body.List.Filter("source").Items {
+		if value, pos, ok := literalString(sub); ok {
+			v.checkReferences(pos, value)
+		}
+	}
+	for _, sub := range body.List.Filter("health").Items {
+		healthBody, ok := sub.Val.(*ast.ObjectType)
+		if !ok {
+			v.report(sub.Val.Pos(), `%s: health should be an object`, subject)
+			continue
+		}
+		v.checkKeys(healthBody.List, healthKeys, subject+": health")
+		for _, probe := range healthBody.List.Filter("exec").Items {
+			if value, pos, ok := literalString(probe); ok && strings.TrimSpace(value) == "" {
+				v.report(pos, `%s: health: exec is empty`, subject)
+			}
+		}
+		for _, key := range []string{"exec", "tcp", "http"} {
+			for _, probe := range healthBody.List.Filter(key).Items {
+				if value, pos, ok := literalString(probe); ok {
+					v.checkReferences(pos, value)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateBlob(item *ast.ObjectItem, pod string) {
+	if len(item.Keys) != 1 {
+		v.report(item.Pos(), `pod "%s": blob should be defined as blob "path"`, pod)
+		return
+	}
+	name := keyName(item.Keys[0])
+	v.checkReferences(item.Keys[0].Pos(), name)
+	body, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		v.report(item.Val.Pos(), `pod "%s": blob "%s": should be an object`, pod, name)
+		return
+	}
+	v.checkKeys(body.List, blobKeys, fmt.Sprintf(`pod "%s": blob "%s"`, pod, name))
+	for _, key := range []string{"source", "source_file", "source_url"} {
+		for _, sub := range body.List.Filter(key).Items {
+			if value, pos, ok := literalString(sub); ok {
+				v.checkReferences(pos, value)
+			}
+		}
+	}
+}
+
+func (v *validator) validateDropIn(item *ast.ObjectItem, pod string) {
+	if len(item.Keys) != 2 {
+		v.report(item.Pos(), `pod "%s": dropin should be defined as dropin "unit" "name"`, pod)
+		return
+	}
+	subject := fmt.Sprintf(`pod "%s": dropin "%s" "%s"`, pod, keyName(item.Keys[0]), keyName(item.Keys[1]))
+	for _, key := range item.Keys {
+		v.checkReferences(key.Pos(), keyName(key))
+	}
+	body, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		v.report(item.Val.Pos(), `%s: should be an object`, subject)
+		return
+	}
+	v.checkKeys(body.List, dropInKeys, subject)
+	v.checkTransition(body.List, subject)
+	for _, sub := range body.List.Filter("source").Items {
+		if value, pos, ok := literalString(sub); ok {
+			v.checkReferences(pos, value)
+		}
+	}
+}
+
+func (v *validator) validatePair(item *ast.ObjectItem, pod, kind, form string) {
+	if len(item.Keys) != 2 {
+		v.report(item.Pos(), `pod "%s": %s should be defined as %s %s`, pod, kind, kind, form)
+		return
+	}
+	ast.Walk(item.Val, func(node ast.Node) (ast.Node, bool) {
+		if lit, ok := node.(*ast.LiteralType); ok {
+			if value, isString := lit.Token.Value().(string); isString {
+				v.checkReferences(lit.Pos(), value)
+			}
+		}
+		return node, true
+	})
+}
+
+// checkKeys reports keys not in allowed list
+func (v *validator) checkKeys(list *ast.ObjectList, allowed []string, subject string) {
+	for _, item := range list.Items {
+		key := keyName(item.Keys[0])
+		var found bool
+		for _, candidate := range allowed {
+			if key == candidate {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.report(item.Keys[0].Pos(), `%s: unknown key "%s"`, subject, key)
+		}
+	}
+}
+
+// checkTransition reports unknown transition commands
+func (v *validator) checkTransition(list *ast.ObjectList, subject string) {
+	for _, transition := range []string{"create", "update", "destroy"} {
+		for _, sub := range list.Filter(transition).Items {
+			value, pos, ok := literalString(sub)
+			if !ok {
+				continue
+			}
+			if _, known := unitCommands[value]; !known {
+				v.report(pos, `%s: unknown %s command "%s"`, subject, transition, value)
+			}
+		}
+	}
+}
+
+// checkReferences reports references to unknown interpolation namespaces
+func (v *validator) checkReferences(pos token.Pos, value string) {
+	for _, ref := range ExtractEnv(value) {
+		ref = strings.SplitN(ref, "|", 2)[0]
+		namespace := strings.SplitN(ref, ".", 2)[0]
+		if _, ok := interpolationNamespaces[namespace]; !ok {
+			v.report(pos, `undefined variable namespace "%s" in "${%s}"`, namespace, ref)
+		}
+	}
+	for _, err := range CheckInterpolation(value) {
+		v.report(pos, "%v", err)
+	}
+}
+
+func keyName(key *ast.ObjectKey) (res string) {
+	res, ok := key.Token.Value().(string)
+	if !ok {
+		res = key.Token.Text
+	}
+	return
+}
+
+func literalString(item *ast.ObjectItem) (res string, pos token.Pos, ok bool) {
+	lit, isLit := item.Val.(*ast.LiteralType)
+	if !isLit {
+		return
+	}
+	pos = lit.Pos()
+	res, ok = lit.Token.Value().(string)
+	return
+}
+
+func isOperatorLike(value string) (ok bool) {
+	ok = value != "" && strings.Trim(value, "=!<>~") == ""
+	return
+}
+
+func isConstraintOp(value string) (ok bool) {
+	for _, op := range constraintOps {
+		if value == op {
+			ok = true
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+// +build ide test_unit
+
+package manifest_test
+
+import (
+	"github.com/akaspin/soil/manifest"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run(`ok`, func(t *testing.T) {
+		src, err := ioutil.ReadFile("testdata/TestValidate_ok.hcl")
+		assert.NoError(t, err)
+		assert.Empty(t, manifest.Validate("ok.hcl", src))
+	})
+	t.Run(`bad`, func(t *testing.T) {
+		src, err := ioutil.ReadFile("testdata/TestValidate_bad.hcl")
+		assert.NoError(t, err)
+		var res []string
+		for _, problem := range manifest.Validate("bad.hcl", src) {
+			res = append(res, problem.Error())
+		}
+		assert.Equal(t, []string{
+			`bad.hcl:2:3: pod "first": unknown key "runtme"`,
+			`bad.hcl:3:26: pod "first": depends on itself`,
+			`bad.hcl:5:22: pod "first": constraint "${meta.rack}": unknown operator "=>"`,
+			`bad.hcl:6:5: undefined variable namespace "metta" in "${metta.rack}"`,
+			`bad.hcl:9:14: pod "first": unit "1.service": unknown create command "begin"`,
+			`bad.hcl:10:5: pod "first": unit "1.service": unknown key "sorce"`,
+			`bad.hcl:12:7: pod "first": unit "1.service": health: unknown key "interval"`,
+			`bad.hcl:16:14: undefined variable namespace "hots" in "${hots.name}"`,
+			`bad.hcl:18:12: pod "first": resource should be defined as resource "provider" "name"`,
+			`bad.hcl:20:10: pod "first": dropin should be defined as dropin "unit" "name"`,
+			`bad.hcl:22:26: undefined variable namespace "pood" in "${pood.name}"`,
+			`bad.hcl:23:14: pod "first": dropin "nginx.service" "10-${pood.name}.conf": unknown update command "reboot"`,
+			`bad.hcl:24:5: pod "first": dropin "nginx.service" "10-${pood.name}.conf": unknown key "mode"`,
+			`bad.hcl:27:14: ${nope(meta.rack)}: unknown function "nope"`,
+			`bad.hcl:31:22: pod "first": constraint "${meta.ip}": bad CIDR "10.0.0.0/33"`,
+			"bad.hcl:33:26: pod \"first\": constraint \"${meta.host}\": error parsing regexp: missing closing ): `web-(`",
+		}, res)
+	})
+	t.Run(`syntax`, func(t *testing.T) {
+		res := manifest.Validate("syntax.hcl", []byte("pod \"1\" {\n  runtime = \n}\n"))
+		assert.Len(t, res, 1)
+		assert.True(t, res[0].Pos.IsValid())
+		assert.Equal(t, "syntax.hcl", res[0].Pos.Filename)
+	})
+	t.Run(`semantic`, func(t *testing.T) {
+		res := manifest.Validate("semantic.hcl", []byte("pod \"1\" {\n  unit \"1.service\" {\n    health {\n      timeout = \"bad\"\n    }\n  }\n}\n"))
+		assert.Len(t, res, 1)
+		assert.Contains(t, res[0].Error(), `semantic.hcl: unit "1.service": bad health timeout`)
+	})
+	t.Run(`empty health exec`, func(t *testing.T) {
+		res := manifest.Validate("health.hcl", []byte("pod \"1\" {\n  unit \"1.service\" {\n    health {\n      exec = \"  \"\n    }\n  }\n}\n"))
+		assert.Len(t, res, 1)
+		assert.Equal(t, `health.hcl:4:14: pod "1": unit "1.service": health: exec is empty`, res[0].Error())
+	})
+	t.Run(`dependency cycle`, func(t *testing.T) {
+		res := manifest.Validate("cycle.hcl", []byte(`
+pod "c" {
+  depends_on = ["a"]
+}
+pod "b" {
+  depends_on = ["c"]
+}
+pod "a" {
+  depends_on = ["b"]
+}
+pod "d" {
+  depends_on = ["a"]
+}
+`))
+		assert.Len(t, res, 1)
+		assert.Equal(t, `cycle.hcl: pod "a": dependency cycle a -> b -> c -> a`, res[0].Error())
+	})
+}
@@ -4,4 +4,5 @@ const (
 	V1AgentStop   = "/v1/agent/stop"
 	V1AgentReload = "/v1/agent/reload"
 	V1AgentDrain  = "/v1/agent/drain"
+	V1AgentMeta   = "/v1/agent/meta"
 )
@@ -0,0 +1,13 @@
+package proto
+
+import "encoding/json"
+
+const (
+	V1Events = "/v1/events"
+)
+
+// Event is one agent state change
+type Event struct {
+	Topic   string          // One of "provision", "resource", "registry" or "nodes"
+	Payload json.RawMessage // Message payload or null if message is empty
+}
@@ -0,0 +1,5 @@
+package proto
+
+const (
+	V1Metrics = "/v1/metrics"
+)
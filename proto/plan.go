@@ -0,0 +1,22 @@
+package proto
+
+const (
+	V1Plan = "/v1/plan"
+)
+
+// PodPlan describes what agent will do with pod
+type PodPlan struct {
+	Name         string
+	Allocated    bool              // Pod passed all constraints on agent
+	Failures     []string          `json:",omitempty"` // Constraint failures in form "<arbiter>: <error>"
+	Pending      []string          `json:",omitempty"` // Constraint pairs which depend on pod allocation in form "<arbiter>: <pair>"
+	Instructions []PlanInstruction `json:",omitempty"` // Ordered provision instructions
+}
+
+// PlanInstruction is one provision instruction
+type PlanInstruction struct {
+	Phase  int
+	Action string
+	Path   string
+	Diff   string `json:",omitempty"` // Unified diff for write instructions
+}
@@ -2,4 +2,5 @@ package proto
 
 const (
 	V1RegistryPods = "/v1/registry/pods"
+	V1Registry     = "/v1/registry"
 )
@@ -1,5 +1,19 @@
 package proto
 
+const (
+	V1StatusPing  = "/v1/status/ping"
+	V1StatusNode  = "/v1/status/node"
+	V1StatusNodes = "/v1/status/nodes"
+	V1StatusPods  = "/v1/status/pods/"
+	V1StatusEnv   = "/v1/status/env"
+)
+
+// NodeStatus is status of specific agent
+type NodeStatus struct {
+	Agent map[string]string `json:"agent"`
+	Meta  map[string]string `json:"meta"`
+}
+
 type NodeInfo struct {
 	ID        string
 	Advertise string
@@ -20,3 +34,21 @@ func (c NodesInfo) Less(i, j int) bool {
 func (c NodesInfo) Swap(i, j int) {
 	c[i], c[j] = c[j], c[i]
 }
+
+// ConstraintExplain explains pod constraint evaluation in one scheduler
+type ConstraintExplain struct {
+	Arbiter  string
+	Passed   bool
+	Pairs    []ConstraintPair  // Constraint pairs sorted by left field
+	Env      map[string]string // Environment values referenced by constraint
+	Failures []string          `json:",omitempty"` // Failed pairs
+}
+
+// ConstraintPair is one constraint pair with interpolated fields
+type ConstraintPair struct {
+	Left              string
+	Right             string
+	InterpolatedLeft  string
+	InterpolatedRight string
+	Passed            bool
+}